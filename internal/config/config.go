@@ -1,12 +1,28 @@
 package config
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
+
+	"csv-validator/internal/models"
+	"csv-validator/internal/tracing"
+	"csv-validator/internal/utils"
+	"csv-validator/pkg/logger"
 
 	"github.com/joho/godotenv"
 )
 
+// Storage backends selectable with STORAGE_BACKEND
+const (
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+)
+
 // Config holds all configuration for the application
 type Config struct {
 	Port           string
@@ -14,8 +30,77 @@ type Config struct {
 	DownloadDir    string
 	MaxFileSize    int64
 	LogLevel       string
+	LogFormat      string
 	GinMode        string
 	AllowedOrigins string
+	CORSMaxAge     time.Duration
+	EmptyRowPolicy string
+	SyncMaxSize    int64
+	SyncTimeout    time.Duration
+	EmailBatchMax  int64
+
+	MaxDecompressedSize int64
+	MaxCompressionRatio int64
+	MaxArchiveFiles     int64
+
+	CompressDownloads bool
+
+	ResumableDir string
+	ResumableTTL time.Duration
+
+	IdempotencyTTL time.Duration
+
+	StorageBackend    string
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3Prefix          string
+	S3VirtualHosted   bool
+
+	WebhookURLs        []string
+	WebhookSecret      string
+	WebhookMaxAttempts int64
+	WebhookRetryDelay  time.Duration
+	WebhookTimeout     time.Duration
+
+	WebhookAllowPrivateCallbacks bool
+
+	APIKeysFile string
+
+	RateLimitUploadPerMinute   int64
+	RateLimitUploadBurst       int64
+	RateLimitDownloadPerMinute int64
+	RateLimitDownloadBurst     int64
+	TrustedProxies             []string
+
+	TenantsFile             string
+	TenantMaxFileSize       int64
+	TenantMaxConcurrentJobs int64
+	TenantMaxStorageBytes   int64
+	TenantMaxJobsPerDay     int64
+
+	JWTJWKSURL     string
+	JWTJWKSFile    string
+	JWTJWKSRefresh time.Duration
+	JWTIssuer      string
+	JWTAudience    string
+	JWTTenantClaim string
+	JWTRolesClaim  string
+	JWTAdminRole   string
+
+	TracingExporter    string
+	TracingSampleRatio float64
+
+	ReadinessMinFreeBytes  int64
+	ReadinessMaxActiveJobs int64
+	ReadinessTimeout       time.Duration
+}
+
+// JWTEnabled reports whether bearer tokens are verified
+func (c *Config) JWTEnabled() bool {
+	return c.JWTJWKSURL != "" || c.JWTJWKSFile != ""
 }
 
 // Load loads configuration from environment variables and .env file
@@ -29,13 +114,167 @@ func Load() (*Config, error) {
 		DownloadDir:    getEnv("DOWNLOAD_DIR", "./downloads"),
 		MaxFileSize:    getEnvAsInt64("MAX_FILE_SIZE", 10*1024*1024), // 10MB default
 		LogLevel:       getEnv("LOG_LEVEL", "info"),
+		LogFormat:      getEnv("LOG_FORMAT", logger.FormatText),
 		GinMode:        getEnv("GIN_MODE", "release"),
 		AllowedOrigins: getEnv("ALLOWED_ORIGINS", "*"),
+		CORSMaxAge:     getEnvAsDuration("CORS_MAX_AGE", 10*time.Minute),
+		EmptyRowPolicy: getEnv("EMPTY_ROW_POLICY", string(models.EmptyRowPolicyPad)),
+		SyncMaxSize:    getEnvAsInt64("SYNC_MAX_SIZE", 1024*1024), // 1MB default
+		SyncTimeout:    getEnvAsDuration("SYNC_TIMEOUT", 10*time.Second),
+		EmailBatchMax:  getEnvAsInt64("EMAIL_BATCH_MAX", 100),
+
+		MaxDecompressedSize: getEnvAsInt64("MAX_DECOMPRESSED_SIZE", 1024*1024*1024), // 1GB default
+		MaxCompressionRatio: getEnvAsInt64("MAX_COMPRESSION_RATIO", 100),
+		MaxArchiveFiles:     getEnvAsInt64("MAX_ARCHIVE_FILES", 50),
+
+		CompressDownloads: getEnvAsBool("COMPRESS_DOWNLOADS", false),
+
+		ResumableTTL: getEnvAsDuration("RESUMABLE_UPLOAD_TTL", 24*time.Hour),
+
+		IdempotencyTTL: getEnvAsDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		StorageBackend:    getEnv("STORAGE_BACKEND", StorageBackendLocal),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          getEnv("S3_BUCKET", ""),
+		S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3Prefix:          getEnv("S3_PREFIX", ""),
+		S3VirtualHosted:   getEnvAsBool("S3_VIRTUAL_HOSTED", false),
+
+		WebhookURLs:        getEnvAsList("WEBHOOK_URLS"),
+		WebhookSecret:      getEnv("WEBHOOK_SECRET", ""),
+		WebhookMaxAttempts: getEnvAsInt64("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookRetryDelay:  getEnvAsDuration("WEBHOOK_RETRY_DELAY", 5*time.Second),
+		WebhookTimeout:     getEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+
+		WebhookAllowPrivateCallbacks: getEnvAsBool("WEBHOOK_ALLOW_PRIVATE_CALLBACKS", false),
+
+		APIKeysFile: getEnv("API_KEYS_FILE", ""),
+
+		RateLimitUploadPerMinute:   getEnvAsInt64("RATE_LIMIT_UPLOAD_PER_MINUTE", 30),
+		RateLimitUploadBurst:       getEnvAsInt64("RATE_LIMIT_UPLOAD_BURST", 10),
+		RateLimitDownloadPerMinute: getEnvAsInt64("RATE_LIMIT_DOWNLOAD_PER_MINUTE", 300),
+		RateLimitDownloadBurst:     getEnvAsInt64("RATE_LIMIT_DOWNLOAD_BURST", 50),
+		TrustedProxies:             getEnvAsList("TRUSTED_PROXIES"),
+
+		TenantsFile:             getEnv("TENANTS_FILE", ""),
+		TenantMaxFileSize:       getEnvAsInt64("TENANT_MAX_FILE_SIZE", 0),
+		TenantMaxConcurrentJobs: getEnvAsInt64("TENANT_MAX_CONCURRENT_JOBS", 0),
+		TenantMaxStorageBytes:   getEnvAsInt64("TENANT_MAX_STORAGE_BYTES", 0),
+		TenantMaxJobsPerDay:     getEnvAsInt64("TENANT_MAX_JOBS_PER_DAY", 0),
+
+		JWTJWKSURL:     getEnv("JWT_JWKS_URL", ""),
+		JWTJWKSFile:    getEnv("JWT_JWKS_FILE", ""),
+		JWTJWKSRefresh: getEnvAsDuration("JWT_JWKS_REFRESH", time.Hour),
+		JWTIssuer:      getEnv("JWT_ISSUER", ""),
+		JWTAudience:    getEnv("JWT_AUDIENCE", ""),
+		JWTTenantClaim: getEnv("JWT_TENANT_CLAIM", "tenant"),
+		JWTRolesClaim:  getEnv("JWT_ROLES_CLAIM", "roles"),
+		JWTAdminRole:   getEnv("JWT_ADMIN_ROLE", models.RoleAdmin),
+
+		TracingExporter:    getEnv("TRACING_EXPORTER", tracing.ExporterNone),
+		TracingSampleRatio: getEnvAsFloat64("TRACING_SAMPLE_RATIO", 1),
+
+		ReadinessMinFreeBytes:  getEnvAsInt64("READINESS_MIN_FREE_BYTES", 100*1024*1024),
+		ReadinessMaxActiveJobs: getEnvAsInt64("READINESS_MAX_ACTIVE_JOBS", 100),
+		ReadinessTimeout:       getEnvAsDuration("READINESS_TIMEOUT", 2*time.Second),
+	}
+
+	// Default to the AWS endpoint of the region; set S3_ENDPOINT for MinIO and friends
+	cfg.S3Endpoint = getEnv("S3_ENDPOINT", fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.S3Region))
+
+	// Staged uploads live under UPLOAD_DIR by default so completing one is a rename
+	cfg.ResumableDir = getEnv("RESUMABLE_DIR", filepath.Join(cfg.UploadDir, ".resumable"))
+
+	if !models.EmptyRowPolicy(cfg.EmptyRowPolicy).IsValid() {
+		return nil, fmt.Errorf("invalid EMPTY_ROW_POLICY %q (expected pad, keep or drop)", cfg.EmptyRowPolicy)
+	}
+
+	switch cfg.LogFormat {
+	case logger.FormatText, logger.FormatJSON, logger.FormatLogfmt:
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q (expected text, json or logfmt)", cfg.LogFormat)
+	}
+
+	if _, _, err := utils.ParseAllowedOrigins(cfg.AllowedOrigins); err != nil {
+		return nil, fmt.Errorf("invalid ALLOWED_ORIGINS: %w", err)
+	}
+
+	switch cfg.StorageBackend {
+	case StorageBackendLocal:
+	case StorageBackendS3:
+		if cfg.S3Bucket == "" {
+			return nil, fmt.Errorf("S3_BUCKET is required when STORAGE_BACKEND is s3")
+		}
+	default:
+		return nil, fmt.Errorf("invalid STORAGE_BACKEND %q (expected local or s3)", cfg.StorageBackend)
+	}
+
+	for _, webhookURL := range cfg.WebhookURLs {
+		if !utils.IsHTTPURL(webhookURL) {
+			return nil, fmt.Errorf("invalid WEBHOOK_URLS entry %q (expected an http or https URL)", webhookURL)
+		}
+	}
+	if cfg.WebhookMaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %d (expected at least 1)", cfg.WebhookMaxAttempts)
+	}
+
+	for name, value := range map[string]int64{
+		"RATE_LIMIT_UPLOAD_PER_MINUTE":   cfg.RateLimitUploadPerMinute,
+		"RATE_LIMIT_UPLOAD_BURST":        cfg.RateLimitUploadBurst,
+		"RATE_LIMIT_DOWNLOAD_PER_MINUTE": cfg.RateLimitDownloadPerMinute,
+		"RATE_LIMIT_DOWNLOAD_BURST":      cfg.RateLimitDownloadBurst,
+	} {
+		if value < 0 {
+			return nil, fmt.Errorf("invalid %s %d (expected 0 or more)", name, value)
+		}
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if !isIPOrCIDR(proxy) {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q (expected an IP address or CIDR)", proxy)
+		}
+	}
+
+	if cfg.JWTJWKSURL != "" && cfg.JWTJWKSFile != "" {
+		return nil, fmt.Errorf("set only one of JWT_JWKS_URL and JWT_JWKS_FILE")
+	}
+	if cfg.JWTJWKSURL != "" && !utils.IsHTTPURL(cfg.JWTJWKSURL) {
+		return nil, fmt.Errorf("invalid JWT_JWKS_URL %q (expected an http or https URL)", cfg.JWTJWKSURL)
+	}
+
+	switch cfg.TracingExporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		return nil, fmt.Errorf("invalid TRACING_EXPORTER %q (expected none, stdout or otlp)", cfg.TracingExporter)
+	}
+	if cfg.TracingSampleRatio < 0 || cfg.TracingSampleRatio > 1 {
+		return nil, fmt.Errorf("invalid TRACING_SAMPLE_RATIO %g (expected between 0 and 1)", cfg.TracingSampleRatio)
+	}
+
+	for name, value := range map[string]int64{
+		"READINESS_MIN_FREE_BYTES":  cfg.ReadinessMinFreeBytes,
+		"READINESS_MAX_ACTIVE_JOBS": cfg.ReadinessMaxActiveJobs,
+	} {
+		if value < 0 {
+			return nil, fmt.Errorf("invalid %s %d (expected 0 or more)", name, value)
+		}
+	}
+	if cfg.ReadinessTimeout <= 0 {
+		return nil, fmt.Errorf("invalid READINESS_TIMEOUT %s (expected more than 0)", cfg.ReadinessTimeout)
 	}
 
 	return cfg, nil
 }
 
+// isIPOrCIDR reports whether value is an IP address or a CIDR range
+func isIPOrCIDR(value string) bool {
+	if net.ParseIP(value) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(value)
+	return err == nil
+}
+
 // getEnv gets an environment variable with a fallback value
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
@@ -44,6 +283,17 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvAsList gets a comma-separated environment variable as a list, skipping empty entries
+func getEnvAsList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // getEnvAsInt64 gets an environment variable as int64 with a fallback value
 func getEnvAsInt64(key string, fallback int64) int64 {
 	if value := os.Getenv(key); value != "" {
@@ -53,3 +303,33 @@ func getEnvAsInt64(key string, fallback int64) int64 {
 	}
 	return fallback
 }
+
+// getEnvAsFloat64 gets an environment variable as float64 with a fallback value
+func getEnvAsFloat64(key string, fallback float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return fallback
+}
+
+// getEnvAsDuration gets an environment variable as time.Duration with a fallback value
+func getEnvAsDuration(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return fallback
+}
+
+// getEnvAsBool gets an environment variable as bool with a fallback value
+func getEnvAsBool(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return fallback
+}
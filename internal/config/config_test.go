@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -21,8 +22,34 @@ func TestLoad_DefaultValues(t *testing.T) {
 	assert.Equal(t, "./downloads", cfg.DownloadDir)
 	assert.Equal(t, int64(10*1024*1024), cfg.MaxFileSize)
 	assert.Equal(t, "info", cfg.LogLevel)
+	assert.Equal(t, "text", cfg.LogFormat)
+	assert.Equal(t, "none", cfg.TracingExporter)
+	assert.Equal(t, float64(1), cfg.TracingSampleRatio)
 	assert.Equal(t, "release", cfg.GinMode)
 	assert.Equal(t, "*", cfg.AllowedOrigins)
+	assert.Equal(t, 10*time.Minute, cfg.CORSMaxAge)
+	assert.Equal(t, "pad", cfg.EmptyRowPolicy)
+	assert.Equal(t, int64(1024*1024), cfg.SyncMaxSize)
+	assert.Equal(t, 10*time.Second, cfg.SyncTimeout)
+	assert.Equal(t, int64(100), cfg.EmailBatchMax)
+	assert.Equal(t, int64(1024*1024*1024), cfg.MaxDecompressedSize)
+	assert.Equal(t, int64(100), cfg.MaxCompressionRatio)
+	assert.Equal(t, int64(50), cfg.MaxArchiveFiles)
+	assert.False(t, cfg.CompressDownloads)
+	assert.Equal(t, "uploads/.resumable", cfg.ResumableDir)
+	assert.Equal(t, 24*time.Hour, cfg.ResumableTTL)
+	assert.Equal(t, 24*time.Hour, cfg.IdempotencyTTL)
+	assert.Equal(t, StorageBackendLocal, cfg.StorageBackend)
+	assert.Equal(t, "us-east-1", cfg.S3Region)
+	assert.Equal(t, "https://s3.us-east-1.amazonaws.com", cfg.S3Endpoint)
+	assert.False(t, cfg.S3VirtualHosted)
+	assert.Empty(t, cfg.WebhookURLs)
+	assert.Equal(t, int64(5), cfg.WebhookMaxAttempts)
+	assert.Equal(t, 5*time.Second, cfg.WebhookRetryDelay)
+	assert.Equal(t, 10*time.Second, cfg.WebhookTimeout)
+	assert.Empty(t, cfg.APIKeysFile)
+	assert.Empty(t, cfg.TenantsFile)
+	assert.Zero(t, cfg.TenantMaxJobsPerDay)
 }
 
 func TestLoad_CustomValues(t *testing.T) {
@@ -35,6 +62,7 @@ func TestLoad_CustomValues(t *testing.T) {
 	os.Setenv("LOG_LEVEL", "debug")
 	os.Setenv("GIN_MODE", "debug")
 	os.Setenv("ALLOWED_ORIGINS", "https://example.com")
+	os.Setenv("EMPTY_ROW_POLICY", "drop")
 
 	cfg, err := Load()
 	assert.NoError(t, err)
@@ -46,6 +74,214 @@ func TestLoad_CustomValues(t *testing.T) {
 	assert.Equal(t, "debug", cfg.LogLevel)
 	assert.Equal(t, "debug", cfg.GinMode)
 	assert.Equal(t, "https://example.com", cfg.AllowedOrigins)
+	assert.Equal(t, "drop", cfg.EmptyRowPolicy)
+	assert.Equal(t, "/tmp/uploads/.resumable", cfg.ResumableDir)
+
+	os.Clearenv()
+}
+
+func TestLoad_InvalidEmptyRowPolicy(t *testing.T) {
+	os.Clearenv()
+
+	os.Setenv("EMPTY_ROW_POLICY", "squash")
+
+	cfg, err := Load()
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "EMPTY_ROW_POLICY")
+
+	os.Clearenv()
+}
+
+func TestLoad_LogFormat(t *testing.T) {
+	os.Clearenv()
+
+	os.Setenv("LOG_FORMAT", "json")
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "json", cfg.LogFormat)
+
+	os.Setenv("LOG_FORMAT", "xml")
+	_, err = Load()
+	assert.ErrorContains(t, err, "LOG_FORMAT")
+
+	os.Clearenv()
+}
+
+func TestLoad_Tracing(t *testing.T) {
+	os.Clearenv()
+
+	os.Setenv("TRACING_EXPORTER", "otlp")
+	os.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "otlp", cfg.TracingExporter)
+	assert.Equal(t, 0.25, cfg.TracingSampleRatio)
+
+	os.Setenv("TRACING_SAMPLE_RATIO", "2")
+	_, err = Load()
+	assert.ErrorContains(t, err, "TRACING_SAMPLE_RATIO")
+
+	os.Setenv("TRACING_SAMPLE_RATIO", "1")
+	os.Setenv("TRACING_EXPORTER", "zipkin")
+	_, err = Load()
+	assert.ErrorContains(t, err, "TRACING_EXPORTER")
+
+	os.Clearenv()
+}
+
+func TestLoad_Readiness(t *testing.T) {
+	os.Clearenv()
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100*1024*1024), cfg.ReadinessMinFreeBytes)
+	assert.Equal(t, int64(100), cfg.ReadinessMaxActiveJobs)
+	assert.Equal(t, 2*time.Second, cfg.ReadinessTimeout)
+
+	os.Setenv("READINESS_MAX_ACTIVE_JOBS", "-1")
+	_, err = Load()
+	assert.ErrorContains(t, err, "READINESS_MAX_ACTIVE_JOBS")
+
+	os.Setenv("READINESS_MAX_ACTIVE_JOBS", "0")
+	os.Setenv("READINESS_TIMEOUT", "0s")
+	_, err = Load()
+	assert.ErrorContains(t, err, "READINESS_TIMEOUT")
+
+	os.Clearenv()
+}
+
+func TestLoad_AllowedOrigins(t *testing.T) {
+	os.Clearenv()
+
+	os.Setenv("ALLOWED_ORIGINS", "https://app.example.com, https://*.example.org:8443")
+	os.Setenv("CORS_MAX_AGE", "1h")
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, cfg.CORSMaxAge)
+
+	os.Setenv("ALLOWED_ORIGINS", "https://app.example.com/ui")
+	_, err = Load()
+	assert.ErrorContains(t, err, "ALLOWED_ORIGINS")
+
+	os.Clearenv()
+}
+
+func TestLoad_StorageBackend(t *testing.T) {
+	os.Clearenv()
+
+	os.Setenv("STORAGE_BACKEND", "s3")
+	os.Setenv("S3_ENDPOINT", "http://minio:9000")
+	os.Setenv("S3_BUCKET", "csv-validator")
+	os.Setenv("S3_PREFIX", "staging/")
+	os.Setenv("S3_VIRTUAL_HOSTED", "true")
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, StorageBackendS3, cfg.StorageBackend)
+	assert.Equal(t, "http://minio:9000", cfg.S3Endpoint)
+	assert.Equal(t, "csv-validator", cfg.S3Bucket)
+	assert.Equal(t, "staging/", cfg.S3Prefix)
+	assert.True(t, cfg.S3VirtualHosted)
+
+	// A bucket is required
+	os.Unsetenv("S3_BUCKET")
+	_, err = Load()
+	assert.ErrorContains(t, err, "S3_BUCKET")
+
+	os.Setenv("STORAGE_BACKEND", "ftp")
+	_, err = Load()
+	assert.ErrorContains(t, err, "STORAGE_BACKEND")
+
+	os.Clearenv()
+}
+
+func TestLoad_Webhooks(t *testing.T) {
+	os.Clearenv()
+
+	os.Setenv("WEBHOOK_URLS", "https://a.example/hook, http://b.example:8080/hook,")
+	os.Setenv("WEBHOOK_SECRET", "s3cret")
+	os.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://a.example/hook", "http://b.example:8080/hook"}, cfg.WebhookURLs)
+	assert.Equal(t, "s3cret", cfg.WebhookSecret)
+	assert.Equal(t, int64(3), cfg.WebhookMaxAttempts)
+	assert.False(t, cfg.WebhookAllowPrivateCallbacks)
+
+	os.Setenv("WEBHOOK_ALLOW_PRIVATE_CALLBACKS", "true")
+	cfg, err = Load()
+	assert.NoError(t, err)
+	assert.True(t, cfg.WebhookAllowPrivateCallbacks)
+
+	os.Setenv("WEBHOOK_MAX_ATTEMPTS", "0")
+	_, err = Load()
+	assert.ErrorContains(t, err, "WEBHOOK_MAX_ATTEMPTS")
+
+	os.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	os.Setenv("WEBHOOK_URLS", "a.example/hook")
+	_, err = Load()
+	assert.ErrorContains(t, err, "WEBHOOK_URLS")
+
+	os.Clearenv()
+}
+
+func TestLoad_RateLimits(t *testing.T) {
+	os.Clearenv()
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), cfg.RateLimitUploadPerMinute)
+	assert.Equal(t, int64(10), cfg.RateLimitUploadBurst)
+	assert.Equal(t, int64(300), cfg.RateLimitDownloadPerMinute)
+	assert.Equal(t, int64(50), cfg.RateLimitDownloadBurst)
+	assert.Empty(t, cfg.TrustedProxies)
+
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.1, 172.16.0.0/12")
+	cfg, err = Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "172.16.0.0/12"}, cfg.TrustedProxies)
+
+	os.Setenv("TRUSTED_PROXIES", "nginx")
+	_, err = Load()
+	assert.ErrorContains(t, err, "TRUSTED_PROXIES")
+
+	os.Unsetenv("TRUSTED_PROXIES")
+	os.Setenv("RATE_LIMIT_UPLOAD_BURST", "-1")
+	_, err = Load()
+	assert.ErrorContains(t, err, "RATE_LIMIT_UPLOAD_BURST")
+
+	os.Clearenv()
+}
+
+func TestLoad_JWT(t *testing.T) {
+	os.Clearenv()
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.False(t, cfg.JWTEnabled())
+	assert.Equal(t, "tenant", cfg.JWTTenantClaim)
+	assert.Equal(t, "roles", cfg.JWTRolesClaim)
+	assert.Equal(t, "admin", cfg.JWTAdminRole)
+	assert.Equal(t, time.Hour, cfg.JWTJWKSRefresh)
+
+	os.Setenv("JWT_JWKS_URL", "https://id.example.com/.well-known/jwks.json")
+	os.Setenv("JWT_TENANT_CLAIM", "org.id")
+	cfg, err = Load()
+	assert.NoError(t, err)
+	assert.True(t, cfg.JWTEnabled())
+	assert.Equal(t, "org.id", cfg.JWTTenantClaim)
+
+	os.Setenv("JWT_JWKS_FILE", "./jwks.json")
+	_, err = Load()
+	assert.ErrorContains(t, err, "JWT_JWKS_FILE")
+
+	os.Unsetenv("JWT_JWKS_FILE")
+	os.Setenv("JWT_JWKS_URL", "id.example.com/jwks.json")
+	_, err = Load()
+	assert.ErrorContains(t, err, "JWT_JWKS_URL")
 
 	os.Clearenv()
 }
@@ -85,6 +321,43 @@ func TestGetEnvAsInt64(t *testing.T) {
 	os.Clearenv()
 }
 
+func TestGetEnvAsDuration(t *testing.T) {
+	os.Clearenv()
+
+	// Test fallback
+	val := getEnvAsDuration("NONEXISTENT", time.Minute)
+	assert.Equal(t, time.Minute, val)
+
+	// Test valid duration
+	os.Setenv("TEST_DURATION", "250ms")
+	val = getEnvAsDuration("TEST_DURATION", time.Minute)
+	assert.Equal(t, 250*time.Millisecond, val)
+
+	// Test invalid duration (should use fallback)
+	os.Setenv("TEST_DURATION", "soon")
+	val = getEnvAsDuration("TEST_DURATION", time.Minute)
+	assert.Equal(t, time.Minute, val)
+
+	os.Clearenv()
+}
+
+func TestGetEnvAsBool(t *testing.T) {
+	os.Clearenv()
+
+	// Test fallback
+	assert.True(t, getEnvAsBool("NONEXISTENT", true))
+
+	// Test valid bool
+	os.Setenv("TEST_BOOL", "true")
+	assert.True(t, getEnvAsBool("TEST_BOOL", false))
+
+	// Test invalid bool (should use fallback)
+	os.Setenv("TEST_BOOL", "sometimes")
+	assert.False(t, getEnvAsBool("TEST_BOOL", false))
+
+	os.Clearenv()
+}
+
 func TestLoad_PartialEnvVars(t *testing.T) {
 	os.Clearenv()
 
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"csv-validator/internal/models"
+	"csv-validator/internal/services"
+	"csv-validator/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	headerAPIKey = "X-API-Key"
+
+	// identityKey is where the authenticated identity is kept on the gin context
+	identityKey = "identity"
+)
+
+// RequireAuth rejects requests without a valid API key or bearer token and
+// records who made the request for the handlers. API keys are sent in X-API-Key
+// or as a bearer token; JWTs as a bearer token. Without this middleware every
+// request is anonymous and can see every job.
+func RequireAuth(auth *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var identity models.Identity
+		var err error
+		if key := c.GetHeader(headerAPIKey); key != "" {
+			identity, err = auth.AuthenticateAPIKey(key)
+		} else {
+			identity, err = auth.AuthenticateBearer(bearerToken(c))
+		}
+
+		if err != nil {
+			logger.Debug(fmt.Sprintf("Rejected credentials for %s %s: %v", c.Request.Method, c.Request.URL.Path, err))
+			c.Header("WWW-Authenticate", `Bearer realm="csv-validator"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Missing or invalid credentials",
+			})
+			return
+		}
+
+		c.Set(identityKey, identity)
+		c.Request = c.Request.WithContext(logger.NewContext(c.Request.Context(), "tenant", identity.Tenant))
+		c.Next()
+	}
+}
+
+// bearerToken reads the credential from an Authorization: Bearer header
+func bearerToken(c *gin.Context) string {
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// requestIdentity returns who the request was authenticated as. ok is false when
+// authentication is turned off.
+func requestIdentity(c *gin.Context) (identity models.Identity, ok bool) {
+	value, exists := c.Get(identityKey)
+	if !exists {
+		return models.Identity{}, false
+	}
+	identity, ok = value.(models.Identity)
+	return identity, ok
+}
+
+// requestCreator returns who the jobs and uploads the request creates are
+// recorded as created by, empty when authentication is turned off
+func requestCreator(c *gin.Context) models.Identity {
+	identity, _ := requestIdentity(c)
+	return identity
+}
+
+// requestOwner returns the tenant owning the jobs and uploads the request
+// creates, or nothing when authentication is turned off
+func requestOwner(c *gin.Context) string {
+	identity, _ := requestIdentity(c)
+	return identity.Tenant
+}
+
+// canAccess reports whether the request may see and manage what owner created.
+// Admins may access everything. Anything else is reported as not found, so
+// other tenants can't even learn that it exists.
+func canAccess(c *gin.Context, owner string) bool {
+	identity, ok := requestIdentity(c)
+	if !ok {
+		return true
+	}
+	return identity.Tenant == owner || identity.HasRole(models.RoleAdmin)
+}
+
+// isAdmin reports whether the request may act across tenants
+func isAdmin(c *gin.Context) bool {
+	identity, ok := requestIdentity(c)
+	return !ok || identity.HasRole(models.RoleAdmin)
+}
+
+// accessibleJob returns the job with the given ID if the request may access it
+func (h *Handler) accessibleJob(c *gin.Context, jobID string) (*models.Job, bool) {
+	job, exists := h.jobService.GetJob(jobID)
+	if !exists || !canAccess(c, job.Owner) {
+		return nil, false
+	}
+	return job, true
+}
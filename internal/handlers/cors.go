@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"csv-validator/internal/utils"
+	"csv-validator/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS headers describing what browsers may send and read
+var (
+	corsAllowMethods = strings.Join([]string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+	}, ", ")
+
+	corsAllowHeaders = strings.Join([]string{
+		"Content-Type", "Content-Length", "Content-Disposition", "Accept", "Accept-Encoding",
+		"Authorization", "Cache-Control", "X-Requested-With", "X-CSRF-Token", headerAPIKey,
+		headerUploadOffset, headerUploadChecksum, headerIdempotencyKey, headerRequestID, "Last-Event-ID",
+		"traceparent", "tracestate",
+	}, ", ")
+
+	// corsExposeHeaders are the response headers the UI reads beyond those
+	// browsers always expose
+	corsExposeHeaders = strings.Join([]string{
+		"Content-Disposition", "Location", headerUploadOffset, headerIdempotentReplayed, headerRequestID,
+		"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+	}, ", ")
+)
+
+// corsPolicy is the parsed form of ALLOWED_ORIGINS
+type corsPolicy struct {
+	all      bool
+	patterns []utils.OriginPattern
+}
+
+// newCORSPolicy parses ALLOWED_ORIGINS. The configuration is validated when it
+// is loaded, so an invalid value only gets logged and allows no origin.
+func newCORSPolicy(allowedOrigins string) corsPolicy {
+	patterns, all, err := utils.ParseAllowedOrigins(allowedOrigins)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Ignoring ALLOWED_ORIGINS: %v", err))
+		return corsPolicy{}
+	}
+	return corsPolicy{all: all, patterns: patterns}
+}
+
+// allows reports whether a browser on origin may call the API
+func (p corsPolicy) allows(origin string) bool {
+	if p.all {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if pattern.Matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS lets browsers on the origins in allowedOrigins call the API. Allowed
+// origins are echoed back, so responses vary by Origin; with "*" any origin
+// may call, but without credentials. Preflight responses may be cached for
+// maxAge. Requests from other origins get no CORS headers, so browsers keep
+// the response from the page, and their preflight requests are refused.
+func CORS(allowedOrigins string, maxAge time.Duration) gin.HandlerFunc {
+	policy := newCORSPolicy(allowedOrigins)
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions
+
+		if origin == "" {
+			// Not a cross-origin browser request
+			if preflight {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+
+		if !policy.allows(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if policy.all {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		header.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+
+		if preflight {
+			header.Set("Access-Control-Allow-Methods", corsAllowMethods)
+			header.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
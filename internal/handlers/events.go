@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"csv-validator/internal/models"
+	"csv-validator/internal/utils"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// eventStreamHeartbeat is how often an idle event stream sends a comment, so
+	// proxies don't time it out
+	eventStreamHeartbeat = 15 * time.Second
+
+	// eventStreamBuffer is how far a stream may fall behind before it is closed.
+	// The client then reconnects and catches up from its Last-Event-ID.
+	eventStreamBuffer = 64
+)
+
+// JobEvents streams the events of a job as Server-Sent Events: its status
+// changes and, while it is processed, its progress. The stream ends after the
+// job completes, fails or is cancelled. Clients reconnecting with Last-Event-ID
+// get the events they missed; once there is nothing left to send they get a 204,
+// which tells EventSource to stop reconnecting.
+func (h *Handler) JobEvents(c *gin.Context) {
+	jobID := c.Param("id")
+
+	if !utils.IsValidJobID(jobID) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid job ID",
+		})
+		return
+	}
+
+	lastID := int64(0)
+	if header := strings.TrimSpace(c.GetHeader("Last-Event-ID")); header != "" {
+		id, err := strconv.ParseInt(header, 10, 64)
+		if err != nil || id < 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Invalid Last-Event-ID",
+			})
+			return
+		}
+		lastID = id
+	}
+
+	if _, exists := h.accessibleJob(c, jobID); !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Job not found",
+		})
+		return
+	}
+
+	// Subscribe before reading the backlog so no event falls in between
+	live := make(chan models.JobEvent, eventStreamBuffer)
+	overflow := make(chan struct{})
+	var overflowOnce sync.Once
+	unsubscribe := h.jobService.Subscribe(func(event models.JobEvent) {
+		if event.Job.ID != jobID {
+			return
+		}
+		select {
+		case live <- event:
+		default:
+			overflowOnce.Do(func() { close(overflow) })
+		}
+	})
+	defer unsubscribe()
+
+	backlog, exists := h.jobService.EventsSince(jobID, lastID)
+	if !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Job not found",
+		})
+		return
+	}
+
+	if job, _ := h.jobService.GetJob(jobID); job != nil && job.Status.IsFinished() && len(backlog) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// The stream lasts as long as the job, well past the server's write timeout
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	// send writes an event unless it was sent already, and reports whether it ends the stream
+	send := func(event models.JobEvent) bool {
+		if event.ID <= lastID {
+			return false
+		}
+		lastID = event.ID
+
+		c.Render(-1, sse.Event{
+			Id:    strconv.FormatInt(event.ID, 10),
+			Event: string(event.Type),
+			Data:  event,
+		})
+		c.Writer.Flush()
+
+		return event.Type == models.JobEventStatus && event.Job.Status.IsFinished()
+	}
+
+	for _, event := range backlog {
+		if send(event) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event := <-live:
+			if send(event) {
+				return
+			}
+		case <-heartbeat.C:
+			c.Writer.WriteString(": heartbeat\n\n")
+			c.Writer.Flush()
+		case <-overflow:
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -1,38 +1,66 @@
 package handlers
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"csv-validator/internal/config"
+	"csv-validator/internal/metrics"
 	"csv-validator/internal/models"
 	"csv-validator/internal/services"
 	"csv-validator/internal/utils"
 	"csv-validator/pkg/logger"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Handler struct {
-	csvService  *services.CSVService
-	jobService  *services.JobService
-	fileService *services.FileService
-	config      *config.Config
+	csvService         *services.CSVService
+	jobService         *services.JobService
+	fileService        *services.FileService
+	uploadService      *services.UploadService
+	idempotencyService *services.IdempotencyService
+	webhookService     *services.WebhookService
+	tenantService      *services.TenantService
+	healthService      *services.HealthService
+	config             *config.Config
 }
 
-func NewHandler(csvService *services.CSVService, jobService *services.JobService, fileService *services.FileService, config *config.Config) *Handler {
+func NewHandler(csvService *services.CSVService, jobService *services.JobService, fileService *services.FileService, uploadService *services.UploadService, idempotencyService *services.IdempotencyService, webhookService *services.WebhookService, tenantService *services.TenantService, healthService *services.HealthService, config *config.Config) *Handler {
 	return &Handler{
-		csvService:  csvService,
-		jobService:  jobService,
-		fileService: fileService,
-		config:      config,
+		csvService:         csvService,
+		jobService:         jobService,
+		fileService:        fileService,
+		uploadService:      uploadService,
+		idempotencyService: idempotencyService,
+		webhookService:     webhookService,
+		tenantService:      tenantService,
+		healthService:      healthService,
+		config:             config,
 	}
 }
 
-// UploadFile handles file uploads
+// UploadFile handles file uploads. Requests with an Idempotency-Key are only
+// processed once within the configured window.
 func (h *Handler) UploadFile(c *gin.Context) {
+	defer startSpan(c, "Handler.UploadFile")()
+
+	h.idempotentUpload(c, h.uploadFile)
+}
+
+// uploadFile saves the uploaded file and starts processing it
+func (h *Handler) uploadFile(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
@@ -56,25 +84,423 @@ func (h *Handler) UploadFile(c *gin.Context) {
 		return
 	}
 
-	job := h.jobService.CreateJob(file.Filename)
-	filePath, err := h.fileService.SaveFile(file, job.ID)
+	owner := requestOwner(c)
+	if err := h.tenantService.CheckUpload(owner, file.Size); err != nil {
+		h.quotaError(c, err)
+		return
+	}
+	metrics.UploadSize.WithLabelValues(uploadTypeMultipart).Observe(float64(file.Size))
+
+	options, err := h.processingOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: fmt.Sprintf("Invalid options: %v", err),
+		})
+		return
+	}
+
+	if utils.IsZipArchive(file.Filename) {
+		h.uploadArchive(c, file, options)
+		return
+	}
+
+	var job *models.Job
+	if err := h.tenantService.AdmitJobs(owner, 1, func() {
+		job = h.jobService.CreateJobWithOptions(requestCreator(c), file.Filename, options)
+	}); err != nil {
+		h.quotaError(c, err)
+		return
+	}
+	setSpanJob(c, job.ID)
+
+	files := h.fileService.ForTenant(owner)
+	var stored services.StoredFile
+	if utils.IsCompressedCSV(file.Filename) {
+		stored, err = files.SaveDecompressedFile(file, h.archiveLimits())
+	} else {
+		stored, err = files.SaveFile(c.Request.Context(), file)
+	}
 	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to save upload for job %s: %v", job.ID, err))
 		h.jobService.UpdateJobError(job.ID, "Save failed")
+		h.archiveError(c, err)
+		return
+	}
+
+	if err := h.checkStored(owner, stored); err != nil {
+		h.jobService.UpdateJobError(job.ID, "Quota exceeded")
+		h.quotaError(c, err)
+		return
+	}
+
+	h.startJob(c.Request.Context(), job.ID, stored, "")
+
+	c.JSON(http.StatusOK, models.UploadResponse{ID: job.ID, SHA256: stored.SHA256})
+}
+
+// uploadArchive creates one job per CSV in a zip upload, grouped under a new batch ID
+func (h *Handler) uploadArchive(c *gin.Context, file *multipart.FileHeader, options models.ProcessingOptions) {
+	batchID := uuid.New().String()
+
+	extracted, err := h.fileService.ForTenant(requestOwner(c)).ExtractArchive(file, h.archiveLimits())
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to extract archive %s: %v", file.Filename, err))
+		h.archiveError(c, err)
+		return
+	}
+
+	response, err := h.startBatch(c.Request.Context(), requestCreator(c), batchID, extracted, options)
+	if err != nil {
+		h.quotaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// startBatch creates and starts one job per extracted CSV. When the files are
+// over the tenant's limits, or it may not create that many jobs, the extracted
+// files are discarded instead.
+func (h *Handler) startBatch(ctx context.Context, creator models.Identity, batchID string, extracted []services.ExtractedFile, options models.ProcessingOptions) (models.UploadResponse, error) {
+	paths := make([]string, len(extracted))
+	stored := make([]services.StoredFile, len(extracted))
+	for i, f := range extracted {
+		paths[i] = f.Path
+		stored[i] = f.StoredFile
+	}
+
+	if err := h.checkStored(creator.Tenant, stored...); err != nil {
+		return models.UploadResponse{}, err
+	}
+
+	var jobs []*models.Job
+	if err := h.tenantService.AdmitJobs(creator.Tenant, len(extracted), func() {
+		jobs = h.jobService.CreateBatch(creator, batchID, paths, options)
+	}); err != nil {
+		for _, f := range extracted {
+			h.fileService.Discard(f.StoredFile)
+		}
+		return models.UploadResponse{}, err
+	}
+
+	response := models.UploadResponse{BatchID: batchID}
+	for i, job := range jobs {
+		h.startJob(ctx, job.ID, extracted[i].StoredFile, extracted[i].Name)
+		response.JobIDs = append(response.JobIDs, job.ID)
+	}
+
+	return response, nil
+}
+
+// startJob records where a job's upload was stored, renaming the job when
+// filename is set, and starts processing it. Jobs are shared with every
+// listener once created, so they are only ever changed through JobService.
+func (h *Handler) startJob(ctx context.Context, jobID string, stored services.StoredFile, filename string) {
+	err := h.jobService.AttachUpload(jobID, stored.Path, stored.SHA256, filename)
+	// The job keeps the file from being discarded now, or nothing needs it
+	h.fileService.Release(stored)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to record upload for job %s: %v", jobID, err))
+		return
+	}
+	h.csvService.ProcessFile(ctx, jobID)
+}
+
+// GetBatch lists the jobs created from an archive upload
+func (h *Handler) GetBatch(c *gin.Context) {
+	batchID := c.Param("id")
+
+	if !utils.IsValidJobID(batchID) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid batch ID",
+		})
+		return
+	}
+
+	// Every job of a batch has the same owner
+	jobs := h.jobService.ListBatchJobs(batchID)
+	if len(jobs) == 0 || !canAccess(c, jobs[0].Owner) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Batch not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.BatchResponse{BatchID: batchID, Jobs: jobs})
+}
+
+// archiveLimits returns the configured limits for decompressing uploads
+func (h *Handler) archiveLimits() services.ArchiveLimits {
+	return services.ArchiveLimits{
+		MaxTotalSize: h.config.MaxDecompressedSize,
+		MaxRatio:     h.config.MaxCompressionRatio,
+		MaxEntries:   int(h.config.MaxArchiveFiles),
+	}
+}
+
+// archiveError maps errors from saving or decompressing an upload to a response
+func (h *Handler) archiveError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrArchiveTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error: "Decompressed content too big",
+		})
+	case errors.Is(err, services.ErrArchiveEmpty):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Archive contains no CSV files",
+		})
+	case errors.Is(err, services.ErrInvalidArchive):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid compressed file",
+		})
+	default:
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Could not save file",
 		})
+	}
+}
+
+// Validate processes a small CSV body (or JSON array of rows) within the request
+// and returns the annotated result directly
+func (h *Handler) Validate(c *gin.Context) {
+	if c.Request.ContentLength > h.config.SyncMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error: "Payload too big for synchronous validation, use /api/upload",
+		})
+		return
+	}
+
+	options, err := h.processingOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: fmt.Sprintf("Invalid options: %v", err),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.SyncTimeout)
+	defer cancel()
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, h.config.SyncMaxSize)
+	jsonInput := strings.HasPrefix(c.ContentType(), "application/json")
+
+	var records [][]string
+	var summary models.JobSummary
+	if jsonInput {
+		var rows [][]string
+		if err = json.NewDecoder(body).Decode(&rows); err == nil {
+			records, summary, err = h.csvService.ValidateRecords(ctx, rows, options)
+		}
+	} else {
+		records, summary, err = h.csvService.ValidateCSV(ctx, body, options)
+	}
+
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+				Error: "Payload too big for synchronous validation, use /api/upload",
+			})
+		case errors.Is(err, context.DeadlineExceeded):
+			logger.Error(fmt.Sprintf("Synchronous validation timed out after %s", h.config.SyncTimeout))
+			c.JSON(http.StatusGatewayTimeout, models.ErrorResponse{
+				Error: "Validation timed out",
+			})
+		case errors.Is(err, context.Canceled):
+			// Client went away, nobody is listening for a response
+			c.Abort()
+		default:
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: fmt.Sprintf("Invalid input: %v", err),
+			})
+		}
+		return
+	}
+
+	if jsonInput || c.NegotiateFormat("text/csv", gin.MIMEJSON) == gin.MIMEJSON {
+		c.JSON(http.StatusOK, models.ValidateResponse{
+			Rows:    records,
+			Summary: summary,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.WriteAll(records); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write validation response: %v", err))
+	}
+}
+
+// ValidateEmails checks a single address or a batch of addresses with the same
+// rules the CSV pipeline uses
+func (h *Handler) ValidateEmails(c *gin.Context) {
+	var req models.EmailValidationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid request body",
+		})
+		return
+	}
+
+	if (req.Email == "") == (req.Emails == nil) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Provide either email or emails",
+		})
+		return
+	}
+
+	if req.Emails == nil {
+		c.JSON(http.StatusOK, emailValidationResult(req.Email))
+		return
+	}
+
+	if int64(len(req.Emails)) > h.config.EmailBatchMax {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: fmt.Sprintf("Too many addresses, at most %d per request", h.config.EmailBatchMax),
+		})
+		return
+	}
+
+	results := make([]models.EmailValidationResult, len(req.Emails))
+	for i, email := range req.Emails {
+		results[i] = emailValidationResult(email)
+	}
+
+	c.JSON(http.StatusOK, models.EmailValidationResponse{Results: results})
+}
+
+// GetJob returns the status and summary of a job
+func (h *Handler) GetJob(c *gin.Context) {
+	jobID := c.Param("id")
+
+	if !utils.IsValidJobID(jobID) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid job ID",
+		})
+		return
+	}
+
+	job, exists := h.accessibleJob(c, jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Job not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// ListJobs lists the jobs of the caller's API key, newest first, optionally
+// only those in one status. Admin keys see every job, or those of the key
+// given with owner.
+func (h *Handler) ListJobs(c *gin.Context) {
+	status := models.JobStatus(c.Query("status"))
+	if status != "" && !status.IsValid() {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: fmt.Sprintf("Unknown status %q", status),
+		})
 		return
 	}
 
-	job.OriginalFile = filePath
-	h.csvService.ProcessFile(job.ID)
+	owner, filterOwner := c.GetQuery("owner")
+	if filterOwner && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: "Listing the jobs of other API keys requires the admin scope",
+		})
+		return
+	}
+
+	var jobs []*models.Job
+	switch {
+	case filterOwner:
+		jobs = h.jobService.ListOwnerJobs(owner)
+	case isAdmin(c):
+		jobs = h.jobService.ListJobs()
+	default:
+		jobs = h.jobService.ListOwnerJobs(requestOwner(c))
+	}
+
+	response := models.JobListResponse{Jobs: []*models.Job{}}
+	for _, job := range jobs {
+		if status == "" || job.Status == status {
+			response.Jobs = append(response.Jobs, job)
+		}
+	}
 
-	c.JSON(http.StatusOK, models.UploadResponse{ID: job.ID})
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelJob stops a pending or processing job. Its status becomes cancelled
+// and webhooks are notified as for any other finished job.
+func (h *Handler) CancelJob(c *gin.Context) {
+	jobID := c.Param("id")
+
+	if !utils.IsValidJobID(jobID) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid job ID",
+		})
+		return
+	}
+
+	if _, exists := h.accessibleJob(c, jobID); !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Job not found",
+		})
+		return
+	}
+
+	job, err := h.csvService.CancelJob(c.Request.Context(), jobID)
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Job not found",
+		})
+	case errors.Is(err, services.ErrJobFinished):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Job has already finished",
+		})
+	case err != nil:
+		logger.Error(fmt.Sprintf("Failed to cancel job %s: %v", jobID, err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Could not cancel job",
+		})
+	default:
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// GetJobWebhooks returns the webhook delivery log of a job
+func (h *Handler) GetJobWebhooks(c *gin.Context) {
+	jobID := c.Param("id")
+
+	if !utils.IsValidJobID(jobID) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid job ID",
+		})
+		return
+	}
+
+	if _, exists := h.accessibleJob(c, jobID); !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Job not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.WebhookDeliveriesResponse{
+		JobID:      jobID,
+		Deliveries: h.webhookService.Deliveries(jobID),
+	})
 }
 
 // DownloadFile handles file downloads
 func (h *Handler) DownloadFile(c *gin.Context) {
 	jobID := c.Param("id")
+	defer startSpan(c, "Handler.DownloadFile", attribute.String("job.id", jobID))()
 	logger.Info(fmt.Sprintf("Download request for %s", jobID))
 
 	if !utils.IsValidJobID(jobID) {
@@ -85,10 +511,10 @@ func (h *Handler) DownloadFile(c *gin.Context) {
 		return
 	}
 
-	job, exists := h.jobService.GetJob(jobID)
+	job, exists := h.accessibleJob(c, jobID)
 	if !exists {
 		logger.Error(fmt.Sprintf("Job not found: %s", jobID))
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error: "Job not found",
 		})
 		return
@@ -109,6 +535,12 @@ func (h *Handler) DownloadFile(c *gin.Context) {
 		})
 		return
 
+	case models.JobStatusCancelled:
+		c.JSON(http.StatusGone, models.ErrorResponse{
+			Error: "Job was cancelled",
+		})
+		return
+
 	case models.JobStatusCompleted:
 		if job.ProcessedFile == "" {
 			logger.Error(fmt.Sprintf("No processed file for job %s", jobID))
@@ -118,23 +550,82 @@ func (h *Handler) DownloadFile(c *gin.Context) {
 			return
 		}
 
-		// Clean up filename for download
-		originalName := filepath.Base(job.OriginalFile)
-		downloadName := fmt.Sprintf("processed_%s", originalName)
+		format, err := h.downloadFormat(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: fmt.Sprintf("Invalid format: %v", err),
+			})
+			return
+		}
 
-		// Remove job ID prefix if present
-		if strings.Contains(downloadName, "_") {
-			parts := strings.Split(downloadName, "_")
-			if len(parts) >= 3 {
-				downloadName = "processed_" + strings.Join(parts[2:], "_")
-			}
+		encoding, explicit, err := h.downloadEncoding(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: fmt.Sprintf("Invalid compress: %v", err),
+			})
+			return
 		}
 
-		logger.Info(fmt.Sprintf("Serving %s for job %s", job.ProcessedFile, jobID))
+		// Name the download after the file the client uploaded
+		downloadName := fmt.Sprintf("processed_%s", job.Filename)
+
+		logger.Info(fmt.Sprintf("Serving %s as %s (%s) for job %s", job.ProcessedFile, format, encoding, jobID))
+
+		// The processed file is always CSV, whatever was uploaded
+		downloadName = strings.TrimSuffix(downloadName, filepath.Ext(downloadName)) + "." + string(format)
 
-		c.Header("Content-Type", "text/csv")
+		// ?compress= downloads a compressed file; Accept-Encoding compresses the transfer only
+		contentType := format.ContentType()
+		if explicit {
+			if encoding != services.EncodingIdentity {
+				downloadName += encoding.Extension()
+				contentType = encoding.ContentType()
+			}
+		} else {
+			c.Header("Vary", "Accept-Encoding")
+			if encoding != services.EncodingIdentity {
+				c.Header("Content-Encoding", string(encoding))
+			}
+		}
+
+		c.Header("Content-Type", contentType)
 		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", downloadName))
-		c.File(job.ProcessedFile)
+
+		// Serve the stored bytes as they are when they already match what was asked for
+		if format == services.FormatCSV && services.StoredEncoding(job.ProcessedFile) == encoding {
+			h.serveStoredFile(c, job.ProcessedFile)
+			return
+		}
+
+		file, err := h.fileService.OpenProcessedFile(job.ProcessedFile)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to open processed file for job %s: %v", jobID, err))
+			c.Header("Content-Encoding", "")
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "No processed file",
+			})
+			return
+		}
+		defer file.Close()
+
+		encoder, err := services.NewEncoder(c.Writer, encoding)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to compress download for job %s: %v", jobID, err))
+			c.Header("Content-Encoding", "")
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Could not compress file",
+			})
+			return
+		}
+
+		// Headers are already sent once conversion starts, so errors can only be logged
+		c.Status(http.StatusOK)
+		if err := services.ConvertCSV(encoder, file, format); err != nil {
+			logger.Error(fmt.Sprintf("Failed to convert job %s to %s: %v", jobID, format, err))
+		}
+		if err := encoder.Close(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to compress download for job %s: %v", jobID, err))
+		}
 		return
 
 	default:
@@ -145,3 +636,132 @@ func (h *Handler) DownloadFile(c *gin.Context) {
 		return
 	}
 }
+
+// processingOptions builds the job options from the form or query string, falling back to the configured defaults
+func (h *Handler) processingOptions(c *gin.Context) (models.ProcessingOptions, error) {
+	return h.buildOptions(h.optionValue(c, "empty_rows"), h.optionValue(c, "long_rows"), h.optionValue(c, "sheet"), h.optionValue(c, "callback_url"))
+}
+
+// buildOptions validates option values supplied by the client, using the configured
+// defaults for anything left empty
+func (h *Handler) buildOptions(emptyRows, longRows, sheet, callbackURL string) (models.ProcessingOptions, error) {
+	options := models.ProcessingOptions{
+		EmptyRows:   models.EmptyRowPolicy(h.config.EmptyRowPolicy),
+		Sheet:       sheet,
+		CallbackURL: callbackURL,
+	}
+
+	if callbackURL != "" && !utils.IsHTTPURL(callbackURL) {
+		return options, fmt.Errorf("callback_url must be an absolute http or https URL")
+	}
+	if callbackURL != "" && !h.config.WebhookAllowPrivateCallbacks && !utils.IsPublicHTTPURL(callbackURL) {
+		return options, fmt.Errorf("callback_url must point to a public address")
+	}
+
+	if emptyRows != "" {
+		policy := models.EmptyRowPolicy(strings.ToLower(emptyRows))
+		if !policy.IsValid() {
+			return options, fmt.Errorf("unknown empty_rows value %q", emptyRows)
+		}
+		options.EmptyRows = policy
+	}
+
+	if longRows != "" {
+		policy := models.LongRowPolicy(strings.ToLower(longRows))
+		if !policy.IsValid() {
+			return options, fmt.Errorf("unknown long_rows value %q", longRows)
+		}
+		options.LongRows = policy
+	}
+
+	return options, nil
+}
+
+// optionValue reads a processing option from the query string or, for multipart
+// requests, the form. Raw bodies are never consumed here.
+func (h *Handler) optionValue(c *gin.Context, name string) string {
+	value := c.Query(name)
+	if value == "" && c.ContentType() == gin.MIMEMultipartPOSTForm {
+		value = c.PostForm(name)
+	}
+	return value
+}
+
+// emailValidationResult converts a utils.EmailCheck into its API representation
+func emailValidationResult(email string) models.EmailValidationResult {
+	check := utils.CheckEmail(email)
+
+	result := metrics.ResultInvalid
+	if check.Valid {
+		result = metrics.ResultValid
+	}
+	metrics.EmailsValidated.WithLabelValues(result).Inc()
+
+	return models.EmailValidationResult{
+		Email:      email,
+		Valid:      check.Valid,
+		Strict:     check.Strict,
+		Reason:     check.Reason,
+		Normalized: check.Normalized,
+	}
+}
+
+// downloadFormat picks the output format from the format query parameter or,
+// failing that, the Accept header. CSV is used when neither asks for anything else.
+func (h *Handler) downloadFormat(c *gin.Context) (services.OutputFormat, error) {
+	if value := c.Query("format"); value != "" {
+		return services.ParseOutputFormat(value)
+	}
+
+	offers := make([]string, len(services.OutputFormats))
+	for i, format := range services.OutputFormats {
+		offers[i] = format.ContentType()
+	}
+
+	if format, ok := services.OutputFormatForContentType(c.NegotiateFormat(offers...)); ok {
+		return format, nil
+	}
+
+	return services.FormatCSV, nil
+}
+
+// serveStoredFile streams a stored file as it is. Seekable files, such as those
+// on local disk, go through http.ServeContent so range requests keep working.
+func (h *Handler) serveStoredFile(c *gin.Context, path string) {
+	file, err := h.fileService.Open(path)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to open processed file %s: %v", path, err))
+		c.Header("Content-Encoding", "")
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "No processed file",
+		})
+		return
+	}
+	defer file.Close()
+
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		var modTime time.Time
+		if info, err := h.fileService.Stat(path); err == nil {
+			modTime = info.ModTime
+		}
+		http.ServeContent(c.Writer, c.Request, filepath.Base(path), modTime, seeker)
+		return
+	}
+
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, file); err != nil {
+		logger.Error(fmt.Sprintf("Failed to send processed file %s: %v", path, err))
+	}
+}
+
+// downloadEncoding picks the compression for a download from the compress query
+// parameter or, failing that, the Accept-Encoding header. explicit reports
+// whether the client asked for a compressed file rather than a compressed transfer.
+func (h *Handler) downloadEncoding(c *gin.Context) (encoding services.ContentEncoding, explicit bool, err error) {
+	if value, ok := c.GetQuery("compress"); ok {
+		encoding, err = services.ParseContentEncoding(value)
+		return encoding, true, err
+	}
+
+	return services.NegotiateEncoding(c.GetHeader("Accept-Encoding")), false, nil
+}
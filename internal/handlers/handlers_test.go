@@ -1,22 +1,53 @@
 package handlers
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"csv-validator/internal/config"
+	"csv-validator/internal/metrics"
 	"csv-validator/internal/models"
 	"csv-validator/internal/services"
+	"csv-validator/pkg/logger"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func setupHandler(t *testing.T) (*Handler, string) {
@@ -24,18 +55,36 @@ func setupHandler(t *testing.T) (*Handler, string) {
 	require.NoError(t, err)
 
 	cfg := &config.Config{
-		Port:        "8080",
-		UploadDir:   tempDir,
-		MaxFileSize: 1024 * 1024, // 1MB
-		LogLevel:    "info",
-		GinMode:     "test",
+		Port:           "8080",
+		UploadDir:      tempDir,
+		MaxFileSize:    1024 * 1024, // 1MB
+		LogLevel:       "info",
+		GinMode:        "test",
+		EmptyRowPolicy: "pad",
+		SyncMaxSize:    1024,
+		SyncTimeout:    5 * time.Second,
+		EmailBatchMax:  3,
+
+		// Webhook receivers in tests listen on loopback
+		WebhookAllowPrivateCallbacks: true,
 	}
 
 	fileService := services.NewFileService(cfg.UploadDir, cfg.UploadDir+"-downloads")
 	jobService := services.NewJobService()
+	fileService.SetInUse(jobService.UsesFile)
 	csvService := services.NewCSVService(fileService, jobService)
+	uploadService := services.NewUploadService(filepath.Join(tempDir, ".resumable"), time.Hour)
+
+	idempotencyService := services.NewIdempotencyService(time.Hour)
+	webhookService := services.NewWebhookService(services.WebhookConfig{MaxAttempts: 3, RetryDelay: time.Millisecond, AllowPrivateCallbacks: true})
+	jobService.Subscribe(webhookService.JobChanged)
+
+	tenantService, err := services.NewTenantService(models.TenantLimits{}, nil, jobService, fileService)
+	require.NoError(t, err)
 
-	handler := NewHandler(csvService, jobService, fileService, cfg)
+	healthService := services.NewHealthService(services.HealthConfig{MaxActiveJobs: 10, Timeout: time.Second}, fileService, jobService)
+
+	handler := NewHandler(csvService, jobService, fileService, uploadService, idempotencyService, webhookService, tenantService, healthService, cfg)
 	return handler, tempDir
 }
 
@@ -82,6 +131,136 @@ func TestUpload(t *testing.T) {
 	assert.NotEmpty(t, response.ID)
 }
 
+func TestUploadIdempotencyKey(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	upload := func(key, name, content string) *httptest.ResponseRecorder {
+		req := createRequest(t, name, content)
+		req.Header.Set("Idempotency-Key", key)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+
+		handler.UploadFile(c)
+		return w
+	}
+
+	first := upload("retry-1", "test.csv", "name,email\nJohn,Chirag@test.com")
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	// A retry gets the original response and no new job
+	jobs := len(handler.jobService.ListJobs())
+	retry := upload("retry-1", "test.csv", "name,email\nJohn,Chirag@test.com")
+	require.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, first.Body.String(), retry.Body.String())
+	assert.Len(t, handler.jobService.ListJobs(), jobs)
+
+	// The same key with another file is rejected
+	other := upload("retry-1", "test.csv", "name,email\nYash,Yash@test.com")
+	assert.Equal(t, http.StatusUnprocessableEntity, other.Code)
+	assert.Len(t, handler.jobService.ListJobs(), jobs)
+
+	// Rejected requests are replayed as well
+	invalid := upload("retry-2", "test.txt", "hello")
+	require.Equal(t, http.StatusBadRequest, invalid.Code)
+	replayed := upload("retry-2", "test.txt", "hello")
+	assert.Equal(t, http.StatusBadRequest, replayed.Code)
+	assert.Equal(t, "true", replayed.Header().Get("Idempotent-Replayed"))
+
+	// Without a key every request is a new upload
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = createRequest(t, "test.csv", "name,email\nJohn,Chirag@test.com")
+	handler.UploadFile(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, handler.jobService.ListJobs(), jobs+1)
+}
+
+func TestUploadIdempotencyKey_Panic(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+
+	panics := true
+	router.POST("/api/upload", func(c *gin.Context) {
+		handler.idempotentUpload(c, func(c *gin.Context) {
+			if panics {
+				panic("upload failed")
+			}
+			c.JSON(http.StatusOK, models.UploadResponse{ID: "job"})
+		})
+	})
+
+	upload := func() *httptest.ResponseRecorder {
+		req := createRequest(t, "test.csv", "name,email\nJohn,Chirag@test.com")
+		req.Header.Set(headerIdempotencyKey, "panic")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, upload().Code)
+
+	// The key isn't left in progress by the upload that never finished
+	panics = false
+	w := upload()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(headerIdempotentReplayed))
+}
+
+func TestUploadDeduplicated(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	upload := func(name string) models.UploadResponse {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = createRequest(t, name, "name,email\nJohn,Chirag@test.com")
+
+		handler.UploadFile(c)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.UploadResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	completed := func(id string) bool {
+		job, _ := handler.jobService.GetJob(id)
+		return job.Status == models.JobStatusCompleted
+	}
+
+	first := upload("test.csv")
+	require.Eventually(t, func() bool { return completed(first.ID) }, time.Second, 5*time.Millisecond)
+
+	second := upload("renamed.csv")
+	assert.Equal(t, first.SHA256, second.SHA256)
+	require.Eventually(t, func() bool { return completed(second.ID) }, time.Second, 5*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: second.ID}}
+	handler.GetJob(c)
+
+	var job models.Job
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, first.ID, job.DeduplicatedFrom)
+	assert.Equal(t, "renamed.csv", job.Filename)
+}
+
 func TestUploadNoFile(t *testing.T) {
 	handler, tempDir := setupHandler(t)
 	defer os.RemoveAll(tempDir)
@@ -106,6 +285,7 @@ func TestDownloadInvalidID(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/download", nil)
 	c.Params = []gin.Param{{Key: "id", Value: "invalid"}}
 
 	handler.DownloadFile(c)
@@ -159,11 +339,12 @@ func TestDownloadJobNotFound(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/download", nil)
 	c.Params = []gin.Param{{Key: "id", Value: "a225eb00-0907-4273-92ca-5faadeefae5f"}}
 
 	handler.DownloadFile(c)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.Contains(t, w.Body.String(), "Job not found")
 }
 
@@ -179,6 +360,7 @@ func TestDownloadJobStillProcessing(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/download", nil)
 	c.Params = []gin.Param{{Key: "id", Value: job.ID}}
 
 	handler.DownloadFile(c)
@@ -198,6 +380,7 @@ func TestDownloadJobFailed(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/download", nil)
 	c.Params = []gin.Param{{Key: "id", Value: job.ID}}
 
 	handler.DownloadFile(c)
@@ -205,3 +388,2558 @@ func TestDownloadJobFailed(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Contains(t, w.Body.String(), "Processing failed")
 }
+
+func TestUploadInvalidEmptyRowPolicy(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "test.csv")
+	require.NoError(t, err)
+	part.Write([]byte("name,email\nJohn,john@test.com"))
+	writer.WriteField("empty_rows", "squash")
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.UploadFile(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "empty_rows")
+}
+
+func TestUploadLongRowPolicy(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	upload := func(policy string) *httptest.ResponseRecorder {
+		req := createRequest(t, "test.csv", "name,email\nJohn,john@test.com,extra")
+		req.URL.RawQuery = "long_rows=" + policy
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+		handler.UploadFile(c)
+		return w
+	}
+
+	w := upload("squash")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "long_rows")
+
+	w = upload("TRUNCATE")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	job, _ := handler.jobService.GetJob(response.ID)
+	assert.Equal(t, models.LongRowPolicyTruncate, job.Options.LongRows)
+}
+
+func TestUploadCallbackURL(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+	defer os.RemoveAll(tempDir + "-downloads")
+
+	gin.SetMode(gin.TestMode)
+
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer server.Close()
+
+	upload := func(callbackURL string) *httptest.ResponseRecorder {
+		req := createRequest(t, "test.csv", "name,email\nJohn,john@test.com")
+		req.URL.RawQuery = "callback_url=" + callbackURL
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+		handler.UploadFile(c)
+		return w
+	}
+
+	w := upload("ftp://example.com/hook")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "callback_url")
+
+	// Unless allowed, callbacks can't name the service's own network
+	handler.config.WebhookAllowPrivateCallbacks = false
+	for _, callbackURL := range []string{"http://169.254.169.254/latest/meta-data/", "http://localhost:8080/api/jobs", server.URL} {
+		w = upload(callbackURL)
+		assert.Equal(t, http.StatusBadRequest, w.Code, callbackURL)
+		assert.Contains(t, w.Body.String(), "public address")
+	}
+	handler.config.WebhookAllowPrivateCallbacks = true
+
+	w = upload(server.URL + "/done")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	select {
+	case r := <-received:
+		assert.Equal(t, "/done", r.URL.Path)
+		assert.Equal(t, "job.completed", r.Header.Get(services.WebhookEventHeader))
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	// The attempt shows up in the job's delivery log
+	require.Eventually(t, func() bool {
+		return len(handler.webhookService.Deliveries(response.ID)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = []gin.Param{{Key: "id", Value: response.ID}}
+	handler.GetJobWebhooks(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var deliveries models.WebhookDeliveriesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deliveries))
+	require.Len(t, deliveries.Deliveries, 1)
+	assert.True(t, deliveries.Deliveries[0].Delivered)
+	assert.Equal(t, server.URL+"/done", deliveries.Deliveries[0].URL)
+}
+
+func TestCancelJob(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	cancel := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/api/jobs/"+id, nil)
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+		handler.CancelJob(c)
+		return w
+	}
+
+	job := handler.jobService.CreateJob("test.csv")
+
+	w := cancel(job.ID)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.Job
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.JobStatusCancelled, response.Status)
+
+	assert.Equal(t, http.StatusConflict, cancel(job.ID).Code)
+	assert.Equal(t, http.StatusNotFound, cancel("a225eb00-0907-4273-92ca-5faadeefae5f").Code)
+	assert.Equal(t, http.StatusBadRequest, cancel("nope").Code)
+
+	// Cancelled jobs have nothing to download
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/download", nil)
+	c.Params = []gin.Param{{Key: "id", Value: job.ID}}
+	handler.DownloadFile(c)
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+func TestJobEvents(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	stream := func(jobID, lastEventID string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/jobs/"+jobID+"/events", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+		c.Params = []gin.Param{{Key: "id", Value: jobID}}
+		handler.JobEvents(c)
+
+		// Gin only writes a bare status once the handler chain returns
+		c.Writer.WriteHeaderNow()
+		return w
+	}
+
+	job := handler.jobService.CreateJob("test.csv")
+
+	// Live events are streamed until the job finishes
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- stream(job.ID, "") }()
+
+	require.NoError(t, handler.jobService.UpdateJobStatus(job.ID, models.JobStatusProcessing))
+	require.NoError(t, handler.jobService.UpdateJobProgress(job.ID, models.JobProgress{RowsProcessed: 1000, TotalRows: 3000}))
+	require.NoError(t, handler.jobService.UpdateJobStatus(job.ID, models.JobStatusCompleted))
+
+	var w *httptest.ResponseRecorder
+	select {
+	case w = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not end with the job")
+	}
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	assert.Contains(t, body, "id:1\nevent:status\ndata:")
+	assert.Contains(t, body, "id:3\nevent:progress\ndata:")
+	assert.Contains(t, body, "id:4\nevent:status\ndata:")
+	assert.Contains(t, body, `"rows_processed":1000`)
+	assert.Contains(t, body, `"status":"completed"`)
+
+	// Reconnecting picks up after the last event seen
+	w = stream(job.ID, "3")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "id:3\n")
+	assert.Contains(t, w.Body.String(), "id:4\nevent:status\n")
+
+	// Nothing more will happen once the client has seen the end
+	assert.Equal(t, http.StatusNoContent, stream(job.ID, "4").Code)
+
+	assert.Equal(t, http.StatusBadRequest, stream(job.ID, "abc").Code)
+	assert.Equal(t, http.StatusBadRequest, stream("nope", "").Code)
+	assert.Equal(t, http.StatusNotFound, stream("a225eb00-0907-4273-92ca-5faadeefae5f", "").Code)
+}
+
+func TestJobsWebSocket(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/ws", handler.JobsWebSocket)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	read := func() models.WebSocketMessage {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var message models.WebSocketMessage
+		require.NoError(t, conn.ReadJSON(&message))
+		return message
+	}
+
+	job := handler.jobService.CreateJob("test.csv")
+
+	// Subscribing to a job confirms it and sends the job's current state
+	require.NoError(t, conn.WriteJSON(models.WebSocketRequest{Action: models.WebSocketSubscribe, JobIDs: []string{job.ID}}))
+	message := read()
+	assert.Equal(t, models.WebSocketSubscriptions, message.Type)
+	assert.Equal(t, []string{job.ID}, message.JobIDs)
+	message = read()
+	require.Equal(t, models.WebSocketEvent, message.Type)
+	assert.Equal(t, models.JobStatusPending, message.Event.Job.Status)
+
+	require.NoError(t, handler.jobService.UpdateJobStatus(job.ID, models.JobStatusProcessing))
+	require.NoError(t, handler.jobService.UpdateJobProgress(job.ID, models.JobProgress{RowsProcessed: 1000, TotalRows: 2000}))
+	message = read()
+	assert.Equal(t, models.JobStatusProcessing, message.Event.Job.Status)
+	message = read()
+	assert.Equal(t, models.JobEventProgress, message.Event.Type)
+
+	// Status subscriptions follow every job into and out of the status
+	require.NoError(t, conn.WriteJSON(models.WebSocketRequest{Action: models.WebSocketUnsubscribe, JobIDs: []string{job.ID}}))
+	assert.Empty(t, read().JobIDs)
+	require.NoError(t, conn.WriteJSON(models.WebSocketRequest{Action: models.WebSocketSubscribe, Statuses: []models.JobStatus{models.JobStatusPending}}))
+	message = read()
+	assert.Equal(t, []models.JobStatus{models.JobStatusPending}, message.Statuses)
+
+	other := handler.jobService.CreateJob("other.csv")
+	message = read()
+	assert.Equal(t, other.ID, message.Event.Job.ID)
+	require.NoError(t, handler.jobService.UpdateJobStatus(other.ID, models.JobStatusProcessing))
+	message = read()
+	assert.Equal(t, models.JobStatusProcessing, message.Event.Job.Status)
+	assert.Equal(t, models.JobStatusPending, message.Event.PreviousStatus)
+
+	// The first job is no longer followed
+	require.NoError(t, handler.jobService.UpdateJobStatus(job.ID, models.JobStatusCompleted))
+
+	// Bad requests get an error message and leave the connection open
+	require.NoError(t, conn.WriteJSON(map[string]string{"action": "follow"}))
+	message = read()
+	assert.Equal(t, models.WebSocketError, message.Type)
+	assert.Contains(t, message.Error, "follow")
+
+	require.NoError(t, conn.WriteJSON(models.WebSocketRequest{Action: models.WebSocketSubscribe, JobIDs: []string{"a225eb00-0907-4273-92ca-5faadeefae5f"}}))
+	assert.Equal(t, models.WebSocketSubscriptions, read().Type)
+	message = read()
+	assert.Equal(t, models.WebSocketError, message.Type)
+	assert.Contains(t, message.Error, "not found")
+}
+
+func TestJobsWebSocketBackpressure(t *testing.T) {
+	client := &wsClient{
+		send:     make(chan models.WebSocketMessage, 1),
+		overflow: make(chan struct{}),
+		jobIDs:   map[string]bool{"job-1": true},
+		statuses: make(map[models.JobStatus]bool),
+	}
+
+	progress := models.JobEvent{Type: models.JobEventProgress, Job: models.Job{ID: "job-1", Status: models.JobStatusProcessing}}
+	client.deliver(progress)
+	client.deliver(progress)
+	client.deliver(models.JobEvent{Type: models.JobEventProgress, Job: models.Job{ID: "job-2"}})
+
+	// Progress that doesn't fit is dropped and counted
+	assert.Len(t, client.send, 1)
+	assert.Equal(t, int64(1), client.dropped.Load())
+	select {
+	case <-client.overflow:
+		t.Fatal("dropping progress should not disconnect")
+	default:
+	}
+
+	// A status change that doesn't fit disconnects the client
+	client.deliver(models.JobEvent{Type: models.JobEventStatus, Job: models.Job{ID: "job-1", Status: models.JobStatusCompleted}})
+	select {
+	case <-client.overflow:
+	default:
+		t.Fatal("missing a status change should disconnect")
+	}
+}
+
+func TestJobsWebSocketOwnership(t *testing.T) {
+	client := &wsClient{
+		owner:    "acme",
+		jobIDs:   make(map[string]bool),
+		statuses: map[models.JobStatus]bool{models.JobStatusPending: true},
+	}
+
+	event := func(owner string) models.JobEvent {
+		return models.JobEvent{Type: models.JobEventStatus, Job: models.Job{ID: "job-1", Owner: owner, Status: models.JobStatusPending}}
+	}
+
+	assert.True(t, client.matches(event("acme")))
+	assert.False(t, client.matches(event("globex")))
+
+	client.admin = true
+	assert.True(t, client.matches(event("globex")))
+}
+
+func TestOriginAllowed(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	handler.config.AllowedOrigins = "https://app.example.com, https://ops.example.com"
+	assert.True(t, handler.originAllowed(""))
+	assert.True(t, handler.originAllowed("https://ops.example.com"))
+	assert.False(t, handler.originAllowed("https://evil.example.com"))
+
+	handler.config.AllowedOrigins = "https://*.example.org"
+	assert.True(t, handler.originAllowed("https://app.example.org"))
+	assert.False(t, handler.originAllowed("https://example.org"))
+
+	handler.config.AllowedOrigins = "*"
+	assert.True(t, handler.originAllowed("https://evil.example.com"))
+}
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(allowedOrigins string) *gin.Engine {
+		router := gin.New()
+		router.Use(CORS(allowedOrigins, 10*time.Minute))
+		router.GET("/api/jobs", func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		return router
+	}
+	send := func(router *gin.Engine, method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/jobs", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	router := newRouter("https://app.example.com, https://*.example.org")
+
+	// Allowed origins are echoed back with credentials
+	w := send(router, http.MethodGet, "https://app.example.com")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "Content-Disposition")
+	assert.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+
+	w = send(router, http.MethodGet, "https://eu.example.org")
+	assert.Equal(t, "https://eu.example.org", w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Preflight requests may be cached
+	w = send(router, http.MethodOptions, "https://eu.example.org")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://eu.example.org", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), http.MethodDelete)
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Idempotency-Key")
+
+	// Other origins get no CORS headers, and their preflight is refused
+	w = send(router, http.MethodGet, "https://evil.example.com")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	w = send(router, http.MethodOptions, "https://evil.example.com")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Requests without an Origin aren't cross-origin
+	w = send(router, http.MethodGet, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Any origin may call, but not with credentials
+	w = send(newRouter("*"), http.MethodGet, "https://evil.example.com")
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+// syncBuffer is a bytes.Buffer safe to log to from several goroutines
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRequestID(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	var logs syncBuffer
+	require.NoError(t, logger.SetFormat(logger.FormatLogfmt, &logs))
+	defer logger.SetFormat(logger.FormatText, os.Stdout)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), AccessLog())
+	router.POST("/api/upload", handler.UploadFile)
+
+	// IDs sent by clients are kept and carried into the job's log lines
+	req := createRequest(t, "test.csv", "name,email\nJohn,john@example.com\n")
+	req.Header.Set("X-Request-ID", "req-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "req-42", w.Header().Get("X-Request-ID"))
+
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	assert.Contains(t, logs.String(), `msg="Handled request" request_id=req-42 method=POST path=/api/upload status=200`)
+	require.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), `msg="Successfully processed file" request_id=req-42 job_id=`+response.ID)
+	}, time.Second, 5*time.Millisecond)
+
+	// Others get a fresh ID
+	for _, id := range []string{"", "bad id", strings.Repeat("a", 129)} {
+		req = createRequest(t, "test.csv", "name\nJohn\n")
+		if id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		generated := w.Header().Get("X-Request-ID")
+		assert.NotEqual(t, id, generated)
+		assert.Len(t, generated, 36)
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/health", handler.Health)
+	router.GET("/livez", handler.Livez)
+	router.GET("/readyz", handler.Readyz)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"healthy"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var readiness models.ReadinessResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.Equal(t, models.ReadinessReady, readiness.Status)
+	for _, name := range []string{"upload_dir", "download_dir", "job_store", "job_queue"} {
+		assert.Equal(t, models.CheckPass, readiness.Checks[name].Status, name)
+	}
+
+	// A full queue takes the service out of rotation but leaves it alive
+	for i := 0; i < 10; i++ {
+		handler.jobService.CreateJob(fmt.Sprintf("queued-%d.csv", i))
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.Equal(t, models.ReadinessNotReady, readiness.Status)
+	assert.Equal(t, models.CheckFail, readiness.Checks["job_queue"].Status)
+	assert.Equal(t, int64(10), readiness.Checks["job_queue"].Details["active_jobs"])
+	assert.Equal(t, models.CheckPass, readiness.Checks["upload_dir"].Status)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMetrics(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Metrics())
+	router.POST("/api/upload", handler.UploadFile)
+	router.GET("/api/jobs/:id", handler.GetJob)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	requests := func(method, route, status string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(method, route, status))
+	}
+	uploads := sampleCount(t, metrics.UploadSize.WithLabelValues("multipart"))
+	found := requests(http.MethodGet, "/api/jobs/:id", "404")
+	unmatched := requests(http.MethodGet, "unmatched", "404")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, createRequest(t, "test.csv", "name,email\nJohn,john@example.com\n"))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Requests are counted by route, not path
+	for _, path := range []string{"/api/jobs/a225eb00-0907-4273-92ca-5faadeefae5f", "/api/jobs/4c6d31a2-8f0e-4d3c-9d1c-7a2b1a1c0e55", "/nope"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(t, found+2, requests(http.MethodGet, "/api/jobs/:id", "404"))
+	assert.Equal(t, unmatched+1, requests(http.MethodGet, "unmatched", "404"))
+	assert.Greater(t, requests(http.MethodPost, "/api/upload", "200"), float64(0))
+	assert.Equal(t, uploads+1, sampleCount(t, metrics.UploadSize.WithLabelValues("multipart")))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `csv_validator_http_requests_total{method="POST",route="/api/upload",status="200"}`)
+	assert.Contains(t, w.Body.String(), `csv_validator_upload_size_bytes_bucket{type="multipart"`)
+}
+
+func TestTracing(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Tracing())
+	router.POST("/api/upload", handler.UploadFile)
+
+	// The trace of the caller is continued
+	req := createRequest(t, "test.csv", "name,email\nJohn,john@example.com\n")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	byName := func() map[string]sdktrace.ReadOnlySpan {
+		spans := make(map[string]sdktrace.ReadOnlySpan)
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = span
+		}
+		return spans
+	}
+	require.Eventually(t, func() bool {
+		_, processed := byName()["CSVService.ProcessFile"]
+		return processed
+	}, time.Second, 5*time.Millisecond)
+
+	spans := byName()
+	for _, name := range []string{"POST /api/upload", "Handler.UploadFile", "FileService.SaveFile", "CSVService.ProcessFile", "read", "validate", "write"} {
+		require.Contains(t, spans, name)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[name].SpanContext().TraceID().String(), name)
+	}
+
+	server := spans["POST /api/upload"]
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Contains(t, server.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+
+	// Processing carries on the trace of the upload that started it
+	upload := spans["Handler.UploadFile"]
+	assert.Equal(t, server.SpanContext().SpanID(), upload.Parent().SpanID())
+	assert.Equal(t, upload.SpanContext().SpanID(), spans["FileService.SaveFile"].Parent().SpanID())
+	assert.Equal(t, upload.SpanContext().SpanID(), spans["CSVService.ProcessFile"].Parent().SpanID())
+	for _, stage := range []string{"read", "validate", "write"} {
+		assert.Equal(t, spans["CSVService.ProcessFile"].SpanContext().SpanID(), spans[stage].Parent().SpanID(), stage)
+	}
+}
+
+// sampleCount returns how many observations a histogram holds
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var metric dto.Metric
+	require.NoError(t, observer.(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestGetJobWebhooksNotFound(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = []gin.Param{{Key: "id", Value: "a225eb00-0907-4273-92ca-5faadeefae5f"}}
+
+	handler.GetJobWebhooks(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetJob(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	job := handler.jobService.CreateJob("test.csv")
+	handler.jobService.UpdateJobSummary(job.ID, models.JobSummary{TotalRows: 4, EmptyRows: 1})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = []gin.Param{{Key: "id", Value: job.ID}}
+
+	handler.GetJob(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.Job
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, response.ID)
+	require.NotNil(t, response.Summary)
+	assert.Equal(t, 1, response.Summary.EmptyRows)
+}
+
+func TestGetJobNotFound(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = []gin.Param{{Key: "id", Value: "a225eb00-0907-4273-92ca-5faadeefae5f"}}
+
+	handler.GetJob(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestValidateCSVBody(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	req, _ := http.NewRequest("POST", "/api/validate", strings.NewReader("name,email\nJohn,john@test.com\nJane,nope"))
+	req.Header.Set("Content-Type", "text/csv")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.Validate(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, "name,email,has_email\nJohn,john@test.com,true\nJane,nope,false\n", w.Body.String())
+}
+
+func TestValidateJSONBody(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	body := `[["name","email"],["John","john@test.com"],["",""]]`
+	req, _ := http.NewRequest("POST", "/api/validate?empty_rows=drop", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.Validate(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ValidateResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"name", "email", "has_email"}, {"John", "john@test.com", "true"}}, response.Rows)
+	assert.Equal(t, 1, response.Summary.EmptyRows)
+}
+
+func TestValidatePayloadTooLarge(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	largeData := "name,email\n" + strings.Repeat("John,john@test.com\n", 100)
+	req, _ := http.NewRequest("POST", "/api/validate", strings.NewReader(largeData))
+	req.Header.Set("Content-Type", "text/csv")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.Validate(c)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestValidateEmptyBody(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	req, _ := http.NewRequest("POST", "/api/validate", strings.NewReader(""))
+	req.Header.Set("Content-Type", "text/csv")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.Validate(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "empty")
+}
+
+func TestValidateEmailsSingle(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	req, _ := http.NewRequest("POST", "/api/emails/validate", strings.NewReader(`{"email":" John@Test.COM "}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.ValidateEmails(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.EmailValidationResult
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	assert.True(t, response.Valid)
+	assert.True(t, response.Strict)
+	assert.Equal(t, "John@test.com", response.Normalized)
+}
+
+func TestValidateEmailsBatch(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	req, _ := http.NewRequest("POST", "/api/emails/validate", strings.NewReader(`{"emails":["john@test.com","not-an-email","a..b@test.com"]}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.ValidateEmails(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.EmailValidationResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Len(t, response.Results, 3)
+	assert.True(t, response.Results[0].Valid)
+	assert.False(t, response.Results[1].Valid)
+	assert.Equal(t, "invalid_format", response.Results[1].Reason)
+	assert.True(t, response.Results[2].Valid)
+	assert.False(t, response.Results[2].Strict)
+	assert.Equal(t, "consecutive_dots", response.Results[2].Reason)
+}
+
+func TestValidateEmailsBatchTooLarge(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	req, _ := http.NewRequest("POST", "/api/emails/validate", strings.NewReader(`{"emails":["a@test.com","b@test.com","c@test.com","d@test.com"]}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.ValidateEmails(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Too many addresses")
+}
+
+func createCompletedJob(t *testing.T, handler *Handler, tempDir string) string {
+	processedFile := filepath.Join(tempDir, "processed_test.csv")
+	err := os.WriteFile(processedFile, []byte("name,email,has_email\nJohn,john@test.com,true\n"), 0644)
+	require.NoError(t, err)
+
+	job := handler.jobService.CreateJob("test.csv")
+	handler.jobService.UpdateJobProcessedFile(job.ID, processedFile)
+	handler.jobService.UpdateJobStatus(job.ID, models.JobStatusCompleted)
+
+	return job.ID
+}
+
+func TestDownloadFormats(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	jobID := createCompletedJob(t, handler, tempDir)
+
+	tests := []struct {
+		name        string
+		query       string
+		accept      string
+		contentType string
+		body        string
+		filename    string
+	}{
+		{
+			name:        "Default CSV",
+			contentType: "text/csv",
+			body:        "name,email,has_email\nJohn,john@test.com,true\n",
+			filename:    "processed_test.csv",
+		},
+		{
+			name:        "JSON via query",
+			query:       "?format=json",
+			contentType: "application/json",
+			body:        `[{"name":"John","email":"john@test.com","has_email":"true"}]`,
+			filename:    "processed_test.json",
+		},
+		{
+			name:        "NDJSON via Accept",
+			accept:      "application/x-ndjson",
+			contentType: "application/x-ndjson",
+			body:        `{"name":"John","email":"john@test.com","has_email":"true"}` + "\n",
+			filename:    "processed_test.ndjson",
+		},
+		{
+			name:        "Query wins over Accept",
+			query:       "?format=csv",
+			accept:      "application/json",
+			contentType: "text/csv",
+			filename:    "processed_test.csv",
+		},
+		{
+			name:        "XLSX",
+			query:       "?format=xlsx",
+			contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			filename:    "processed_test.xlsx",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/api/download/"+jobID+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "id", Value: jobID}}
+
+			handler.DownloadFile(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Header().Get("Content-Disposition"), tt.filename)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDownloadInvalidFormat(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	jobID := createCompletedJob(t, handler, tempDir)
+
+	req, _ := http.NewRequest("GET", "/api/download/"+jobID+"?format=pdf", nil)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Params = []gin.Param{{Key: "id", Value: jobID}}
+
+	handler.DownloadFile(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func createZip(t *testing.T, files map[string]string) string {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.String()
+}
+
+func TestUploadZipArchive(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	archive := createZip(t, map[string]string{
+		"first.csv":  "name,email\nChirag,Chirag@test.com",
+		"second.csv": "name,email\nYash,none",
+		"readme.txt": "not a csv",
+	})
+	req := createRequest(t, "exports.zip", archive)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.UploadFile(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UploadResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	assert.Empty(t, response.ID)
+	assert.NotEmpty(t, response.BatchID)
+	assert.Len(t, response.JobIDs, 2)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Params = []gin.Param{{Key: "id", Value: response.BatchID}}
+
+	handler.GetBatch(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var batch models.BatchResponse
+	err = json.Unmarshal(w.Body.Bytes(), &batch)
+	require.NoError(t, err)
+	assert.Equal(t, response.BatchID, batch.BatchID)
+	require.Len(t, batch.Jobs, 2)
+	for i, job := range batch.Jobs {
+		assert.Equal(t, response.JobIDs[i], job.ID)
+		assert.Equal(t, response.BatchID, job.BatchID)
+	}
+}
+
+func TestUploadGzipBomb(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+	handler.config.MaxCompressionRatio = 10
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(make([]byte, 4*1024*1024))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	req := createRequest(t, "bomb.csv.gz", buf.String())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.UploadFile(c)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestGetBatchNotFound(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = []gin.Param{{Key: "id", Value: "a225eb00-0907-4273-92ca-5faadeefae5f"}}
+
+	handler.GetBatch(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDownloadCompressed(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	jobID := createCompletedJob(t, handler, tempDir)
+	expected := "name,email,has_email\nJohn,john@test.com,true\n"
+
+	tests := []struct {
+		name            string
+		query           string
+		acceptEncoding  string
+		contentType     string
+		contentEncoding string
+		filename        string
+	}{
+		{"accept gzip", "", "gzip, deflate", "text/csv", "gzip", "processed_test.csv"},
+		{"accept zstd", "", "zstd", "text/csv", "zstd", "processed_test.csv"},
+		{"no encoding", "", "", "text/csv", "", "processed_test.csv"},
+		{"explicit gzip", "?compress=gzip", "", "application/gzip", "", "processed_test.csv.gz"},
+		{"explicit gzip json", "?compress=gzip&format=ndjson", "", "application/gzip", "", "processed_test.ndjson.gz"},
+		{"explicit none wins", "?compress=none", "gzip", "text/csv", "", "processed_test.csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/api/download/"+jobID+tt.query, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "id", Value: jobID}}
+
+			handler.DownloadFile(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.contentEncoding, w.Header().Get("Content-Encoding"))
+			assert.Contains(t, w.Header().Get("Content-Disposition"), "filename="+tt.filename)
+
+			var body []byte
+			switch {
+			case tt.contentEncoding == "zstd":
+				decoder, err := zstd.NewReader(w.Body)
+				require.NoError(t, err)
+				body, err = io.ReadAll(decoder)
+				require.NoError(t, err)
+				decoder.Close()
+			case tt.contentEncoding == "gzip" || tt.contentType == "application/gzip":
+				gz, err := gzip.NewReader(w.Body)
+				require.NoError(t, err)
+				body, err = io.ReadAll(gz)
+				require.NoError(t, err)
+			default:
+				body = w.Body.Bytes()
+			}
+
+			if strings.Contains(tt.query, "ndjson") {
+				assert.Equal(t, "{\"name\":\"John\",\"email\":\"john@test.com\",\"has_email\":\"true\"}\n", string(body))
+			} else {
+				assert.Equal(t, expected, string(body))
+			}
+		})
+	}
+}
+
+func TestDownloadStoredCompressed(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	content := "name,email,has_email\nJohn,john@test.com,true\n"
+	processedFile := filepath.Join(tempDir, "processed_test.csv.gz")
+	file, err := os.Create(processedFile)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	gz.Write([]byte(content))
+	require.NoError(t, gz.Close())
+	require.NoError(t, file.Close())
+
+	job := handler.jobService.CreateJob("test.csv")
+	handler.jobService.UpdateJobProcessedFile(job.ID, processedFile)
+	handler.jobService.UpdateJobStatus(job.ID, models.JobStatusCompleted)
+
+	// Clients that can't take gzip get the file decompressed on the fly
+	req, _ := http.NewRequest("GET", "/api/download/"+job.ID, nil)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Params = []gin.Param{{Key: "id", Value: job.ID}}
+
+	handler.DownloadFile(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, content, w.Body.String())
+
+	// Clients that can are sent the stored bytes as they are
+	req, _ = http.NewRequest("GET", "/api/download/"+job.ID, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = req
+	c.Params = []gin.Param{{Key: "id", Value: job.ID}}
+
+	handler.DownloadFile(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	stored, err := os.ReadFile(processedFile)
+	require.NoError(t, err)
+	assert.Equal(t, stored, w.Body.Bytes())
+}
+
+func TestDownloadInvalidCompress(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	jobID := createCompletedJob(t, handler, tempDir)
+
+	req, _ := http.NewRequest("GET", "/api/download/"+jobID+"?compress=rar", nil)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Params = []gin.Param{{Key: "id", Value: jobID}}
+
+	handler.DownloadFile(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func uploadRequest(t *testing.T, handler *Handler, method, path string, body io.Reader, headers map[string]string, params ...gin.Param) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, body)
+	require.NoError(t, err)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Params = params
+
+	switch {
+	case method == http.MethodPost && len(params) == 0:
+		handler.CreateUpload(c)
+	case method == http.MethodPost:
+		handler.CompleteUpload(c)
+	case method == http.MethodPatch:
+		handler.PatchUpload(c)
+	case method == http.MethodDelete:
+		handler.DeleteUpload(c)
+	default:
+		handler.GetUpload(c)
+	}
+
+	// Gin only writes a bare status once the handler chain returns
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+func TestResumableUpload(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	content := "name,email\nChirag,Chirag@test.com\nYash,none\n"
+	jsonHeaders := map[string]string{"Content-Type": "application/json"}
+
+	w := uploadRequest(t, handler, http.MethodPost, "/api/uploads",
+		strings.NewReader(fmt.Sprintf(`{"filename":"big.csv","size":%d,"empty_rows":"drop"}`, len(content))), jsonHeaders)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var upload models.Upload
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &upload))
+	assert.Equal(t, "/api/uploads/"+upload.ID, w.Header().Get("Location"))
+	id := gin.Param{Key: "id", Value: upload.ID}
+
+	// First chunk
+	w = uploadRequest(t, handler, http.MethodPatch, "/api/uploads/"+upload.ID, strings.NewReader(content[:20]),
+		map[string]string{"Upload-Offset": "0"}, id)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "20", w.Header().Get("Upload-Offset"))
+
+	// A retried first chunk is refused with the current offset
+	w = uploadRequest(t, handler, http.MethodPatch, "/api/uploads/"+upload.ID, strings.NewReader(content[:20]),
+		map[string]string{"Upload-Offset": "0"}, id)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "20", w.Header().Get("Upload-Offset"))
+
+	// Completing early is refused
+	w = uploadRequest(t, handler, http.MethodPost, "/api/uploads/"+upload.ID+"/complete", nil, nil, id)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Last chunk with a bad checksum, then a good one
+	w = uploadRequest(t, handler, http.MethodPatch, "/api/uploads/"+upload.ID, strings.NewReader(content[20:]),
+		map[string]string{"Upload-Offset": "20", "Upload-Checksum": "sha256 " + base64.StdEncoding.EncodeToString(make([]byte, 32))}, id)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	sum := sha256.Sum256([]byte(content[20:]))
+	w = uploadRequest(t, handler, http.MethodPatch, "/api/uploads/"+upload.ID, strings.NewReader(content[20:]),
+		map[string]string{"Upload-Offset": "20", "Upload-Checksum": "sha256 " + base64.StdEncoding.EncodeToString(sum[:])}, id)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = uploadRequest(t, handler, http.MethodGet, "/api/uploads/"+upload.ID, nil, nil, id)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, fmt.Sprint(len(content)), w.Header().Get("Upload-Offset"))
+
+	// Only now is a job created
+	w = uploadRequest(t, handler, http.MethodPost, "/api/uploads/"+upload.ID+"/complete", nil, nil, id)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	job, exists := handler.jobService.GetJob(response.ID)
+	require.True(t, exists)
+	assert.Equal(t, models.EmptyRowPolicyDrop, job.Options.EmptyRows)
+
+	saved, err := os.ReadFile(job.OriginalFile)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(saved))
+
+	w = uploadRequest(t, handler, http.MethodGet, "/api/uploads/"+upload.ID, nil, nil, id)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestResumableUploadOverQuota(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	limit := func(jobs int64) {
+		tenantService, err := services.NewTenantService(models.TenantLimits{MaxConcurrentJobs: jobs}, nil, handler.jobService, handler.fileService)
+		require.NoError(t, err)
+		handler.tenantService = tenantService
+	}
+	limit(1)
+
+	archive := createZip(t, map[string]string{
+		"a.csv": "name,email\nChirag,chirag@example.com\n",
+		"b.csv": "name,email\nYash,yash@example.com\n",
+	})
+	w := uploadRequest(t, handler, http.MethodPost, "/api/uploads",
+		strings.NewReader(fmt.Sprintf(`{"filename":"batch.zip","size":%d}`, len(archive))), map[string]string{"Content-Type": "application/json"})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var upload models.Upload
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &upload))
+	id := gin.Param{Key: "id", Value: upload.ID}
+
+	w = uploadRequest(t, handler, http.MethodPatch, "/api/uploads/"+upload.ID, strings.NewReader(archive),
+		map[string]string{"Upload-Offset": "0"}, id)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// The archive holds more jobs than may run, and the upload is kept for a retry
+	w = uploadRequest(t, handler, http.MethodPost, "/api/uploads/"+upload.ID+"/complete", nil, nil, id)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Empty(t, handler.jobService.ListJobs())
+
+	w = uploadRequest(t, handler, http.MethodGet, "/api/uploads/"+upload.ID, nil, nil, id)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, fmt.Sprint(len(archive)), w.Header().Get("Upload-Offset"))
+
+	limit(2)
+	w = uploadRequest(t, handler, http.MethodPost, "/api/uploads/"+upload.ID+"/complete", nil, nil, id)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.JobIDs, 2)
+
+	w = uploadRequest(t, handler, http.MethodGet, "/api/uploads/"+upload.ID, nil, nil, id)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCreateUploadValidation(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"not json", "filename=big.csv", http.StatusBadRequest},
+		{"bad extension", `{"filename":"big.exe","size":10}`, http.StatusBadRequest},
+		{"no size", `{"filename":"big.csv"}`, http.StatusBadRequest},
+		{"too big", `{"filename":"big.csv","size":2097152}`, http.StatusRequestEntityTooLarge},
+		{"bad options", `{"filename":"big.csv","size":10,"empty_rows":"squash"}`, http.StatusBadRequest},
+		{"ok", `{"filename":"big.csv.gz","size":10}`, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := uploadRequest(t, handler, http.MethodPost, "/api/uploads", strings.NewReader(tt.body),
+				map[string]string{"Content-Type": "application/json"})
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestDeleteUpload(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	upload, err := handler.uploadService.CreateUpload(models.Identity{}, "big.csv", 10, models.ProcessingOptions{})
+	require.NoError(t, err)
+	id := gin.Param{Key: "id", Value: upload.ID}
+
+	w := uploadRequest(t, handler, http.MethodDelete, "/api/uploads/"+upload.ID, nil, nil, id)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = uploadRequest(t, handler, http.MethodPatch, "/api/uploads/"+upload.ID, strings.NewReader("abc"),
+		map[string]string{"Upload-Offset": "0"}, id)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func streamRequest(t *testing.T, handler *Handler, target, contentType string, body io.Reader) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(http.MethodPut, target, body)
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+
+	handler.StreamUpload(c)
+	return w
+}
+
+func TestStreamUpload(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	content := "name,email\nChirag,Chirag@test.com\n"
+	w := streamRequest(t, handler, "/api/upload?filename=contacts.csv&empty_rows=drop", "text/csv", strings.NewReader(content))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	sum := sha256.Sum256([]byte(content))
+	assert.Equal(t, hex.EncodeToString(sum[:]), response.SHA256)
+	assert.Equal(t, int64(len(content)), response.Size)
+
+	job, exists := handler.jobService.GetJob(response.ID)
+	require.True(t, exists)
+	assert.Equal(t, models.EmptyRowPolicyDrop, job.Options.EmptyRows)
+	assert.Equal(t, "contacts.csv", job.Filename)
+	assert.Equal(t, response.SHA256, job.SHA256)
+
+	saved, err := os.ReadFile(job.OriginalFile)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(saved))
+}
+
+func TestStreamUploadCompressed(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	content := "name,email\nChirag,Chirag@test.com\n"
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(content))
+	require.NoError(t, gz.Close())
+
+	// The file name comes from the content type
+	w := streamRequest(t, handler, "/api/upload", "application/gzip", bytes.NewReader(buf.Bytes()))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	// The response describes the decompressed file, as for multipart uploads
+	sum := sha256.Sum256([]byte(content))
+	assert.Equal(t, int64(len(content)), response.Size)
+	assert.Equal(t, hex.EncodeToString(sum[:]), response.SHA256)
+
+	req := createRequest(t, "test.csv.gz", buf.String())
+	mw := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(mw)
+	c.Request = req
+	handler.UploadFile(c)
+	require.Equal(t, http.StatusOK, mw.Code)
+	var multipart models.UploadResponse
+	require.NoError(t, json.Unmarshal(mw.Body.Bytes(), &multipart))
+	assert.Equal(t, multipart.SHA256, response.SHA256)
+
+	job, _ := handler.jobService.GetJob(response.ID)
+	saved, err := os.ReadFile(job.OriginalFile)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(saved))
+}
+
+func TestStreamUploadZip(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	archive := createZip(t, map[string]string{
+		"first.csv":  "name,email\nChirag,Chirag@test.com",
+		"second.csv": "name,email\nYash,none",
+	})
+
+	w := streamRequest(t, handler, "/api/upload?filename=exports.zip", "application/octet-stream", strings.NewReader(archive))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.BatchID)
+	assert.Len(t, response.JobIDs, 2)
+	assert.NotEmpty(t, response.SHA256)
+}
+
+func TestSlowUploadBody(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/api/upload", handler.StreamUpload)
+	router.PATCH("/api/uploads/:id", handler.PatchUpload)
+
+	// Bodies take longer than the server's timeouts allow for a whole request
+	server := httptest.NewUnstartedServer(router)
+	server.Config.ReadTimeout = 50 * time.Millisecond
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	content := "name,email\nChirag,Chirag@test.com\nYash,yash@test.com\n"
+	send := func(method, target string, headers map[string]string) *http.Response {
+		body, writer := io.Pipe()
+		go func() {
+			for _, line := range strings.SplitAfter(content, "\n") {
+				time.Sleep(40 * time.Millisecond)
+				writer.Write([]byte(line))
+			}
+			writer.Close()
+		}()
+
+		req, err := http.NewRequest(method, server.URL+target, body)
+		require.NoError(t, err)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := send(http.MethodPut, "/api/upload?filename=slow.csv", map[string]string{"Content-Type": "text/csv"})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	upload, err := handler.uploadService.CreateUpload(models.Identity{}, "slow.csv", int64(len(content)), models.ProcessingOptions{})
+	require.NoError(t, err)
+	resp = send(http.MethodPatch, "/api/uploads/"+upload.ID, map[string]string{"Upload-Offset": "0"})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fmt.Sprint(len(content)), resp.Header.Get("Upload-Offset"))
+}
+
+func TestStreamUploadRejected(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        io.Reader
+		status      int
+	}{
+		{"multipart", "/api/upload", "multipart/form-data; boundary=x", strings.NewReader("x"), http.StatusUnsupportedMediaType},
+		{"bad extension", "/api/upload?filename=run.exe", "application/octet-stream", strings.NewReader("x"), http.StatusBadRequest},
+		{"empty", "/api/upload", "text/csv", strings.NewReader(""), http.StatusBadRequest},
+		{"binary as csv", "/api/upload", "text/csv", bytes.NewReader([]byte{0, 1, 2, 3}), http.StatusBadRequest},
+		{"fake workbook", "/api/upload?filename=book.xlsx", "application/octet-stream", strings.NewReader("name,email\n"), http.StatusBadRequest},
+		// io.MultiReader hides the length, so the limit is only hit while streaming
+		{"too big", "/api/upload", "text/csv", io.MultiReader(strings.NewReader(strings.Repeat("a,b\n", 300*1024))), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := streamRequest(t, handler, tt.target, tt.contentType, tt.body)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	// Rejected bodies leave no files behind
+	matches, _ := filepath.Glob(filepath.Join(tempDir, "*_upload.csv"))
+	assert.Empty(t, matches)
+
+	// The limit applies to the compressed bytes and survives the decompressor
+	noise := make([]byte, 1100*1024)
+	rand.Read(noise)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(noise)
+	require.NoError(t, gz.Close())
+
+	w := streamRequest(t, handler, "/api/upload", "application/gzip", io.MultiReader(&buf))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+// authRouter serves the job endpoints behind API key authentication, with a
+// regular key for each of acme and globex and an admin key for ops
+func authRouter(t *testing.T, handler *Handler) *gin.Engine {
+	store, err := services.NewMemoryAPIKeyStore([]models.APIKey{
+		{ID: "acme", SHA256: services.HashAPIKey("acme-key")},
+		{ID: "globex", SHA256: services.HashAPIKey("globex-key")},
+		{ID: "ops", SHA256: services.HashAPIKey("ops-key"), Scopes: []string{models.RoleAdmin}},
+	})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api", RequireAuth(services.NewAuthService(store, nil)))
+	api.POST("/upload", handler.UploadFile)
+	api.GET("/download/:id", handler.DownloadFile)
+	api.GET("/jobs", handler.ListJobs)
+	api.GET("/jobs/:id", handler.GetJob)
+	api.DELETE("/jobs/:id", handler.CancelJob)
+	api.GET("/jobs/:id/events", handler.JobEvents)
+	api.GET("/jobs/:id/webhooks", handler.GetJobWebhooks)
+	api.GET("/batches/:id", handler.GetBatch)
+	api.GET("/uploads/:id", handler.GetUpload)
+	api.DELETE("/uploads/:id", handler.DeleteUpload)
+	return router
+}
+
+func authRequest(router *gin.Engine, method, target, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+	router := authRouter(t, handler)
+
+	job := handler.jobService.CreateJobWithOptions(models.Identity{Tenant: "acme"}, "test.csv", models.ProcessingOptions{})
+
+	w := authRequest(router, http.MethodGet, "/api/jobs/"+job.ID, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+
+	w = authRequest(router, http.MethodGet, "/api/jobs/"+job.ID, "wrong-key")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = authRequest(router, http.MethodGet, "/api/jobs/"+job.ID, "acme-key")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// X-API-Key works as well as a bearer token
+	req := httptest.NewRequest(http.MethodGet, "/api/jobs/"+job.ID, nil)
+	req.Header.Set("X-API-Key", "acme-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Uploads belong to the key that made them
+	req = createRequest(t, "test.csv", "name,email\nChirag,chirag@example.com\n")
+	req.Header.Set("Authorization", "Bearer globex-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	uploaded, _ := handler.jobService.GetJob(response.ID)
+	assert.Equal(t, "globex", uploaded.Owner)
+}
+
+func TestJobOwnership(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+	router := authRouter(t, handler)
+
+	mine := handler.jobService.CreateJobWithOptions(models.Identity{Tenant: "acme"}, "mine.csv", models.ProcessingOptions{})
+	theirs := handler.jobService.CreateJobWithOptions(models.Identity{Tenant: "globex"}, "theirs.csv", models.ProcessingOptions{})
+	batch := handler.jobService.CreateBatch(models.Identity{Tenant: "globex"}, "a225eb00-0907-4273-92ca-5faadeefae5f", []string{"a.csv"}, models.ProcessingOptions{})
+	upload, err := handler.uploadService.CreateUpload(models.Identity{Tenant: "globex"}, "big.csv", 10, models.ProcessingOptions{})
+	require.NoError(t, err)
+
+	// Everything of another key looks like it doesn't exist
+	for _, target := range []string{
+		"/api/jobs/" + theirs.ID,
+		"/api/download/" + theirs.ID,
+		"/api/jobs/" + theirs.ID + "/events",
+		"/api/jobs/" + theirs.ID + "/webhooks",
+		"/api/batches/" + batch[0].BatchID,
+		"/api/uploads/" + upload.ID,
+	} {
+		w := authRequest(router, http.MethodGet, target, "acme-key")
+		assert.Equal(t, http.StatusNotFound, w.Code, target)
+	}
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodDelete, "/api/jobs/"+theirs.ID, "acme-key").Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodDelete, "/api/uploads/"+upload.ID, "acme-key").Code)
+
+	stored, _ := handler.jobService.GetJob(theirs.ID)
+	assert.Equal(t, models.JobStatusPending, stored.Status)
+
+	// The owner and admins see it
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, "/api/jobs/"+theirs.ID, "globex-key").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, "/api/uploads/"+upload.ID, "globex-key").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, "/api/jobs/"+theirs.ID, "ops-key").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodDelete, "/api/jobs/"+mine.ID, "ops-key").Code)
+
+	list := func(target, key string) []string {
+		w := authRequest(router, http.MethodGet, target, key)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response models.JobListResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		ids := []string{}
+		for _, job := range response.Jobs {
+			ids = append(ids, job.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{mine.ID}, list("/api/jobs", "acme-key"))
+	assert.ElementsMatch(t, []string{theirs.ID, batch[0].ID}, list("/api/jobs", "globex-key"))
+	assert.Len(t, list("/api/jobs", "ops-key"), 3)
+	assert.ElementsMatch(t, []string{theirs.ID, batch[0].ID}, list("/api/jobs?owner=globex", "ops-key"))
+	assert.Equal(t, []string{mine.ID}, list("/api/jobs?status=cancelled", "ops-key"))
+	assert.Empty(t, list("/api/jobs?status=cancelled", "globex-key"))
+
+	// Only admins list across keys
+	assert.Equal(t, http.StatusForbidden, authRequest(router, http.MethodGet, "/api/jobs?owner=globex", "acme-key").Code)
+	assert.Equal(t, http.StatusBadRequest, authRequest(router, http.MethodGet, "/api/jobs?status=done", "acme-key").Code)
+}
+
+func TestIdempotencyKeyPerAPIKey(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+	router := authRouter(t, handler)
+
+	upload := func(key string) string {
+		req := createRequest(t, "test.csv", "name,email\nChirag,chirag@example.com\n")
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Idempotency-Key", "order-42")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.UploadResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.ID
+	}
+
+	first := upload("acme-key")
+	assert.Equal(t, first, upload("acme-key"))
+
+	// Another key using the same Idempotency-Key gets its own job
+	assert.NotEqual(t, first, upload("globex-key"))
+}
+
+func TestBearerTokenAuth(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "EC", "kid": "key-1", "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(signingKey.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(signingKey.Y.FillBytes(make([]byte, 32))),
+	}}})
+	require.NoError(t, err)
+	jwksFile := filepath.Join(tempDir, "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, jwks, 0600))
+
+	verifier, err := services.NewJWTVerifier(services.JWTConfig{
+		JWKSFile:    jwksFile,
+		TenantClaim: "tenant",
+		RolesClaim:  "roles",
+		AdminRole:   "admin",
+	})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api", RequireAuth(services.NewAuthService(nil, verifier)))
+	api.POST("/upload", handler.UploadFile)
+	api.GET("/jobs/:id", handler.GetJob)
+
+	token := func(tenant, subject string) string {
+		unsigned := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"sub":    subject,
+			"tenant": tenant,
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		})
+		unsigned.Header["kid"] = "key-1"
+		signed, err := unsigned.SignedString(signingKey)
+		require.NoError(t, err)
+		return signed
+	}
+
+	// Jobs record the tenant and subject of the token that created them
+	req := createRequest(t, "test.csv", "name,email\nChirag,chirag@example.com\n")
+	req.Header.Set("Authorization", "Bearer "+token("acme", "alice"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	job, _ := handler.jobService.GetJob(response.ID)
+	assert.Equal(t, "acme", job.Owner)
+	assert.Equal(t, "alice", job.CreatedBy)
+
+	// Anyone of the same tenant sees it, other tenants don't
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, "/api/jobs/"+job.ID, token("acme", "bob")).Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodGet, "/api/jobs/"+job.ID, token("globex", "carol")).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, authRequest(router, http.MethodGet, "/api/jobs/"+job.ID, token("acme", "alice")[1:]).Code)
+	assert.Equal(t, http.StatusUnauthorized, authRequest(router, http.MethodGet, "/api/jobs/"+job.ID, "").Code)
+}
+
+func TestTenantQuotas(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+	router := authRouter(t, handler)
+
+	tenantService, err := services.NewTenantService(models.TenantLimits{}, []models.Tenant{
+		{ID: "acme", TenantLimits: models.TenantLimits{MaxFileSize: 64, MaxConcurrentJobs: 1}},
+	}, handler.jobService, handler.fileService)
+	require.NoError(t, err)
+	handler.tenantService = tenantService
+
+	upload := func(key, content string) *httptest.ResponseRecorder {
+		req := createRequest(t, "test.csv", content)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	quota := func(w *httptest.ResponseRecorder) models.QuotaErrorResponse {
+		var response models.QuotaErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	big := "name,email\n" + strings.Repeat("Chirag,chirag@example.com\n", 4)
+	w := upload("acme-key", big)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, models.QuotaErrorResponse{
+		Error: "File exceeds the limit of 64 bytes for your tenant",
+		Quota: services.QuotaFileSize,
+		Limit: 64,
+	}, quota(w))
+
+	// Other tenants keep the default limits
+	assert.Equal(t, http.StatusOK, upload("globex-key", big).Code)
+
+	// Files of a tenant are stored below its own directories
+	w = upload("acme-key", "name,email\nChirag,chirag@example.com\n")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response models.UploadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	require.Eventually(t, func() bool {
+		job, _ := handler.jobService.GetJob(response.ID)
+		return job.Status == models.JobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	job, _ := handler.jobService.GetJob(response.ID)
+	assert.True(t, strings.HasPrefix(job.OriginalFile, filepath.Join(tempDir, "tenants", "acme")))
+	assert.True(t, strings.HasPrefix(job.ProcessedFile, filepath.Join(tempDir+"-downloads", "tenants", "acme")))
+
+	// A job still in progress takes acme's only slot
+	handler.jobService.CreateJobWithOptions(models.Identity{Tenant: "acme"}, "queued.csv", models.ProcessingOptions{})
+	w = upload("acme-key", "name,email\nChirag,chirag@example.com\n")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, services.QuotaConcurrentJobs, quota(w).Quota)
+	assert.Len(t, handler.jobService.ListOwnerJobs("acme"), 2)
+
+	// A rejection that may pass is not kept for the Idempotency-Key
+	retry := func() *httptest.ResponseRecorder {
+		req := createRequest(t, "test.csv", "name,email\nYash,yash@example.com\n")
+		req.Header.Set("Authorization", "Bearer acme-key")
+		req.Header.Set(headerIdempotencyKey, "quota")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusTooManyRequests, retry().Code)
+	for _, job := range handler.jobService.ListOwnerJobs("acme") {
+		handler.jobService.CancelJob(job.ID)
+	}
+	w = retry()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(headerIdempotentReplayed))
+
+	// Nor is running out of storage, which answers 413
+	store := func(key string) *httptest.ResponseRecorder {
+		req := createRequest(t, "test.csv", "name,email\nDev,dev@example.com\n")
+		req.Header.Set("Authorization", "Bearer acme-key")
+		req.Header.Set(headerIdempotencyKey, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	handler.tenantService, err = services.NewTenantService(models.TenantLimits{}, []models.Tenant{
+		{ID: "acme", TenantLimits: models.TenantLimits{MaxStorageBytes: 1}},
+	}, handler.jobService, handler.fileService)
+	require.NoError(t, err)
+	w = store("storage")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, services.QuotaStorageBytes, quota(w).Quota)
+
+	handler.tenantService, err = services.NewTenantService(models.TenantLimits{}, nil, handler.jobService, handler.fileService)
+	require.NoError(t, err)
+	w = store("storage")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(headerIdempotentReplayed))
+}
+
+func TestTenantQuotasAfterDecompression(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	gin.SetMode(gin.TestMode)
+
+	limit := func(limits models.TenantLimits) {
+		tenantService, err := services.NewTenantService(limits, nil, handler.jobService, handler.fileService)
+		require.NoError(t, err)
+		handler.tenantService = tenantService
+	}
+	quota := func(w *httptest.ResponseRecorder) string {
+		var response models.QuotaErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Quota
+	}
+	multipart := func(filename, content string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = createRequest(t, filename, content)
+		handler.UploadFile(c)
+		return w
+	}
+
+	content := "name,email\n" + strings.Repeat("Chirag,chirag@example.com\n", 100)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(content))
+	require.NoError(t, gz.Close())
+
+	// A small compressed upload that inflates past the file size limit
+	limit(models.TenantLimits{MaxFileSize: 500})
+	require.Less(t, buf.Len(), 500)
+	w := multipart("big.csv.gz", buf.String())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, services.QuotaFileSize, quota(w))
+
+	// Streams of unknown length and archives are checked once stored
+	limit(models.TenantLimits{MaxStorageBytes: 1000})
+	w = streamRequest(t, handler, "/api/upload?filename=big.csv", "text/csv", io.MultiReader(strings.NewReader(content)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, services.QuotaStorageBytes, quota(w))
+
+	w = multipart("big.zip", createZip(t, map[string]string{"a.csv": content}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, services.QuotaStorageBytes, quota(w))
+
+	// Nothing rejected is kept
+	used, err := handler.fileService.StorageUsed()
+	require.NoError(t, err)
+	assert.Zero(t, used)
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	require.NoError(t, router.SetTrustedProxies([]string{"10.0.0.1"}))
+	router.GET("/limited", RateLimit(services.NewMemoryRateLimitStore(), "test", services.RateLimit{Rate: 0.5, Burst: 2}), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	get := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, http.StatusNoContent, get("192.0.2.1:1234", "").Code)
+
+	w = get("192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	// Untrusted clients can't pick another address to be counted against
+	assert.Equal(t, http.StatusTooManyRequests, get("192.0.2.1:1234", "198.51.100.7").Code)
+
+	// Behind the proxy, each forwarded client has its own bucket
+	assert.Equal(t, http.StatusNoContent, get("10.0.0.1:5678", "198.51.100.7").Code)
+	assert.Equal(t, http.StatusNoContent, get("10.0.0.1:5678", "198.51.100.8").Code)
+
+	// Without a limit nothing is counted
+	router.GET("/unlimited", RateLimit(services.NewMemoryRateLimitStore(), "test", services.RateLimit{}), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/unlimited", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitPerAPIKey(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+
+	store, err := services.NewMemoryAPIKeyStore([]models.APIKey{
+		{ID: "acme", SHA256: services.HashAPIKey("acme-key")},
+		{ID: "globex", SHA256: services.HashAPIKey("globex-key")},
+	})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api", RequireAuth(services.NewAuthService(store, nil)))
+	limit := RateLimit(services.NewMemoryRateLimitStore(), "download", services.RateLimit{Rate: 1, Burst: 1})
+	api.GET("/download/:id", limit, handler.DownloadFile)
+
+	// Keys behind the same address are counted separately
+	target := "/api/download/a225eb00-0907-4273-92ca-5faadeefae5f"
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodGet, target, "acme-key").Code)
+	assert.Equal(t, http.StatusTooManyRequests, authRequest(router, http.MethodGet, target, "acme-key").Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodGet, target, "globex-key").Code)
+}
+
+// openAPIContract checks responses against the OpenAPI document served at
+// /api/openapi.json, remembering which of its operations were exercised
+type openAPIContract struct {
+	t       *testing.T
+	spec    map[string]interface{}
+	route   string
+	checked map[string]bool
+}
+
+func newOpenAPIContract(t *testing.T) *openAPIContract {
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal(openAPISpec, &spec))
+	return &openAPIContract{t: t, spec: spec, checked: map[string]bool{}}
+}
+
+// operations returns every operation of the document as "METHOD /path"
+func (oc *openAPIContract) operations() []string {
+	var operations []string
+	for path, item := range oc.spec["paths"].(map[string]interface{}) {
+		for method := range item.(map[string]interface{}) {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				operations = append(operations, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	return operations
+}
+
+// openAPIPath turns a Gin route such as /api/jobs/:id into its OpenAPI path
+func openAPIPath(route string) string {
+	parts := strings.Split(route, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// resolve follows $ref until it reaches a node defined in place
+func (oc *openAPIContract) resolve(node map[string]interface{}) map[string]interface{} {
+	ref, ok := node["$ref"].(string)
+	if !ok {
+		return node
+	}
+
+	var target interface{} = oc.spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		target = target.(map[string]interface{})[part]
+	}
+	require.NotNil(oc.t, target, "unresolved reference %s", ref)
+	return oc.resolve(target.(map[string]interface{}))
+}
+
+// record is middleware noting the route of each request, to find its operation
+func (oc *openAPIContract) record() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		oc.route = c.FullPath()
+	}
+}
+
+// serve sends req through router, which must use record, and checks that the
+// status, content type and body of the response are all documented
+func (oc *openAPIContract) serve(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	oc.t.Helper()
+
+	oc.route = ""
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.NotEmpty(oc.t, oc.route, "%s %s matched no route", req.Method, req.URL)
+
+	path := openAPIPath(oc.route)
+	item, ok := oc.spec["paths"].(map[string]interface{})[path].(map[string]interface{})
+	require.True(oc.t, ok, "%s is not in the OpenAPI document", path)
+	operation, ok := item[strings.ToLower(req.Method)].(map[string]interface{})
+	require.True(oc.t, ok, "%s %s is not in the OpenAPI document", req.Method, path)
+	oc.checked[req.Method+" "+path] = true
+
+	where := fmt.Sprintf("%s %s answering %d", req.Method, path, w.Code)
+	response, ok := operation["responses"].(map[string]interface{})[strconv.Itoa(w.Code)].(map[string]interface{})
+	if !assert.True(oc.t, ok, "%s: status is not documented", where) {
+		return w
+	}
+
+	content, _ := oc.resolve(response)["content"].(map[string]interface{})
+	if content == nil {
+		assert.Empty(oc.t, w.Body.String(), "%s: no body is documented", where)
+		return w
+	}
+
+	mediaType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	require.NoError(oc.t, err, where)
+	media, ok := content[mediaType].(map[string]interface{})
+	if !assert.True(oc.t, ok, "%s: %s is not documented", where, mediaType) {
+		return w
+	}
+
+	// Files, such as downloads converted to JSON, are opaque strings
+	schema := oc.resolve(media["schema"].(map[string]interface{}))
+	if mediaType != gin.MIMEJSON || schema["type"] == "string" {
+		return w
+	}
+
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+	decoder.UseNumber()
+	require.NoError(oc.t, decoder.Decode(&body), where)
+	assert.NoError(oc.t, oc.validate(schema, body, "body"), where)
+	return w
+}
+
+// validate checks value, decoded with json.Number, against schema. Objects
+// are closed: properties not in the schema are only allowed by
+// additionalProperties, so fields added to a model can't go undocumented.
+func (oc *openAPIContract) validate(schema map[string]interface{}, value interface{}, at string) error {
+	schema = oc.resolve(schema)
+
+	if alternatives, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, alternative := range alternatives {
+			if oc.validate(alternative.(map[string]interface{}), value, at) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s: matches %d of the oneOf schemas instead of one", at, matched)
+		}
+		return nil
+	}
+
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: is null", at)
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || fmt.Sprint(allowed) == fmt.Sprint(value)
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", at, value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an object", at, value)
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s: required property %s is missing", at, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range object {
+			propertySchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				switch additional := schema["additionalProperties"].(type) {
+				case bool:
+					if additional {
+						continue
+					}
+				case map[string]interface{}:
+					propertySchema = additional
+				}
+			}
+			if propertySchema == nil {
+				return fmt.Errorf("%s: property %s is not documented", at, name)
+			}
+			if err := oc.validate(propertySchema, property, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an array", at, value)
+		}
+		for i, item := range array {
+			if err := oc.validate(schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: %v is not a string", at, value)
+		}
+		switch schema["format"] {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, s)
+			}
+		case "uuid":
+			if _, err := uuid.Parse(s); err != nil {
+				return fmt.Errorf("%s: %q is not a UUID", at, s)
+			}
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: %v is not an integer", at, value)
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("%s: %v is not an integer", at, value)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s: %v is not a number", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: %v is not a boolean", at, value)
+		}
+	default:
+		return fmt.Errorf("%s: schema has no type", at)
+	}
+
+	return nil
+}
+
+// contractRouter registers every route on a router recording them for oc
+func contractRouter(oc *openAPIContract, handler *Handler, authService *services.AuthService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(oc.record())
+	handler.RegisterRoutes(router, authService, services.NewMemoryRateLimitStore())
+	return router
+}
+
+func TestOpenAPI_Routes(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+	oc := newOpenAPIContract(t)
+
+	router := contractRouter(oc, handler, nil)
+
+	// Every route is documented and every documented operation is routed
+	var routes []string
+	for _, route := range router.Routes() {
+		routes = append(routes, route.Method+" "+openAPIPath(route.Path))
+	}
+	assert.ElementsMatch(t, oc.operations(), routes)
+
+	// The document is served as it is embedded
+	w := oc.serve(router, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, string(openAPISpec), w.Body.String())
+	assert.True(t, strings.HasPrefix(oc.spec["openapi"].(string), "3."))
+}
+
+func TestOpenAPI_Schemas(t *testing.T) {
+	oc := newOpenAPIContract(t)
+
+	// The model each object schema describes
+	schemaModels := map[string]interface{}{
+		"Error":                     models.ErrorResponse{},
+		"QuotaError":                models.QuotaErrorResponse{},
+		"HealthResponse":            models.HealthResponse{},
+		"ReadinessResponse":         models.ReadinessResponse{},
+		"CheckResult":               models.CheckResult{},
+		"ProcessingOptions":         models.ProcessingOptions{},
+		"JobSummary":                models.JobSummary{},
+		"JobProgress":               models.JobProgress{},
+		"Job":                       models.Job{},
+		"JobListResponse":           models.JobListResponse{},
+		"BatchResponse":             models.BatchResponse{},
+		"UploadResponse":            models.UploadResponse{},
+		"ValidateResponse":          models.ValidateResponse{},
+		"EmailValidationRequest":    models.EmailValidationRequest{},
+		"EmailValidationResult":     models.EmailValidationResult{},
+		"EmailValidationResponse":   models.EmailValidationResponse{},
+		"WebhookDelivery":           models.WebhookDelivery{},
+		"WebhookDeliveriesResponse": models.WebhookDeliveriesResponse{},
+		"CreateUploadRequest":       models.CreateUploadRequest{},
+		"Upload":                    models.Upload{},
+		"JobEvent":                  models.JobEvent{},
+		"WebSocketRequest":          models.WebSocketRequest{},
+		"WebSocketMessage":          models.WebSocketMessage{},
+	}
+
+	schemas := oc.spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for name, node := range schemas {
+		schema := node.(map[string]interface{})
+		if schema["type"] != "object" {
+			continue
+		}
+
+		model, ok := schemaModels[name]
+		if !assert.True(t, ok, "schema %s has no model to check it against", name) {
+			continue
+		}
+
+		// Properties match the JSON fields, and those always present are required
+		properties := schema["properties"].(map[string]interface{})
+		var names, required, documentedRequired []string
+		for _, field := range reflect.VisibleFields(reflect.TypeOf(model)) {
+			tag, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			names = append(names, tag)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, tag)
+			}
+
+			if property, ok := properties[tag].(map[string]interface{}); ok {
+				assert.Equal(t, openAPIType(field.Type), oc.resolve(property)["type"], "type of %s.%s", name, tag)
+			}
+		}
+		for property := range properties {
+			assert.Contains(t, names, property, "%s.%s is not a field of %T", name, property, model)
+		}
+		for _, name := range names {
+			assert.Contains(t, properties, name, "field %s of %T is not documented", name, model)
+		}
+		if list, ok := schema["required"].([]interface{}); ok {
+			for _, name := range list {
+				documentedRequired = append(documentedRequired, name.(string))
+			}
+		}
+		assert.ElementsMatch(t, required, documentedRequired, "required properties of %s", name)
+	}
+
+	// Enums only list values the service accepts
+	for _, value := range schemas["JobStatus"].(map[string]interface{})["enum"].([]interface{}) {
+		assert.True(t, models.JobStatus(value.(string)).IsValid(), "job status %s", value)
+	}
+	for _, value := range schemas["EmptyRowPolicy"].(map[string]interface{})["enum"].([]interface{}) {
+		assert.True(t, models.EmptyRowPolicy(value.(string)).IsValid(), "empty row policy %s", value)
+	}
+}
+
+// openAPIType returns the OpenAPI type a Go value of type t is encoded as
+func openAPIType(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return openAPIType(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func TestOpenAPI_Responses(t *testing.T) {
+	handler, tempDir := setupHandler(t)
+	defer os.RemoveAll(tempDir)
+	oc := newOpenAPIContract(t)
+	router := contractRouter(oc, handler, nil)
+
+	const unknownID = "a225eb00-0907-4273-92ca-5faadeefae5f"
+	send := func(method, target string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, body)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return oc.serve(router, req)
+	}
+	expect := func(status int, w *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+		t.Helper()
+		require.Equal(t, status, w.Code, w.Body.String())
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, v interface{}) {
+		t.Helper()
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+
+	// Health
+	expect(http.StatusOK, send(http.MethodGet, "/health", nil, nil))
+	expect(http.StatusOK, send(http.MethodGet, "/livez", nil, nil))
+	expect(http.StatusOK, send(http.MethodGet, "/readyz", nil, nil))
+	expect(http.StatusOK, send(http.MethodGet, "/metrics", nil, nil))
+	expect(http.StatusOK, send(http.MethodGet, "/api/openapi.json", nil, nil))
+
+	// Uploads
+	var upload models.UploadResponse
+	decode(expect(http.StatusOK, oc.serve(router, createRequest(t, "people.csv", "name,email\nJohn,john@example.com\n"))), &upload)
+	jobID := upload.ID
+	require.Eventually(t, func() bool {
+		job, _ := handler.jobService.GetJob(jobID)
+		return job.Status == models.JobStatusCompleted
+	}, time.Second, 5*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		req := createRequest(t, "again.csv", "name,email\nJane,jane@example.com\n")
+		req.Header.Set(headerIdempotencyKey, "contract")
+		expect(http.StatusOK, oc.serve(router, req))
+	}
+	expect(http.StatusBadRequest, send(http.MethodPost, "/api/upload", nil, nil))
+
+	var batch models.UploadResponse
+	decode(expect(http.StatusOK, oc.serve(router, createRequest(t, "batch.zip", createZip(t, map[string]string{
+		"first.csv": "name,email\nChirag,chirag@example.com\n",
+	})))), &batch)
+	expect(http.StatusOK, send(http.MethodGet, "/api/batches/"+batch.BatchID, nil, nil))
+	expect(http.StatusBadRequest, send(http.MethodGet, "/api/batches/not-a-batch", nil, nil))
+	expect(http.StatusNotFound, send(http.MethodGet, "/api/batches/"+unknownID, nil, nil))
+
+	csvBody := "name,email\nYash,yash@example.com\n"
+	expect(http.StatusOK, send(http.MethodPut, "/api/upload?filename=people.csv", strings.NewReader(csvBody), map[string]string{"Content-Type": "text/csv"}))
+	expect(http.StatusBadRequest, send(http.MethodPut, "/api/upload?filename=notes.txt", strings.NewReader(csvBody), map[string]string{"Content-Type": "text/csv"}))
+	expect(http.StatusUnsupportedMediaType, send(http.MethodPut, "/api/upload", strings.NewReader(csvBody), map[string]string{"Content-Type": "image/png"}))
+
+	// Synchronous validation
+	expect(http.StatusOK, send(http.MethodPost, "/api/validate", strings.NewReader(csvBody), map[string]string{"Content-Type": "text/csv", "Accept": "application/json"}))
+	expect(http.StatusOK, send(http.MethodPost, "/api/validate", strings.NewReader(csvBody), map[string]string{"Content-Type": "text/csv"}))
+	expect(http.StatusOK, send(http.MethodPost, "/api/validate", strings.NewReader(`[["name","email"],["Yash","yash@example.com"]]`), map[string]string{"Content-Type": "application/json"}))
+	expect(http.StatusBadRequest, send(http.MethodPost, "/api/validate", strings.NewReader(`{`), map[string]string{"Content-Type": "application/json"}))
+	expect(http.StatusRequestEntityTooLarge, send(http.MethodPost, "/api/validate", strings.NewReader(strings.Repeat("x", 2048)), map[string]string{"Content-Type": "text/csv"}))
+
+	jsonHeaders := map[string]string{"Content-Type": "application/json"}
+	expect(http.StatusOK, send(http.MethodPost, "/api/emails/validate", strings.NewReader(`{"email":"john@example.com"}`), jsonHeaders))
+	expect(http.StatusOK, send(http.MethodPost, "/api/emails/validate", strings.NewReader(`{"emails":["john@example.com","nope"]}`), jsonHeaders))
+	expect(http.StatusBadRequest, send(http.MethodPost, "/api/emails/validate", strings.NewReader(`{}`), jsonHeaders))
+
+	// Jobs
+	expect(http.StatusOK, send(http.MethodGet, "/api/jobs", nil, nil))
+	expect(http.StatusBadRequest, send(http.MethodGet, "/api/jobs?status=lost", nil, nil))
+	expect(http.StatusOK, send(http.MethodGet, "/api/jobs/"+jobID, nil, nil))
+	expect(http.StatusBadRequest, send(http.MethodGet, "/api/jobs/not-a-job", nil, nil))
+	expect(http.StatusNotFound, send(http.MethodGet, "/api/jobs/"+unknownID, nil, nil))
+	expect(http.StatusOK, send(http.MethodGet, "/api/jobs/"+jobID+"/webhooks", nil, nil))
+	expect(http.StatusBadRequest, send(http.MethodGet, "/api/jobs/not-a-job/webhooks", nil, nil))
+	expect(http.StatusNotFound, send(http.MethodGet, "/api/jobs/"+unknownID+"/webhooks", nil, nil))
+
+	expect(http.StatusOK, send(http.MethodGet, "/api/jobs/"+jobID+"/events", nil, nil))
+	expect(http.StatusNoContent, send(http.MethodGet, "/api/jobs/"+jobID+"/events", nil, map[string]string{"Last-Event-ID": "1000"}))
+	expect(http.StatusBadRequest, send(http.MethodGet, "/api/jobs/"+jobID+"/events", nil, map[string]string{"Last-Event-ID": "last"}))
+	expect(http.StatusNotFound, send(http.MethodGet, "/api/jobs/"+unknownID+"/events", nil, nil))
+
+	// Downloads
+	expect(http.StatusOK, send(http.MethodGet, "/api/download/"+jobID, nil, nil))
+	expect(http.StatusPartialContent, send(http.MethodGet, "/api/download/"+jobID, nil, map[string]string{"Range": "bytes=0-3"}))
+	expect(http.StatusOK, send(http.MethodGet, "/api/download/"+jobID+"?format=json", nil, nil))
+	expect(http.StatusOK, send(http.MethodGet, "/api/download/"+jobID+"?compress=gzip", nil, nil))
+	expect(http.StatusBadRequest, send(http.MethodGet, "/api/download/"+jobID+"?format=pdf", nil, nil))
+	expect(http.StatusBadRequest, send(http.MethodGet, "/api/download/not-a-job", nil, nil))
+	expect(http.StatusNotFound, send(http.MethodGet, "/api/download/"+unknownID, nil, nil))
+
+	failed := handler.jobService.CreateJob("failed.csv")
+	require.NoError(t, handler.jobService.UpdateJobError(failed.ID, "Save failed"))
+	expect(http.StatusInternalServerError, send(http.MethodGet, "/api/download/"+failed.ID, nil, nil))
+
+	pending := handler.jobService.CreateJob("pending.csv")
+	expect(http.StatusLocked, send(http.MethodGet, "/api/download/"+pending.ID, nil, nil))
+	expect(http.StatusOK, send(http.MethodDelete, "/api/jobs/"+pending.ID, nil, nil))
+	expect(http.StatusGone, send(http.MethodGet, "/api/download/"+pending.ID, nil, nil))
+	expect(http.StatusConflict, send(http.MethodDelete, "/api/jobs/"+jobID, nil, nil))
+	expect(http.StatusBadRequest, send(http.MethodDelete, "/api/jobs/not-a-job", nil, nil))
+	expect(http.StatusNotFound, send(http.MethodDelete, "/api/jobs/"+unknownID, nil, nil))
+
+	// A plain GET is no WebSocket handshake
+	expect(http.StatusBadRequest, send(http.MethodGet, "/api/ws", nil, nil))
+
+	// Resumable uploads
+	expect(http.StatusBadRequest, send(http.MethodPost, "/api/uploads", strings.NewReader(`{`), jsonHeaders))
+	expect(http.StatusRequestEntityTooLarge, send(http.MethodPost, "/api/uploads", strings.NewReader(`{"filename":"big.csv","size":104857600}`), jsonHeaders))
+
+	var resumable models.Upload
+	decode(expect(http.StatusCreated, send(http.MethodPost, "/api/uploads", strings.NewReader(fmt.Sprintf(`{"filename":"people.csv","size":%d}`, len(csvBody))), jsonHeaders)), &resumable)
+	uploadPath := "/api/uploads/" + resumable.ID
+	chunk := func(offset string) map[string]string {
+		return map[string]string{"Content-Type": "application/offset+octet-stream", headerUploadOffset: offset}
+	}
+
+	expect(http.StatusOK, send(http.MethodGet, uploadPath, nil, nil))
+	expect(http.StatusNotFound, send(http.MethodGet, "/api/uploads/"+unknownID, nil, nil))
+	expect(http.StatusBadRequest, send(http.MethodPatch, uploadPath, strings.NewReader(csvBody), chunk("")))
+	expect(http.StatusConflict, send(http.MethodPatch, uploadPath, strings.NewReader(csvBody), chunk("5")))
+	expect(http.StatusConflict, send(http.MethodPost, uploadPath+"/complete", nil, nil))
+	expect(http.StatusOK, send(http.MethodPatch, uploadPath, strings.NewReader(csvBody), chunk("0")))
+	expect(http.StatusOK, send(http.MethodPost, uploadPath+"/complete", nil, nil))
+	expect(http.StatusNotFound, send(http.MethodPost, "/api/uploads/"+unknownID+"/complete", nil, nil))
+
+	decode(expect(http.StatusCreated, send(http.MethodPost, "/api/uploads", strings.NewReader(`{"filename":"abandoned.csv","size":10}`), jsonHeaders)), &resumable)
+	expect(http.StatusNoContent, send(http.MethodDelete, "/api/uploads/"+resumable.ID, nil, nil))
+	expect(http.StatusNotFound, send(http.MethodDelete, "/api/uploads/"+resumable.ID, nil, nil))
+
+	// Authentication
+	keys, err := services.NewMemoryAPIKeyStore([]models.APIKey{{ID: "acme", SHA256: services.HashAPIKey("acme-key")}})
+	require.NoError(t, err)
+	router = contractRouter(oc, handler, services.NewAuthService(keys, nil))
+	expect(http.StatusUnauthorized, send(http.MethodGet, "/api/jobs", nil, nil))
+	expect(http.StatusForbidden, send(http.MethodGet, "/api/jobs?owner=globex", nil, map[string]string{headerAPIKey: "acme-key"}))
+
+	// Rate limits
+	handler.config.RateLimitDownloadPerMinute = 1
+	handler.config.RateLimitDownloadBurst = 1
+	router = contractRouter(oc, handler, nil)
+	expect(http.StatusNotFound, send(http.MethodGet, "/api/download/"+unknownID, nil, nil))
+	expect(http.StatusTooManyRequests, send(http.MethodGet, "/api/download/"+unknownID, nil, nil))
+
+	// A full queue makes the service unready
+	for i := 0; i < 10; i++ {
+		handler.jobService.CreateJob(fmt.Sprintf("queued-%d.csv", i))
+	}
+	expect(http.StatusServiceUnavailable, send(http.MethodGet, "/readyz", nil, nil))
+
+	// Every operation was tried
+	var checked []string
+	for operation := range oc.checked {
+		checked = append(checked, operation)
+	}
+	assert.ElementsMatch(t, oc.operations(), checked)
+}
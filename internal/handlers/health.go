@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"csv-validator/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Health reports that the service is up. Kept for existing monitors; new
+// ones should use Livez and Readyz.
+func (h *Handler) Health(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{Status: "healthy"})
+}
+
+// Livez reports that the process is alive and serving requests. It checks
+// nothing else, so a full disk never gets the service restarted.
+func (h *Handler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{Status: "ok"})
+}
+
+// Readyz runs the readiness checks and answers 503 unless all of them pass,
+// so load balancers stop sending work until the service can take it again
+func (h *Handler) Readyz(c *gin.Context) {
+	readiness := h.healthService.Ready(c.Request.Context())
+
+	status := http.StatusOK
+	if readiness.Status != models.ReadinessReady {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, readiness)
+}
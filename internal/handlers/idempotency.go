@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"csv-validator/internal/models"
+	"csv-validator/internal/services"
+	"csv-validator/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// idempotentUpload runs upload at most once per Idempotency-Key. Repeating a
+// key with the same file and options replays the first response; repeating it
+// with anything else is rejected with 422. Each API key has its own keys.
+func (h *Handler) idempotentUpload(c *gin.Context, upload gin.HandlerFunc) {
+	key := c.GetHeader(headerIdempotencyKey)
+	if key == "" {
+		upload(c)
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength),
+		})
+		return
+	}
+
+	payloadHash, err := h.uploadPayloadHash(c)
+	if err != nil {
+		// Let the upload itself report what is wrong with the request
+		upload(c)
+		return
+	}
+
+	if owner := requestOwner(c); owner != "" {
+		key = owner + "\x00" + key
+	}
+
+	response, err := h.idempotencyService.Begin(key, payloadHash)
+	switch {
+	case errors.Is(err, services.ErrIdempotencyKeyReused):
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error: "Idempotency-Key was already used for a different request",
+		})
+		return
+	case errors.Is(err, services.ErrIdempotencyKeyInProgress):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "A request with this Idempotency-Key is still in progress",
+		})
+		return
+	case response != nil:
+		logger.Info(fmt.Sprintf("Replaying response for idempotency key %s", c.GetHeader(headerIdempotencyKey)))
+		c.Header(headerIdempotentReplayed, "true")
+		c.Data(response.Status, gin.MIMEJSON+"; charset=utf-8", response.Body)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	finished := false
+	defer func() {
+		c.Writer = recorder.ResponseWriter
+
+		// gin.Recovery answers a panic with 500, so treat it like one
+		if !finished {
+			h.idempotencyService.Release(key)
+		}
+	}()
+	upload(c)
+	finished = true
+
+	// Server errors and quota rejections may be transient, so leave the key
+	// free for a retry
+	if status := recorder.Status(); status >= http.StatusInternalServerError || c.GetBool(quotaRejectedKey) {
+		h.idempotencyService.Release(key)
+	} else {
+		h.idempotencyService.Complete(key, status, recorder.body.Bytes())
+	}
+}
+
+// uploadPayloadHash identifies a multipart upload by its file name, content and
+// processing options, leaving out the multipart framing, which differs between retries
+func (h *Handler) uploadPayloadHash(c *gin.Context) (string, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return "", err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s\x00%s\x00%s\x00%s\x00%s\x00", file.Filename, h.optionValue(c, "empty_rows"),
+		h.optionValue(c, "long_rows"), h.optionValue(c, "sheet"), h.optionValue(c, "callback_url"))
+	if _, err := io.Copy(hasher, src); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// responseRecorder keeps a copy of the response body while writing it through
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the connection behind the recorder
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"log/slog"
+	"time"
+
+	"csv-validator/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	headerRequestID = "X-Request-ID"
+
+	// requestIDKey is where the request ID is kept on the gin context
+	requestIDKey = "request_id"
+
+	// maxRequestIDLength bounds request IDs taken from clients
+	maxRequestIDLength = 128
+)
+
+// RequestID gives every request an ID, returned in X-Request-ID and added to
+// every line logged for the request through its context, including those of
+// the job it starts. An X-Request-ID sent by the client or a proxy in front is
+// kept, as long as it is a sensible ID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(headerRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(headerRequestID, id)
+		c.Request = c.Request.WithContext(logger.NewContext(c.Request.Context(), "request_id", id))
+		c.Next()
+	}
+}
+
+// validRequestID reports whether id is short and made of characters that are
+// safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '/', r == '+', r == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog logs every request once it has been handled, with the attributes
+// of its logger. It must come after RequestID to carry the request ID.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"bytes", c.Writer.Size(),
+			"client_ip", c.ClientIP(),
+		}
+		if route := c.FullPath(); route != "" {
+			attrs = append(attrs, "route", route)
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+
+		logger.FromContext(c.Request.Context()).Log(c.Request.Context(), level, "Handled request", attrs...)
+	}
+}
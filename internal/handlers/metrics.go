@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"csv-validator/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Values of the type label of the upload size metric
+const (
+	uploadTypeMultipart = "multipart"
+	uploadTypeStream    = "stream"
+	uploadTypeResumable = "resumable"
+)
+
+// unmatchedRoute labels requests matching no route, so scanners probing random
+// paths can't blow up the number of series
+const unmatchedRoute = "unmatched"
+
+// Metrics counts every request and observes how long it took, by its route
+// pattern rather than its path so job IDs don't each get their own series
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
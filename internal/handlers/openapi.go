@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec describes every route and response of the service. The contract
+// test in handlers_test.go keeps it in step with the routes and models.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPI serves the OpenAPI 3 description of the API
+func (h *Handler) OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, gin.MIMEJSON+"; charset=utf-8", openAPISpec)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"csv-validator/internal/models"
+	"csv-validator/internal/services"
+	"csv-validator/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFileSize returns the largest upload tenant may send, the smaller of the
+// global and the tenant's own limit
+func (h *Handler) maxFileSize(tenant string) int64 {
+	limit := h.config.MaxFileSize
+	if tenantLimit := h.tenantService.Limits(tenant).MaxFileSize; tenantLimit > 0 {
+		limit = min(limit, tenantLimit)
+	}
+	return limit
+}
+
+// checkStored checks stored files against tenant's limits, since the size of
+// decompressed and streamed uploads is only known once they are stored. Files
+// over the limits are discarded.
+func (h *Handler) checkStored(tenant string, files ...services.StoredFile) error {
+	sizes := make([]int64, len(files))
+	for i, f := range files {
+		sizes[i] = f.Size
+	}
+
+	if err := h.tenantService.CheckStored(tenant, sizes...); err != nil {
+		for _, f := range files {
+			h.fileService.Discard(f)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// quotaRejectedKey marks on the gin context that the request was answered by
+// quotaError, which may well pass once the tenant is back within its limits
+const quotaRejectedKey = "quota_rejected"
+
+// quotaError maps errors from checking a tenant's limits to a response. Limits
+// on what is stored give 413, limits on how many jobs run give 429.
+func (h *Handler) quotaError(c *gin.Context, err error) {
+	c.Set(quotaRejectedKey, true)
+
+	var quotaErr *services.QuotaError
+	if !errors.As(err, &quotaErr) {
+		logger.Error(fmt.Sprintf("Failed to check tenant limits: %v", err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Could not check quota",
+		})
+		return
+	}
+
+	logger.Info(fmt.Sprintf("Rejected %s %s: %v", c.Request.Method, c.Request.URL.Path, quotaErr))
+
+	status := http.StatusTooManyRequests
+	var message string
+	switch quotaErr.Quota {
+	case services.QuotaFileSize:
+		status = http.StatusRequestEntityTooLarge
+		message = fmt.Sprintf("File exceeds the limit of %d bytes for your tenant", quotaErr.Limit)
+	case services.QuotaStorageBytes:
+		status = http.StatusRequestEntityTooLarge
+		message = fmt.Sprintf("Storage quota of %d bytes exceeded", quotaErr.Limit)
+	case services.QuotaConcurrentJobs:
+		message = fmt.Sprintf("Too many jobs in progress, at most %d at a time", quotaErr.Limit)
+	case services.QuotaJobsPerDay:
+		message = fmt.Sprintf("Daily quota of %d jobs exceeded", quotaErr.Limit)
+	default:
+		message = "Quota exceeded"
+	}
+
+	c.JSON(status, models.QuotaErrorResponse{
+		Error: message,
+		Quota: quotaErr.Quota,
+		Limit: quotaErr.Limit,
+	})
+}
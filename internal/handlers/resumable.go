@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"csv-validator/internal/metrics"
+	"csv-validator/internal/models"
+	"csv-validator/internal/services"
+	"csv-validator/internal/utils"
+	"csv-validator/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Resumable upload headers, named after their tus counterparts
+const (
+	headerUploadOffset   = "Upload-Offset"
+	headerUploadChecksum = "Upload-Checksum"
+)
+
+// CreateUpload starts a resumable upload. The client then sends the file in
+// chunks with PATCH and finishes with POST .../complete.
+func (h *Handler) CreateUpload(c *gin.Context) {
+	var req models.CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid request body",
+		})
+		return
+	}
+
+	filename := utils.SanitizeFilename(filepath.Base(req.Filename))
+	if req.Filename == "" || !utils.IsSupportedUpload(filename) || req.Size <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid file type",
+		})
+		return
+	}
+
+	if req.Size > h.config.MaxFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error: "File too big",
+		})
+		return
+	}
+
+	if err := h.tenantService.CheckUpload(requestOwner(c), req.Size); err != nil {
+		h.quotaError(c, err)
+		return
+	}
+
+	options, err := h.buildOptions(req.EmptyRows, req.LongRows, req.Sheet, req.CallbackURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: fmt.Sprintf("Invalid options: %v", err),
+		})
+		return
+	}
+
+	upload, err := h.uploadService.CreateUpload(requestCreator(c), filename, req.Size, options)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to create upload for %s: %v", filename, err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Could not create upload",
+		})
+		return
+	}
+
+	logger.Info(fmt.Sprintf("Created resumable upload %s for %s (%d bytes)", upload.ID, filename, upload.Size))
+
+	c.Header("Location", "/api/uploads/"+upload.ID)
+	c.Header(headerUploadOffset, "0")
+	c.JSON(http.StatusCreated, upload)
+}
+
+// GetUpload reports how much of a resumable upload has been received
+func (h *Handler) GetUpload(c *gin.Context) {
+	upload, err := h.accessibleUpload(c)
+	if err != nil {
+		h.uploadError(c, err)
+		return
+	}
+
+	c.Header(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	c.JSON(http.StatusOK, upload)
+}
+
+// PatchUpload appends a chunk to a resumable upload. Upload-Offset must match the
+// bytes received so far; Upload-Checksum optionally verifies the chunk.
+func (h *Handler) PatchUpload(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Missing or invalid Upload-Offset header",
+		})
+		return
+	}
+
+	if _, err := h.accessibleUpload(c); err != nil {
+		h.uploadError(c, err)
+		return
+	}
+
+	liftDeadlines(c)
+	upload, err := h.uploadService.WriteChunk(c.Param("id"), offset, c.Request.Body, c.GetHeader(headerUploadChecksum))
+	if upload != nil {
+		c.Header(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Rejected chunk for upload %s at offset %d: %v", c.Param("id"), offset, err))
+		h.uploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, upload)
+}
+
+// CompleteUpload turns a fully received upload into a job (or a batch of jobs
+// for zip archives), exactly as if it had been posted to /api/upload. An
+// upload that could not be turned into jobs is kept, so the client can
+// complete it again, e.g. once it is back within its quotas.
+func (h *Handler) CompleteUpload(c *gin.Context) {
+	pending, err := h.accessibleUpload(c)
+	if err != nil {
+		h.uploadError(c, err)
+		return
+	}
+
+	// Turn the client away before unpacking anything
+	if err := h.tenantService.CheckJobs(pending.Owner, 1); err != nil {
+		h.quotaError(c, err)
+		return
+	}
+
+	// Once consumed, the upload's failures have been answered already
+	consumed := false
+	err = h.uploadService.CompleteUpload(c.Param("id"), func(upload *models.Upload, path string) error {
+		consumed = true
+		return h.startUploadJobs(c, upload, path)
+	})
+	if err != nil && !consumed {
+		h.uploadError(c, err)
+	}
+}
+
+// startUploadJobs creates and starts the jobs for a completed upload whose data
+// is at path, and answers the request either way
+func (h *Handler) startUploadJobs(c *gin.Context, upload *models.Upload, path string) error {
+	// Jobs belong to whoever started the upload
+	creator := models.Identity{Tenant: upload.Owner, Subject: upload.CreatedBy}
+	files := h.fileService.ForTenant(upload.Owner)
+
+	if utils.IsZipArchive(upload.Filename) {
+		file, err := os.Open(path)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to open upload %s: %v", upload.ID, err))
+			h.archiveError(c, err)
+			return err
+		}
+		defer file.Close()
+
+		batchID := uuid.New().String()
+		extracted, err := files.ExtractArchiveFrom(file, upload.Size, h.archiveLimits())
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to extract archive %s: %v", upload.Filename, err))
+			h.archiveError(c, err)
+			return err
+		}
+
+		response, err := h.startBatch(c.Request.Context(), creator, batchID, extracted, upload.Options)
+		if err != nil {
+			h.quotaError(c, err)
+			return err
+		}
+
+		h.uploadCompleted(upload)
+		c.JSON(http.StatusOK, response)
+		return nil
+	}
+
+	// Storage may have filled up since the upload was created. Plain files are
+	// moved away below, so check them while the upload can still be kept.
+	if !utils.IsCompressedCSV(upload.Filename) {
+		if err := h.tenantService.CheckUpload(upload.Owner, upload.Size); err != nil {
+			h.quotaError(c, err)
+			return err
+		}
+	}
+
+	var job *models.Job
+	if err := h.tenantService.AdmitJobs(upload.Owner, 1, func() {
+		job = h.jobService.CreateJobWithOptions(creator, upload.Filename, upload.Options)
+	}); err != nil {
+		h.quotaError(c, err)
+		return err
+	}
+	setSpanJob(c, job.ID)
+
+	var stored services.StoredFile
+	var err error
+	if utils.IsCompressedCSV(upload.Filename) {
+		var file *os.File
+		if file, err = os.Open(path); err == nil {
+			stored, err = files.SaveDecompressed(file, upload.Filename, h.archiveLimits())
+			file.Close()
+		}
+		if err == nil {
+			err = h.checkStored(upload.Owner, stored)
+		}
+	} else {
+		stored, err = files.MoveFile(path, upload.Filename)
+	}
+	var quotaErr *services.QuotaError
+	if errors.As(err, &quotaErr) {
+		h.jobService.UpdateJobError(job.ID, "Quota exceeded")
+		h.quotaError(c, err)
+		return err
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to save upload for job %s: %v", job.ID, err))
+		h.jobService.UpdateJobError(job.ID, "Save failed")
+		h.archiveError(c, err)
+		return err
+	}
+
+	h.startJob(c.Request.Context(), job.ID, stored, "")
+
+	h.uploadCompleted(upload)
+	c.JSON(http.StatusOK, models.UploadResponse{ID: job.ID, SHA256: stored.SHA256})
+	return nil
+}
+
+// uploadCompleted records a resumable upload that has been turned into jobs
+func (h *Handler) uploadCompleted(upload *models.Upload) {
+	logger.Info(fmt.Sprintf("Completed resumable upload %s (%d bytes)", upload.ID, upload.Size))
+	metrics.UploadSize.WithLabelValues(uploadTypeResumable).Observe(float64(upload.Size))
+}
+
+// DeleteUpload aborts a resumable upload
+func (h *Handler) DeleteUpload(c *gin.Context) {
+	if _, err := h.accessibleUpload(c); err != nil {
+		h.uploadError(c, err)
+		return
+	}
+
+	if err := h.uploadService.DeleteUpload(c.Param("id")); err != nil {
+		h.uploadError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// accessibleUpload returns the upload named in the path, reporting uploads of
+// other API keys as not found
+func (h *Handler) accessibleUpload(c *gin.Context) (*models.Upload, error) {
+	upload, err := h.uploadService.GetUpload(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess(c, upload.Owner) {
+		return nil, services.ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+// uploadError maps resumable upload errors to a response
+func (h *Handler) uploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUploadNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Upload not found",
+		})
+	case errors.Is(err, services.ErrUploadOffsetMismatch):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Upload-Offset does not match the bytes received",
+		})
+	case errors.Is(err, services.ErrUploadIncomplete):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Upload is incomplete",
+		})
+	case errors.Is(err, services.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error: "Chunk exceeds declared upload size",
+		})
+	case errors.Is(err, services.ErrInvalidChecksum):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid Upload-Checksum header",
+		})
+	case errors.Is(err, services.ErrChecksumMismatch):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Chunk checksum mismatch",
+		})
+	default:
+		logger.Error(fmt.Sprintf("Resumable upload error: %v", err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Upload failed",
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"csv-validator/internal/metrics"
+	"csv-validator/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes adds every route of the service to router. Routes below /api
+// need credentials unless authService is nil, and uploads and downloads are
+// rate limited per client as configured. Every route must be described in the
+// OpenAPI document served at /api/openapi.json.
+func (h *Handler) RegisterRoutes(router *gin.Engine, authService *services.AuthService, rateLimits services.RateLimitStore) {
+	// Health checks: /livez restarts a stuck process, /readyz takes the
+	// service out of rotation while it can't take work
+	router.GET("/health", h.Health)
+	router.GET("/livez", h.Livez)
+	router.GET("/readyz", h.Readyz)
+
+	// Prometheus metrics, for scraping from inside the network
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// The API description is public, like the documentation it replaces
+	router.GET("/api/openapi.json", h.OpenAPI)
+
+	// API routes
+	api := router.Group("/api")
+	if authService != nil {
+		api.Use(RequireAuth(authService))
+	}
+	uploadLimit := RateLimit(rateLimits, "upload", perMinute(h.config.RateLimitUploadPerMinute, h.config.RateLimitUploadBurst))
+	downloadLimit := RateLimit(rateLimits, "download", perMinute(h.config.RateLimitDownloadPerMinute, h.config.RateLimitDownloadBurst))
+	{
+		api.POST("/upload", uploadLimit, h.UploadFile)
+		api.PUT("/upload", uploadLimit, h.StreamUpload)
+		api.POST("/validate", h.Validate)
+		api.POST("/emails/validate", h.ValidateEmails)
+		api.GET("/download/:id", downloadLimit, h.DownloadFile)
+		api.GET("/jobs", h.ListJobs)
+		api.GET("/jobs/:id", h.GetJob)
+		api.DELETE("/jobs/:id", h.CancelJob)
+		api.GET("/jobs/:id/events", h.JobEvents)
+		api.GET("/jobs/:id/webhooks", h.GetJobWebhooks)
+		api.GET("/batches/:id", h.GetBatch)
+		api.GET("/ws", h.JobsWebSocket)
+
+		// Resumable uploads
+		api.POST("/uploads", uploadLimit, h.CreateUpload)
+		api.GET("/uploads/:id", h.GetUpload)
+		api.PATCH("/uploads/:id", h.PatchUpload)
+		api.POST("/uploads/:id/complete", h.CompleteUpload)
+		api.DELETE("/uploads/:id", h.DeleteUpload)
+	}
+}
+
+// perMinute converts a requests per minute setting to a rate limit
+func perMinute(requests, burst int64) services.RateLimit {
+	return services.RateLimit{Rate: float64(requests) / 60, Burst: int(burst)}
+}
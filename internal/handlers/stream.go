@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"csv-validator/internal/metrics"
+	"csv-validator/internal/models"
+	"csv-validator/internal/services"
+	"csv-validator/internal/spreadsheet"
+	"csv-validator/internal/utils"
+	"csv-validator/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// streamContentTypes maps the content types accepted by StreamUpload to the
+// file name used when the client doesn't supply one
+var streamContentTypes = map[string]string{
+	"":                          "upload.csv",
+	"text/csv":                  "upload.csv",
+	"text/plain":                "upload.csv",
+	"application/octet-stream":  "upload.csv",
+	"application/gzip":          "upload" + utils.ExtGzipCSV,
+	"application/zstd":          "upload" + utils.ExtZstdCSV,
+	"application/zip":           "upload" + utils.ExtZip,
+	spreadsheet.XLSXContentType: "upload" + spreadsheet.ExtXLSX,
+	"application/vnd.oasis.opendocument.spreadsheet": "upload" + spreadsheet.ExtODS,
+}
+
+// StreamUpload accepts the file as the raw request body and writes it to disk as
+// it arrives, without multipart spooling. The size limit, SHA-256 and content
+// sniffing all happen in that single pass.
+func (h *Handler) StreamUpload(c *gin.Context) {
+	if c.Request.ContentLength > h.config.MaxFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error: "File too big",
+		})
+		return
+	}
+
+	defaultName, ok := streamContentTypes[c.ContentType()]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, models.ErrorResponse{
+			Error: "Unsupported content type, send the file as the raw request body",
+		})
+		return
+	}
+
+	filename := utils.SanitizeFilename(filepath.Base(streamFilename(c, defaultName)))
+	if !utils.IsSupportedUpload(filename) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid file type",
+		})
+		return
+	}
+
+	options, err := h.processingOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: fmt.Sprintf("Invalid options: %v", err),
+		})
+		return
+	}
+
+	owner := requestOwner(c)
+	if err := h.tenantService.CheckUpload(owner, c.Request.ContentLength); err != nil {
+		h.quotaError(c, err)
+		return
+	}
+
+	liftDeadlines(c)
+	stream := services.NewUploadStream(c.Request.Body, h.maxFileSize(owner))
+
+	if utils.IsZipArchive(filename) {
+		h.streamArchive(c, stream, filename, options)
+		return
+	}
+
+	var job *models.Job
+	if err := h.tenantService.AdmitJobs(owner, 1, func() {
+		job = h.jobService.CreateJobWithOptions(requestCreator(c), filename, options)
+	}); err != nil {
+		h.quotaError(c, err)
+		return
+	}
+	setSpanJob(c, job.ID)
+
+	files := h.fileService.ForTenant(owner)
+	var stored services.StoredFile
+	if utils.IsCompressedCSV(filename) {
+		stored, err = files.SaveDecompressed(stream, filename, h.archiveLimits())
+	} else {
+		stored, err = files.SaveStream(stream, filename)
+	}
+	if err == nil {
+		if err = checkStreamContent(stream, filename); err != nil {
+			h.fileService.Discard(stored)
+		}
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to save streamed upload for job %s: %v", job.ID, err))
+		h.jobService.UpdateJobError(job.ID, "Save failed")
+		h.streamError(c, err)
+		return
+	}
+
+	if err := h.checkStored(owner, stored); err != nil {
+		h.jobService.UpdateJobError(job.ID, "Quota exceeded")
+		h.quotaError(c, err)
+		return
+	}
+
+	// Describe the stored file, decompressed or not, as POST /api/upload does
+	logger.Info(fmt.Sprintf("Streamed %d bytes for job %s (sha256 %s)", stored.Size, job.ID, stored.SHA256))
+	metrics.UploadSize.WithLabelValues(uploadTypeStream).Observe(float64(stored.Size))
+
+	h.startJob(c.Request.Context(), job.ID, stored, "")
+
+	c.JSON(http.StatusOK, models.UploadResponse{ID: job.ID, Size: stored.Size, SHA256: stored.SHA256})
+}
+
+// streamArchive spools a streamed zip, which needs random access, to a local
+// temporary file and extracts it as a batch
+func (h *Handler) streamArchive(c *gin.Context, stream *services.UploadStream, filename string, options models.ProcessingOptions) {
+	batchID := uuid.New().String()
+
+	file, err := os.CreateTemp("", "upload-*"+utils.ExtZip)
+	if err != nil {
+		h.streamError(c, err)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, stream); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save streamed archive %s: %v", filename, err))
+		h.streamError(c, err)
+		return
+	}
+
+	if err := checkStreamContent(stream, filename); err != nil {
+		h.streamError(c, err)
+		return
+	}
+	metrics.UploadSize.WithLabelValues(uploadTypeStream).Observe(float64(stream.Size()))
+
+	extracted, err := h.fileService.ForTenant(requestOwner(c)).ExtractArchiveFrom(file, stream.Size(), h.archiveLimits())
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to extract archive %s: %v", filename, err))
+		h.archiveError(c, err)
+		return
+	}
+
+	response, err := h.startBatch(c.Request.Context(), requestCreator(c), batchID, extracted, options)
+	if err != nil {
+		h.quotaError(c, err)
+		return
+	}
+	response.Size = stream.Size()
+	response.SHA256 = stream.SHA256()
+
+	c.JSON(http.StatusOK, response)
+}
+
+// streamFilename takes the file name from the filename query parameter or the
+// Content-Disposition header, falling back to fallback
+func streamFilename(c *gin.Context, fallback string) string {
+	if name := c.Query("filename"); name != "" {
+		return name
+	}
+
+	if _, params, err := mime.ParseMediaType(c.GetHeader("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+
+	return fallback
+}
+
+// errInvalidContent marks a streamed body whose content doesn't match its name
+var errInvalidContent = errors.New("invalid file content")
+
+// checkStreamContent validates what was sniffed from a fully read stream
+func checkStreamContent(stream *services.UploadStream, filename string) error {
+	if stream.Size() == 0 {
+		return fmt.Errorf("%w: %v", errInvalidContent, utils.ErrEmptyFile)
+	}
+
+	if _, err := services.DetectContentType(filename, stream.Head()); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidContent, err)
+	}
+
+	return nil
+}
+
+// liftDeadlines clears the server's read and write timeouts for a request whose
+// body may take far longer to arrive; both run from the start of the request
+func liftDeadlines(c *gin.Context) {
+	rc := http.NewResponseController(c.Writer)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
+
+// streamError maps errors from saving a streamed upload to a response
+func (h *Handler) streamError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error: "File too big",
+		})
+	case errors.Is(err, errInvalidContent):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid file content",
+		})
+	default:
+		h.archiveError(c, err)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"csv-validator/internal/tracing"
+	"csv-validator/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request, continuing the trace of a
+// traceparent header sent by the client or a proxy. The span goes into the
+// request context, so spans started by the handlers and the jobs they start
+// join the trace, and recorded traces' IDs are added to the request's log lines.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("url.path", c.Request.URL.Path),
+				attribute.String("client.address", c.ClientIP()),
+				attribute.String("user_agent.original", c.Request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if spanContext := span.SpanContext(); spanContext.IsSampled() {
+			ctx = logger.NewContext(ctx, "trace_id", spanContext.TraceID().String())
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if route := c.FullPath(); route != "" {
+			span.SetName(c.Request.Method + " " + route)
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
+
+// startSpan starts a span for a handler within the request's span and puts it
+// in the request context. The returned function ends it, marking it failed
+// for 5xx responses.
+func startSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) (end func()) {
+	ctx, span := tracing.Tracer().Start(c.Request.Context(), name, trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+
+	return func() {
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+		span.End()
+	}
+}
+
+// setSpanJob records on the current span which job a request is about
+func setSpanJob(c *gin.Context, jobID string) {
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("job.id", jobID))
+}
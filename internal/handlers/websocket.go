@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"csv-validator/internal/models"
+	"csv-validator/internal/utils"
+	"csv-validator/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait bounds each write, so a stalled client can't hold a connection open
+	wsWriteWait = 10 * time.Second
+
+	// wsPongWait is how long a client may go without answering a ping
+	wsPongWait = 60 * time.Second
+
+	// wsHeartbeat is how often clients are pinged and sent a heartbeat message
+	wsHeartbeat = 30 * time.Second
+
+	// wsSendBuffer is how many messages may queue for a client. Beyond it
+	// progress events are dropped, and a client missing a status change is
+	// disconnected.
+	wsSendBuffer = 256
+
+	// wsMaxMessageSize limits messages from clients
+	wsMaxMessageSize = 64 * 1024
+
+	// wsMaxSubscriptions limits the job IDs one connection may subscribe to
+	wsMaxSubscriptions = 1000
+)
+
+// JobsWebSocket upgrades to a WebSocket on which the client subscribes to
+// the events of jobs, by ID or by status, and receives them as they happen
+func (h *Handler) JobsWebSocket(c *gin.Context) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return h.originAllowed(r.Header.Get("Origin"))
+		},
+	}
+
+	// Upgrade replies with an HTTP error itself when the request is not a valid handshake
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logger.Debug(fmt.Sprintf("WebSocket upgrade failed: %v", err))
+		return
+	}
+
+	client := &wsClient{
+		conn:     conn,
+		send:     make(chan models.WebSocketMessage, wsSendBuffer),
+		done:     make(chan struct{}),
+		overflow: make(chan struct{}),
+		owner:    requestOwner(c),
+		admin:    isAdmin(c),
+		jobIDs:   make(map[string]bool),
+		statuses: make(map[models.JobStatus]bool),
+	}
+
+	unsubscribe := h.jobService.Subscribe(client.deliver)
+	defer unsubscribe()
+
+	writerDone := make(chan struct{})
+	go func() {
+		client.writeLoop()
+		close(writerDone)
+	}()
+
+	client.readLoop(h)
+
+	close(client.done)
+	<-writerDone
+	conn.Close()
+}
+
+// originAllowed reports whether a browser on origin may open a WebSocket,
+// following ALLOWED_ORIGINS like CORS does. Requests without an Origin don't
+// come from a browser.
+func (h *Handler) originAllowed(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	return newCORSPolicy(h.config.AllowedOrigins).allows(origin)
+}
+
+// wsClient is one WebSocket connection and what it is subscribed to
+type wsClient struct {
+	conn *websocket.Conn
+	send chan models.WebSocketMessage
+
+	// done is closed once the client has gone away
+	done chan struct{}
+
+	// overflow is closed when a status change could not be queued
+	overflow     chan struct{}
+	overflowOnce sync.Once
+
+	// dropped counts progress events skipped since the last message sent
+	dropped atomic.Int64
+
+	// owner is the tenant of the API key the client connected with. Unless it
+	// is an admin, the client only sees that tenant's jobs.
+	owner string
+	admin bool
+
+	mu       sync.Mutex
+	jobIDs   map[string]bool
+	statuses map[models.JobStatus]bool
+}
+
+// deliver is the JobListener queueing the events the client is subscribed to.
+// It never blocks: progress events that don't fit are dropped, and a status
+// change that doesn't fit disconnects the client, which can then reconnect and
+// resubscribe to get the current state of its jobs.
+func (wc *wsClient) deliver(event models.JobEvent) {
+	if !wc.matches(event) {
+		return
+	}
+
+	select {
+	case wc.send <- models.WebSocketMessage{Type: models.WebSocketEvent, Event: &event}:
+	default:
+		if event.Type == models.JobEventProgress {
+			wc.dropped.Add(1)
+			return
+		}
+		wc.overflowOnce.Do(func() { close(wc.overflow) })
+	}
+}
+
+// matches reports whether the client is subscribed to the event's job, either
+// by ID or by its status. Status subscribers also see jobs leaving that status.
+func (wc *wsClient) matches(event models.JobEvent) bool {
+	if !wc.canSee(event.Job) {
+		return false
+	}
+
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	return wc.jobIDs[event.Job.ID] || wc.statuses[event.Job.Status] ||
+		(event.PreviousStatus != "" && wc.statuses[event.PreviousStatus])
+}
+
+// queue sends a reply to the client, waiting for room unless it has gone away
+func (wc *wsClient) queue(message models.WebSocketMessage) {
+	select {
+	case wc.send <- message:
+	case <-wc.done:
+	case <-wc.overflow:
+	}
+}
+
+// readLoop handles subscription requests until the connection fails or closes
+func (wc *wsClient) readLoop(h *Handler) {
+	wc.conn.SetReadLimit(wsMaxMessageSize)
+	wc.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	wc.conn.SetPongHandler(func(string) error {
+		return wc.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := wc.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Debug(fmt.Sprintf("WebSocket closed: %v", err))
+			}
+			return
+		}
+
+		var request models.WebSocketRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			wc.queue(wsError("Invalid message, expected JSON"))
+			continue
+		}
+
+		if problem := wc.handle(h, request); problem != "" {
+			wc.queue(wsError(problem))
+		}
+	}
+}
+
+// handle applies a subscription request, confirms the resulting subscriptions
+// and, for new subscriptions, sends the latest event of every matching job so
+// the client starts from their current state. It returns a description of
+// anything wrong with the request.
+func (wc *wsClient) handle(h *Handler, request models.WebSocketRequest) string {
+	if request.Action != models.WebSocketSubscribe && request.Action != models.WebSocketUnsubscribe {
+		return fmt.Sprintf("Unknown action %q, expected subscribe or unsubscribe", request.Action)
+	}
+	for _, status := range request.Statuses {
+		if !status.IsValid() {
+			return fmt.Sprintf("Unknown status %q", status)
+		}
+	}
+
+	subscribe := request.Action == models.WebSocketSubscribe
+
+	// Only jobs that exist can be subscribed to
+	jobIDs := request.JobIDs
+	var missing []string
+	if subscribe {
+		jobIDs = nil
+		for _, id := range request.JobIDs {
+			if job, exists := h.jobService.GetJob(id); utils.IsValidJobID(id) && exists && wc.canSee(*job) {
+				jobIDs = append(jobIDs, id)
+			} else {
+				missing = append(missing, id)
+			}
+		}
+	}
+
+	wc.mu.Lock()
+	if subscribe && len(wc.jobIDs)+len(jobIDs) > wsMaxSubscriptions {
+		wc.mu.Unlock()
+		return fmt.Sprintf("Too many subscriptions, at most %d job IDs per connection", wsMaxSubscriptions)
+	}
+	for _, id := range jobIDs {
+		if subscribe {
+			wc.jobIDs[id] = true
+		} else {
+			delete(wc.jobIDs, id)
+		}
+	}
+	for _, status := range request.Statuses {
+		if subscribe {
+			wc.statuses[status] = true
+		} else {
+			delete(wc.statuses, status)
+		}
+	}
+	subscriptions := wc.subscriptions()
+	wc.mu.Unlock()
+
+	wc.queue(subscriptions)
+
+	if !subscribe {
+		return ""
+	}
+
+	for _, id := range jobIDs {
+		if event, found := latestEvent(h, id); found {
+			wc.queue(models.WebSocketMessage{Type: models.WebSocketEvent, Event: &event})
+		}
+	}
+
+	if len(request.Statuses) > 0 {
+		wanted := make(map[models.JobStatus]bool)
+		for _, status := range request.Statuses {
+			wanted[status] = true
+		}
+		for _, job := range h.jobService.ListJobs() {
+			if !wanted[job.Status] || !wc.canSee(*job) {
+				continue
+			}
+			if event, found := latestEvent(h, job.ID); found {
+				wc.queue(models.WebSocketMessage{Type: models.WebSocketEvent, Event: &event})
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Sprintf("Jobs not found: %s", strings.Join(missing, ", "))
+	}
+	return ""
+}
+
+// canSee reports whether the client may receive the events of job
+func (wc *wsClient) canSee(job models.Job) bool {
+	return wc.admin || job.Owner == wc.owner
+}
+
+// subscriptions describes everything the client is subscribed to. Callers must hold mu.
+func (wc *wsClient) subscriptions() models.WebSocketMessage {
+	message := models.WebSocketMessage{
+		Type:     models.WebSocketSubscriptions,
+		JobIDs:   []string{},
+		Statuses: []models.JobStatus{},
+	}
+	for id := range wc.jobIDs {
+		message.JobIDs = append(message.JobIDs, id)
+	}
+	for status := range wc.statuses {
+		message.Statuses = append(message.Statuses, status)
+	}
+	sort.Strings(message.JobIDs)
+	sort.Slice(message.Statuses, func(i, j int) bool { return message.Statuses[i] < message.Statuses[j] })
+
+	return message
+}
+
+// writeLoop sends queued messages and heartbeats until the client goes away
+// or falls too far behind
+func (wc *wsClient) writeLoop() {
+	heartbeat := time.NewTicker(wsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case message := <-wc.send:
+			message.Dropped = wc.dropped.Swap(0)
+			if err := wc.write(message); err != nil {
+				wc.conn.Close()
+				return
+			}
+
+		case <-heartbeat.C:
+			now := time.Now()
+			wc.conn.SetWriteDeadline(now.Add(wsWriteWait))
+			if err := wc.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				wc.conn.Close()
+				return
+			}
+			if err := wc.write(models.WebSocketMessage{Type: models.WebSocketHeartbeat, Time: &now}); err != nil {
+				wc.conn.Close()
+				return
+			}
+
+		case <-wc.overflow:
+			logger.Info("Closing WebSocket of a client too slow to keep up with job events")
+			deadline := time.Now().Add(wsWriteWait)
+			wc.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, reconnect and resubscribe"), deadline)
+			wc.conn.Close()
+			return
+
+		case <-wc.done:
+			deadline := time.Now().Add(wsWriteWait)
+			wc.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+			return
+		}
+	}
+}
+
+// write sends one message as JSON
+func (wc *wsClient) write(message models.WebSocketMessage) error {
+	wc.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return wc.conn.WriteJSON(message)
+}
+
+// latestEvent returns the most recent event recorded for a job
+func latestEvent(h *Handler, jobID string) (models.JobEvent, bool) {
+	events, exists := h.jobService.EventsSince(jobID, 0)
+	if !exists || len(events) == 0 {
+		return models.JobEvent{}, false
+	}
+	return events[len(events)-1], true
+}
+
+// wsError builds an error message for the client
+func wsError(message string) models.WebSocketMessage {
+	return models.WebSocketMessage{Type: models.WebSocketError, Error: message}
+}
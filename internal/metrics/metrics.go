@@ -0,0 +1,195 @@
+// Package metrics defines the Prometheus metrics of the service and serves
+// them for scraping.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"csv-validator/internal/models"
+	"csv-validator/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "csv_validator"
+
+// Registry holds every metric of the service, along with the Go runtime and
+// process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts handled requests by method, route and status
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes how long requests take by method and route
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// UploadSize observes the size of accepted uploads by how they were sent
+	UploadSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Size of accepted uploads, by upload type (multipart, stream or resumable).",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10), // 1KB to 256MB
+	}, []string{"type"})
+
+	// JobDuration observes how long jobs took from creation until they
+	// finished, by final status
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time from creating a job until it finished, by final status.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10), // 10ms to 45m
+	}, []string{"status"})
+
+	// JobStageDuration observes how long each stage of processing a job took
+	JobStageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_stage_duration_seconds",
+		Help:      "Time spent in each stage of processing a job (read, validate or write).",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10), // 1ms to 4m
+	}, []string{"stage"})
+
+	// RowsProcessed counts the data rows validated, by whether they held a
+	// valid email address
+	RowsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rows_processed_total",
+		Help:      "CSV data rows validated, by result (valid_email, invalid_email or empty).",
+	}, []string{"result"})
+
+	// EmailsValidated counts the addresses checked by the email validation
+	// endpoint, by result
+	EmailsValidated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_validated_total",
+		Help:      "Email addresses checked by the email validation endpoint, by result (valid or invalid).",
+	}, []string{"result"})
+)
+
+// Values of the result label of RowsProcessed and EmailsValidated
+const (
+	ResultValid        = "valid"
+	ResultInvalid      = "invalid"
+	ResultValidEmail   = "valid_email"
+	ResultInvalidEmail = "invalid_email"
+	ResultEmpty        = "empty"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		UploadSize,
+		JobDuration,
+		JobStageDuration,
+		RowsProcessed,
+		EmailsValidated,
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Sources report the state of the service gathered on every scrape
+type Sources struct {
+	// JobCounts counts the jobs held by status
+	JobCounts func() map[models.JobStatus]int
+	// StorageUsage returns the bytes stored in each of the upload and download
+	// directories. Listing storage can be slow, so its result is kept for
+	// storageUsageTTL.
+	StorageUsage func() (map[string]int64, error)
+}
+
+// storageUsageTTL is how long a storage usage measurement is reused
+const storageUsageTTL = 30 * time.Second
+
+var (
+	jobsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "jobs"),
+		"Jobs held, by status.", []string{"status"}, nil)
+	queueDepthDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "job_queue_depth"),
+		"Jobs waiting for or in processing.", nil, nil)
+	storageBytesDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "storage_bytes"),
+		"Bytes stored, by directory (upload or download).", []string{"dir"}, nil)
+)
+
+// stateCollector collects the metrics read from Sources
+type stateCollector struct {
+	sources Sources
+
+	usage         map[string]int64
+	usageMeasured time.Time
+	mu            sync.Mutex
+}
+
+// Register adds the metrics read from sources to Registry. It must only be
+// called once.
+func Register(sources Sources) {
+	Registry.MustRegister(&stateCollector{sources: sources})
+}
+
+// Describe sends the descriptions of the collected metrics
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jobsDesc
+	ch <- queueDepthDesc
+	ch <- storageBytesDesc
+}
+
+// Collect reads the current state from the sources
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.sources.JobCounts != nil {
+		counts := c.sources.JobCounts()
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(jobsDesc, prometheus.GaugeValue, float64(count), string(status))
+		}
+
+		// Every job is processed as soon as it is created, so the queue is the
+		// jobs not finished yet
+		depth := counts[models.JobStatusPending] + counts[models.JobStatusProcessing]
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(depth))
+	}
+	for dir, bytes := range c.storageUsage() {
+		ch <- prometheus.MustNewConstMetric(storageBytesDesc, prometheus.GaugeValue, float64(bytes), dir)
+	}
+}
+
+// storageUsage measures storage usage, at most once per storageUsageTTL. A
+// failed measurement reports nothing rather than stale numbers.
+func (c *stateCollector) storageUsage() map[string]int64 {
+	if c.sources.StorageUsage == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.usageMeasured) < storageUsageTTL {
+		return c.usage
+	}
+
+	usage, err := c.sources.StorageUsage()
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to measure storage usage: %v", err))
+		usage = nil
+	}
+	c.usage = usage
+	c.usageMeasured = time.Now()
+	return usage
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"csv-validator/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateCollector(t *testing.T) {
+	measured := 0
+	collector := &stateCollector{sources: Sources{
+		JobCounts: func() map[models.JobStatus]int {
+			return map[models.JobStatus]int{
+				models.JobStatusPending:    2,
+				models.JobStatusProcessing: 1,
+				models.JobStatusCompleted:  5,
+			}
+		},
+		StorageUsage: func() (map[string]int64, error) {
+			measured++
+			return map[string]int64{"upload": 1024, "download": 512}, nil
+		},
+	}}
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(collector))
+
+	expected := `
+# HELP csv_validator_job_queue_depth Jobs waiting for or in processing.
+# TYPE csv_validator_job_queue_depth gauge
+csv_validator_job_queue_depth 3
+# HELP csv_validator_jobs Jobs held, by status.
+# TYPE csv_validator_jobs gauge
+csv_validator_jobs{status="completed"} 5
+csv_validator_jobs{status="pending"} 2
+csv_validator_jobs{status="processing"} 1
+# HELP csv_validator_storage_bytes Bytes stored, by directory (upload or download).
+# TYPE csv_validator_storage_bytes gauge
+csv_validator_storage_bytes{dir="download"} 512
+csv_validator_storage_bytes{dir="upload"} 1024
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+
+	// Storage is only listed again once the measurement is stale
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+	assert.Equal(t, 1, measured)
+}
+
+func TestStateCollector_StorageError(t *testing.T) {
+	collector := &stateCollector{sources: Sources{
+		StorageUsage: func() (map[string]int64, error) {
+			return nil, errors.New("bucket unreachable")
+		},
+	}}
+
+	assert.Equal(t, 0, testutil.CollectAndCount(collector))
+}
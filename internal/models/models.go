@@ -12,22 +12,342 @@ const (
 	JobStatusProcessing JobStatus = "processing"
 	JobStatusCompleted  JobStatus = "completed"
 	JobStatusFailed     JobStatus = "failed"
+	JobStatusCancelled  JobStatus = "cancelled"
 )
 
+// IsValid reports whether the status is one of the known values
+func (s JobStatus) IsValid() bool {
+	switch s {
+	case JobStatusPending, JobStatusProcessing, JobStatusCompleted, JobStatusFailed, JobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// IsFinished reports whether a job in this status will not change any more
+func (s JobStatus) IsFinished() bool {
+	return s == JobStatusCompleted || s == JobStatusFailed || s == JobStatusCancelled
+}
+
+// EmptyRowPolicy controls how blank rows are written to the processed file
+type EmptyRowPolicy string
+
+const (
+	// EmptyRowPolicyPad keeps blank rows, padded to the header width plus has_email.
+	// Every other row is also made the header width, so the output is rectangular.
+	// With LongRowPolicyExtend the header is as wide as the widest row.
+	EmptyRowPolicyPad EmptyRowPolicy = "pad"
+	// EmptyRowPolicyKeep passes blank rows through untouched
+	EmptyRowPolicyKeep EmptyRowPolicy = "keep"
+	// EmptyRowPolicyDrop removes blank rows from the output
+	EmptyRowPolicyDrop EmptyRowPolicy = "drop"
+)
+
+// IsValid reports whether the policy is one of the known values
+func (p EmptyRowPolicy) IsValid() bool {
+	switch p {
+	case EmptyRowPolicyPad, EmptyRowPolicyKeep, EmptyRowPolicyDrop:
+		return true
+	}
+	return false
+}
+
+// LongRowPolicy controls what happens to the cells of rows wider than the header
+type LongRowPolicy string
+
+const (
+	// LongRowPolicyExtend keeps every cell, adding columns named column_<n> to the
+	// header until it is as wide as the widest row
+	LongRowPolicyExtend LongRowPolicy = "extend"
+	// LongRowPolicyTruncate drops the cells past the header's width. The rows
+	// are counted in the job summary, and their cells still count as emails.
+	LongRowPolicyTruncate LongRowPolicy = "truncate"
+)
+
+// IsValid reports whether the policy is one of the known values
+func (p LongRowPolicy) IsValid() bool {
+	switch p {
+	case LongRowPolicyExtend, LongRowPolicyTruncate:
+		return true
+	}
+	return false
+}
+
+// ProcessingOptions holds the settings a job is processed with
+type ProcessingOptions struct {
+	EmptyRows EmptyRowPolicy `json:"empty_rows,omitempty"`
+	// LongRows decides what to do with rows wider than the header, extend when empty
+	LongRows LongRowPolicy `json:"long_rows,omitempty"`
+	// Sheet selects the worksheet of a spreadsheet upload by name or 1-based index
+	Sheet string `json:"sheet,omitempty"`
+	// CallbackURL receives a webhook when the job completes, fails or is cancelled
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// JobSummary contains row counts collected while processing a job
+type JobSummary struct {
+	TotalRows        int `json:"total_rows"`
+	RowsWithEmail    int `json:"rows_with_email"`
+	RowsWithoutEmail int `json:"rows_without_email"`
+	EmptyRows        int `json:"empty_rows"`
+	TruncatedRows    int `json:"truncated_rows"`
+}
+
+// JobProgress reports how many of a job's data rows have been processed
+type JobProgress struct {
+	RowsProcessed int `json:"rows_processed"`
+	TotalRows     int `json:"total_rows"`
+}
+
+// JobEventType distinguishes the events recorded for a job
+type JobEventType string
+
+const (
+	// JobEventStatus is recorded when a job is created and whenever its status changes
+	JobEventStatus JobEventType = "status"
+	// JobEventProgress is recorded periodically while a job is processed
+	JobEventProgress JobEventType = "progress"
+)
+
+// JobEvent is something that happened to a job, with the job as it was right
+// after. IDs count up from 1 for each job.
+type JobEvent struct {
+	ID             int64        `json:"id"`
+	Type           JobEventType `json:"type"`
+	PreviousStatus JobStatus    `json:"previous_status,omitempty"` // for status changes
+	Job            Job          `json:"job"`
+	Time           time.Time    `json:"time"`
+}
+
+// WebSocket actions sent by clients
+const (
+	WebSocketSubscribe   = "subscribe"
+	WebSocketUnsubscribe = "unsubscribe"
+)
+
+// WebSocket message types sent to clients
+const (
+	WebSocketEvent         = "event"
+	WebSocketSubscriptions = "subscriptions"
+	WebSocketHeartbeat     = "heartbeat"
+	WebSocketError         = "error"
+)
+
+// WebSocketRequest changes what a WebSocket client is subscribed to: jobs by ID,
+// and every job whose status is one of Statuses
+type WebSocketRequest struct {
+	Action   string      `json:"action"`
+	JobIDs   []string    `json:"job_ids,omitempty"`
+	Statuses []JobStatus `json:"statuses,omitempty"`
+}
+
+// WebSocketMessage is sent to WebSocket clients. Event is set for events,
+// JobIDs and Statuses list everything subscribed to after a change, and Dropped
+// counts progress events skipped because the client fell behind.
+type WebSocketMessage struct {
+	Type     string      `json:"type"`
+	Event    *JobEvent   `json:"event,omitempty"`
+	JobIDs   []string    `json:"job_ids,omitempty"`
+	Statuses []JobStatus `json:"statuses,omitempty"`
+	Dropped  int64       `json:"dropped,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Time     *time.Time  `json:"time,omitempty"`
+}
+
 // Job represents a file processing job
 type Job struct {
-	ID            string     `json:"id"`
-	Status        JobStatus  `json:"status"`
-	OriginalFile  string     `json:"original_file"`
-	ProcessedFile string     `json:"processed_file,omitempty"`
-	ErrorMessage  string     `json:"error_message,omitempty"`
-	CreatedAt     time.Time  `json:"created_at"`
-	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	ID               string            `json:"id"`
+	Status           JobStatus         `json:"status"`
+	Filename         string            `json:"filename,omitempty"`
+	OriginalFile     string            `json:"-"` // where the upload is stored, never shown to clients
+	ProcessedFile    string            `json:"-"` // where the result is stored, never shown to clients
+	ErrorMessage     string            `json:"error_message,omitempty"`
+	BatchID          string            `json:"batch_id,omitempty"`
+	Owner            string            `json:"owner,omitempty"`             // tenant of the caller that created the job
+	CreatedBy        string            `json:"created_by,omitempty"`        // API key or token subject that created the job
+	SHA256           string            `json:"sha256,omitempty"`            // hash of the uploaded content, decompressed
+	DeduplicatedFrom string            `json:"deduplicated_from,omitempty"` // job whose result was reused for the same content and options
+	Options          ProcessingOptions `json:"options"`
+	Summary          *JobSummary       `json:"summary,omitempty"`
+	Progress         *JobProgress      `json:"progress,omitempty"` // how far processing has got, while it runs
+	CreatedAt        time.Time         `json:"created_at"`
+	CompletedAt      *time.Time        `json:"completed_at,omitempty"`
 }
 
-// UploadResponse represents the response for file upload
+// UploadResponse represents the response for file upload. Archives produce a
+// batch of jobs instead of a single one. Single files also report the SHA-256
+// of their stored, decompressed content, and streamed uploads its size too.
+// Streamed archives report the size and SHA-256 of the archive received.
 type UploadResponse struct {
+	ID      string   `json:"id,omitempty"`
+	BatchID string   `json:"batch_id,omitempty"`
+	JobIDs  []string `json:"job_ids,omitempty"`
+	Size    int64    `json:"size,omitempty"`
+	SHA256  string   `json:"sha256,omitempty"`
+}
+
+// WebhookPayload is the signed JSON body posted to webhooks when a job finishes
+type WebhookPayload struct {
+	Event     string    `json:"event"` // job.completed, job.failed or job.cancelled
+	Job       Job       `json:"job"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebhookDelivery records one attempt to deliver a job event to a webhook.
+// Retries of the same event share its ID.
+type WebhookDelivery struct {
+	ID          string     `json:"id"`
+	Event       string     `json:"event"`
+	URL         string     `json:"url"`
+	Attempt     int        `json:"attempt"`
+	StatusCode  int        `json:"status_code,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Delivered   bool       `json:"delivered"`
+	AttemptedAt time.Time  `json:"attempted_at"`
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+}
+
+// WebhookDeliveriesResponse lists the webhook delivery attempts made for a job
+type WebhookDeliveriesResponse struct {
+	JobID      string            `json:"job_id"`
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// JobListResponse lists jobs, newest first
+type JobListResponse struct {
+	Jobs []*Job `json:"jobs"`
+}
+
+// BatchResponse represents the jobs created from one archive upload
+type BatchResponse struct {
+	BatchID string `json:"batch_id"`
+	Jobs    []*Job `json:"jobs"`
+}
+
+// CreateUploadRequest starts a resumable upload of a file of known size
+type CreateUploadRequest struct {
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	EmptyRows   string `json:"empty_rows,omitempty"`
+	LongRows    string `json:"long_rows,omitempty"`
+	Sheet       string `json:"sheet,omitempty"`
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// Upload is a resumable upload in progress. Offset is how many bytes have been received.
+type Upload struct {
+	ID        string            `json:"id"`
+	Filename  string            `json:"filename"`
+	Size      int64             `json:"size"`
+	Offset    int64             `json:"offset"`
+	Options   ProcessingOptions `json:"options"`
+	Owner     string            `json:"owner,omitempty"`
+	CreatedBy string            `json:"created_by,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// ValidateResponse represents the response for synchronous validation
+type ValidateResponse struct {
+	Rows    [][]string `json:"rows"`
+	Summary JobSummary `json:"summary"`
+}
+
+// EmailValidationRequest represents a request to validate one or more addresses.
+// Exactly one of Email or Emails should be set.
+type EmailValidationRequest struct {
+	Email  string   `json:"email,omitempty"`
+	Emails []string `json:"emails,omitempty"`
+}
+
+// EmailValidationResult describes the validation outcome for a single address
+type EmailValidationResult struct {
+	Email      string `json:"email"`
+	Valid      bool   `json:"valid"`
+	Strict     bool   `json:"strict"`
+	Reason     string `json:"reason,omitempty"`
+	Normalized string `json:"normalized"`
+}
+
+// EmailValidationResponse represents the response for batch email validation
+type EmailValidationResponse struct {
+	Results []EmailValidationResult `json:"results"`
+}
+
+// HealthResponse reports that the service is up
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// Readiness statuses
+const (
+	ReadinessReady    = "ready"
+	ReadinessNotReady = "not_ready"
+)
+
+// Check statuses
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+)
+
+// ReadinessResponse reports whether the service can take work, with the result
+// of every check keyed by its name
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// CheckResult is the outcome of one readiness check. Details holds the
+// measurements it was based on, such as free bytes or active jobs.
+type CheckResult struct {
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	DurationMs int64            `json:"duration_ms"`
+	Details    map[string]int64 `json:"details,omitempty"`
+}
+
+// RoleAdmin lets a caller see and manage the jobs of every tenant
+const RoleAdmin = "admin"
+
+// APIKey is an API key as stored in the keys file. Only the SHA-256 of the key
+// itself is kept. The key's ID is its tenant, and its scopes are its roles.
+type APIKey struct {
+	ID     string   `json:"id"`
+	SHA256 string   `json:"sha256"` // hex
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// Identity is who a request was authenticated as, by API key or bearer token
+type Identity struct {
+	Tenant  string // owns the jobs and uploads the request creates
+	Subject string // the key ID, or the sub claim of a token
+	Roles   []string
+}
+
+// HasRole reports whether the identity was granted role
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantLimits caps what one tenant may use. Zero means unlimited.
+type TenantLimits struct {
+	MaxFileSize       int64 `json:"max_file_size,omitempty"`
+	MaxConcurrentJobs int64 `json:"max_concurrent_jobs,omitempty"`
+	MaxStorageBytes   int64 `json:"max_storage_bytes,omitempty"`
+	MaxJobsPerDay     int64 `json:"max_jobs_per_day,omitempty"`
+}
+
+// Tenant is an entry of the tenants file, overriding the default limits for
+// one tenant. Limits left out use the default; negative ones are unlimited.
+type Tenant struct {
 	ID string `json:"id"`
+	TenantLimits
 }
 
 // ErrorResponse represents an error response
@@ -35,6 +355,14 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// QuotaErrorResponse is returned when a request would take a tenant over one
+// of its limits
+type QuotaErrorResponse struct {
+	Error string `json:"error"`
+	Quota string `json:"quota"` // the limit, named as in the tenants file
+	Limit int64  `json:"limit"`
+}
+
 // FileInfo contains information about uploaded file
 type FileInfo struct {
 	Filename string
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"csv-validator/internal/utils"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ratioGraceBytes is how much a compressed upload may expand to before the
+// expansion ratio is enforced, so tiny but repetitive files are not rejected
+const ratioGraceBytes = 1024 * 1024
+
+// ArchiveLimits bounds how far a compressed upload may expand
+type ArchiveLimits struct {
+	// MaxTotalSize caps the decompressed bytes across all files in the upload
+	MaxTotalSize int64
+	// MaxRatio caps decompressed bytes per compressed byte for each file
+	MaxRatio int64
+	// MaxEntries caps how many CSVs a zip archive may contain
+	MaxEntries int
+}
+
+// ExtractedFile is a CSV unpacked from a zip archive
+type ExtractedFile struct {
+	Name string
+	StoredFile
+}
+
+// SaveDecompressedFile decompresses a .csv.gz or .csv.zst upload into the upload directory
+func (fs *FileService) SaveDecompressedFile(file *multipart.FileHeader, limits ArchiveLimits) (StoredFile, error) {
+	src, err := file.Open()
+	if err != nil {
+		return StoredFile{}, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	return fs.SaveDecompressed(src, file.Filename, limits)
+}
+
+// SaveDecompressed decompresses a .csv.gz or .csv.zst stream named name into the
+// upload directory. The decompressed content is what gets hashed and stored.
+func (fs *FileService) SaveDecompressed(src io.Reader, name string, limits ArchiveLimits) (StoredFile, error) {
+	compressed := &countingReader{r: src}
+
+	var reader io.Reader
+	switch lower := strings.ToLower(name); {
+	case strings.HasSuffix(lower, utils.ExtGzipCSV):
+		gz, err := gzip.NewReader(compressed)
+		if err != nil {
+			return StoredFile{}, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		defer gz.Close()
+		reader = gz
+	case strings.HasSuffix(lower, utils.ExtZstdCSV):
+		var opts []zstd.DOption
+		if limits.MaxTotalSize > 0 {
+			opts = append(opts, zstd.WithDecoderMaxMemory(uint64(limits.MaxTotalSize)))
+		}
+		zr, err := zstd.NewReader(compressed, opts...)
+		if err != nil {
+			return StoredFile{}, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return StoredFile{}, ErrInvalidFileType
+	}
+
+	name = name[:len(name)-len(filepath.Ext(name))]
+	return fs.writeDecompressed(name, reader, compressed.Count, limits.MaxRatio, limits.MaxTotalSize)
+}
+
+// ExtractArchive unpacks every CSV in a zip upload into the upload directory,
+// enforcing the limits on each entry and on the archive as a whole
+func (fs *FileService) ExtractArchive(file *multipart.FileHeader, limits ArchiveLimits) ([]ExtractedFile, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	return fs.ExtractArchiveFrom(src, file.Size, limits)
+}
+
+// ExtractArchiveFrom unpacks every CSV in the zip archive read from src, as ExtractArchive does
+func (fs *FileService) ExtractArchiveFrom(src io.ReaderAt, size int64, limits ArchiveLimits) ([]ExtractedFile, error) {
+	archive, err := zip.NewReader(src, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	var extracted []ExtractedFile
+	cleanup := func() {
+		for _, f := range extracted {
+			fs.Discard(f.StoredFile)
+		}
+	}
+
+	remaining := limits.MaxTotalSize
+	for _, entry := range archive.File {
+		name := filepath.Base(filepath.FromSlash(entry.Name))
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, ".") ||
+			strings.HasPrefix(entry.Name, "__MACOSX/") || !strings.HasSuffix(strings.ToLower(name), ".csv") {
+			continue
+		}
+
+		if limits.MaxEntries > 0 && len(extracted) >= limits.MaxEntries {
+			cleanup()
+			return nil, fmt.Errorf("%w: more than %d CSV files", ErrArchiveTooLarge, limits.MaxEntries)
+		}
+
+		// The earlier files used up the whole budget; a limit of 0 below would mean none at all
+		if limits.MaxTotalSize > 0 && remaining <= 0 {
+			cleanup()
+			return nil, fmt.Errorf("%w: decompressed size exceeds %d bytes", ErrArchiveTooLarge, limits.MaxTotalSize)
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		compressedSize := int64(entry.CompressedSize64)
+		stored, err := fs.writeDecompressed(name, rc, func() int64 { return compressedSize }, limits.MaxRatio, remaining)
+		rc.Close()
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+
+		remaining -= stored.Size
+		extracted = append(extracted, ExtractedFile{Name: utils.SanitizeFilename(name), StoredFile: stored})
+	}
+
+	if len(extracted) == 0 {
+		return nil, ErrArchiveEmpty
+	}
+
+	return extracted, nil
+}
+
+// writeDecompressed stores what is read from r as the content of a file named
+// name, failing with ErrArchiveTooLarge as soon as the output exceeds maxSize or
+// expands more than maxRatio times the compressed input. Nothing is stored on failure.
+func (fs *FileService) writeDecompressed(name string, r io.Reader, compressedSize func() int64, maxRatio, maxSize int64) (StoredFile, error) {
+	return fs.putContent(name, func(w io.Writer) error {
+		_, err := copyWithLimits(w, r, compressedSize, maxRatio, maxSize)
+		return err
+	})
+}
+
+// copyWithLimits is io.Copy with the expansion checks of writeDecompressed
+func copyWithLimits(dst io.Writer, r io.Reader, compressedSize func() int64, maxRatio, maxSize int64) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var written int64
+
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			written += int64(n)
+
+			if maxSize > 0 && written > maxSize {
+				return written, fmt.Errorf("%w: decompressed size exceeds %d bytes", ErrArchiveTooLarge, maxSize)
+			}
+			if maxRatio > 0 && written > ratioGraceBytes && written > maxRatio*compressedSize() {
+				return written, fmt.Errorf("%w: expansion ratio exceeds %d", ErrArchiveTooLarge, maxRatio)
+			}
+
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return written, fmt.Errorf("failed to write file: %w", err)
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return written, nil
+		}
+		if readErr != nil {
+			// Keep the cause visible so limits enforced by the source, such as ErrFileTooLarge, still match
+			return written, fmt.Errorf("%w: %w", ErrInvalidArchive, readErr)
+		}
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Count returns the number of bytes read so far
+func (c *countingReader) Count() int64 {
+	return c.n
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	iofs "io/fs"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLimits = ArchiveLimits{MaxTotalSize: 10 * 1024 * 1024, MaxRatio: 100, MaxEntries: 5}
+
+func makeFileHeader(t *testing.T, name string, content []byte) *multipart.FileHeader {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", name)
+	require.NoError(t, err)
+	part.Write(content)
+	writer.Close()
+
+	reader := multipart.NewReader(bytes.NewReader(body.Bytes()), writer.Boundary())
+	form, err := reader.ReadForm(1024 * 1024)
+	require.NoError(t, err)
+	return form.File["file"][0]
+}
+
+func gzipBytes(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte(content))
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestFileService_SaveDecompressedFile_Gzip(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+
+	content := []byte("name,email\nChirag,Chirag@example.com\n")
+	header := makeFileHeader(t, "export.csv.gz", gzipBytes(t, content))
+
+	stored, err := fs.SaveDecompressedFile(header, testLimits)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(stored.Path, ".csv"))
+	assert.Equal(t, int64(len(content)), stored.Size)
+
+	// The hash is of the decompressed content
+	sum := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(sum[:]), stored.SHA256)
+
+	saved, err := os.ReadFile(stored.Path)
+	require.NoError(t, err)
+	assert.Equal(t, content, saved)
+}
+
+func TestFileService_SaveDecompressedFile_Zstd(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+
+	content := []byte("name,email\nYash,Yash@test.com\n")
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	header := makeFileHeader(t, "export.csv.zst", encoder.EncodeAll(content, nil))
+
+	stored, err := fs.SaveDecompressedFile(header, testLimits)
+	require.NoError(t, err)
+
+	saved, err := os.ReadFile(stored.Path)
+	require.NoError(t, err)
+	assert.Equal(t, content, saved)
+}
+
+func TestFileService_SaveDecompressedFile_Bomb(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+
+	// 8MB of zeros compresses to a few KB, far beyond a 100x ratio
+	header := makeFileHeader(t, "bomb.csv.gz", gzipBytes(t, make([]byte, 8*1024*1024)))
+
+	_, err := fs.SaveDecompressedFile(header, testLimits)
+	assert.ErrorIs(t, err, ErrArchiveTooLarge)
+
+	// Nothing is left behind
+	entries, _ := os.ReadDir(tempDir)
+	for _, entry := range entries {
+		assert.True(t, entry.IsDir(), "unexpected file %s", entry.Name())
+	}
+
+	// The total size limit applies too
+	limits := ArchiveLimits{MaxTotalSize: 1024}
+	header = makeFileHeader(t, "big.csv.gz", gzipBytes(t, []byte(strings.Repeat("a,b\n", 1024))))
+	_, err = fs.SaveDecompressedFile(header, limits)
+	assert.ErrorIs(t, err, ErrArchiveTooLarge)
+}
+
+func TestFileService_SaveDecompressedFile_Corrupt(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+
+	header := makeFileHeader(t, "broken.csv.gz", []byte("not gzip at all"))
+
+	_, err := fs.SaveDecompressedFile(header, testLimits)
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+}
+
+func TestFileService_ExtractArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+
+	archive := zipBytes(t, map[string]string{
+		"a.csv":              "name,email\nChirag,Chirag@example.com\n",
+		"nested/b.csv":       "name,email\nYash,Yash@test.com\n",
+		"nested/notes.txt":   "ignored",
+		"__MACOSX/._a.csv":   "ignored",
+		"../../escape.csv":   "name\nsafe\n",
+		"nested/.hidden.csv": "ignored",
+	})
+	header := makeFileHeader(t, "exports.zip", archive)
+
+	extracted, err := fs.ExtractArchive(header, testLimits)
+	require.NoError(t, err)
+	require.Len(t, extracted, 3)
+
+	names := []string{}
+	for _, f := range extracted {
+		names = append(names, f.Name)
+		assert.True(t, strings.HasPrefix(f.Path, filepath.Join(tempDir, "sha256")))
+		assert.FileExists(t, f.Path)
+	}
+	assert.ElementsMatch(t, []string{"a.csv", "b.csv", "escape.csv"}, names)
+}
+
+func TestFileService_ExtractArchive_Limits(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+
+	// No CSVs at all
+	header := makeFileHeader(t, "empty.zip", zipBytes(t, map[string]string{"readme.txt": "hi"}))
+	_, err := fs.ExtractArchive(header, testLimits)
+	assert.ErrorIs(t, err, ErrArchiveEmpty)
+
+	// Too many entries
+	files := map[string]string{}
+	for _, name := range []string{"1.csv", "2.csv", "3.csv"} {
+		files[name] = "a\n1\n"
+	}
+	header = makeFileHeader(t, "many.zip", zipBytes(t, files))
+	_, err = fs.ExtractArchive(header, ArchiveLimits{MaxEntries: 2})
+	assert.ErrorIs(t, err, ErrArchiveTooLarge)
+
+	// Total size across entries
+	files = map[string]string{"1.csv": strings.Repeat("a", 600), "2.csv": strings.Repeat("b", 600)}
+	header = makeFileHeader(t, "big.zip", zipBytes(t, files))
+	_, err = fs.ExtractArchive(header, ArchiveLimits{MaxTotalSize: 1000})
+	assert.ErrorIs(t, err, ErrArchiveTooLarge)
+
+	// Files after one that uses up the total size exactly
+	_, err = fs.ExtractArchive(header, ArchiveLimits{MaxTotalSize: 600})
+	assert.ErrorIs(t, err, ErrArchiveTooLarge)
+
+	// Partially extracted files are cleaned up
+	filepath.WalkDir(tempDir, func(path string, entry iofs.DirEntry, err error) error {
+		assert.True(t, entry.IsDir(), "unexpected file %s", path)
+		return nil
+	})
+
+	// Not a zip
+	header = makeFileHeader(t, "fake.zip", []byte("name,email\n"))
+	_, err = fs.ExtractArchive(header, testLimits)
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+}
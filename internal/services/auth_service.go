@@ -0,0 +1,133 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"csv-validator/internal/models"
+)
+
+// APIKeyStore looks up API keys by the SHA-256 of the key
+type APIKeyStore interface {
+	// FindAPIKey returns the key whose hex SHA-256 is hash
+	FindAPIKey(hash string) (models.APIKey, bool)
+}
+
+// MemoryAPIKeyStore is an APIKeyStore holding a fixed set of keys
+type MemoryAPIKeyStore struct {
+	keys map[string]models.APIKey
+}
+
+// NewMemoryAPIKeyStore validates keys and indexes them by hash. IDs and hashes
+// must be unique and admin is the only scope.
+func NewMemoryAPIKeyStore(keys []models.APIKey) (*MemoryAPIKeyStore, error) {
+	store := &MemoryAPIKeyStore{keys: make(map[string]models.APIKey, len(keys))}
+	ids := make(map[string]bool, len(keys))
+
+	for i, key := range keys {
+		key.SHA256 = strings.ToLower(key.SHA256)
+
+		if key.ID == "" {
+			return nil, fmt.Errorf("key %d has no id", i+1)
+		}
+		if ids[key.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		if hash, err := hex.DecodeString(key.SHA256); err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("key %q: sha256 must be 64 hex characters", key.ID)
+		}
+		if _, exists := store.keys[key.SHA256]; exists {
+			return nil, fmt.Errorf("key %q: sha256 is used by another key", key.ID)
+		}
+		for _, scope := range key.Scopes {
+			if scope != models.RoleAdmin {
+				return nil, fmt.Errorf("key %q: unknown scope %q", key.ID, scope)
+			}
+		}
+
+		ids[key.ID] = true
+		store.keys[key.SHA256] = key
+	}
+
+	return store, nil
+}
+
+// LoadAPIKeyFile reads keys from a JSON file of the form
+// {"keys": [{"id": "...", "sha256": "...", "scopes": ["admin"]}]}
+func LoadAPIKeyFile(path string) (*MemoryAPIKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	var file struct {
+		Keys []models.APIKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys: %w", err)
+	}
+
+	store, err := NewMemoryAPIKeyStore(file.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API keys file %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// FindAPIKey returns the key whose hex SHA-256 is hash
+func (s *MemoryAPIKeyStore) FindAPIKey(hash string) (models.APIKey, bool) {
+	key, exists := s.keys[hash]
+	return key, exists
+}
+
+// Len returns the number of keys in the store
+func (s *MemoryAPIKeyStore) Len() int {
+	return len(s.keys)
+}
+
+// HashAPIKey returns the hex SHA-256 under which key is stored. Keys are long
+// random strings, so a fast unsalted hash is enough to keep them secret at rest.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthService authenticates requests by API key or bearer token
+type AuthService struct {
+	keys   APIKeyStore
+	tokens *JWTVerifier
+}
+
+// NewAuthService creates an auth service checking API keys against keys and
+// bearer tokens with tokens. Either may be nil to turn that method off.
+func NewAuthService(keys APIKeyStore, tokens *JWTVerifier) *AuthService {
+	return &AuthService{keys: keys, tokens: tokens}
+}
+
+// AuthenticateAPIKey returns the identity of the holder of key, or ErrInvalidAPIKey
+func (as *AuthService) AuthenticateAPIKey(key string) (models.Identity, error) {
+	if key == "" || as.keys == nil {
+		return models.Identity{}, ErrInvalidAPIKey
+	}
+
+	stored, exists := as.keys.FindAPIKey(HashAPIKey(key))
+	if !exists {
+		return models.Identity{}, ErrInvalidAPIKey
+	}
+
+	return models.Identity{Tenant: stored.ID, Subject: stored.ID, Roles: stored.Scopes}, nil
+}
+
+// AuthenticateBearer returns the identity behind a bearer credential. JWTs are
+// verified as tokens when token authentication is on; anything else is taken
+// to be an API key.
+func (as *AuthService) AuthenticateBearer(credential string) (models.Identity, error) {
+	if as.tokens != nil && strings.Count(credential, ".") == 2 {
+		return as.tokens.Verify(credential)
+	}
+	return as.AuthenticateAPIKey(credential)
+}
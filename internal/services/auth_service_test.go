@@ -0,0 +1,99 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"csv-validator/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashAPIKey(t *testing.T) {
+	// Matches: printf secret | sha256sum
+	assert.Equal(t, "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", HashAPIKey("secret"))
+}
+
+func TestAuthService_Authenticate(t *testing.T) {
+	store, err := NewMemoryAPIKeyStore([]models.APIKey{
+		{ID: "acme", SHA256: HashAPIKey("acme-key")},
+		{ID: "ops", SHA256: strings.ToUpper(HashAPIKey("ops-key")), Scopes: []string{models.RoleAdmin}},
+	})
+	require.NoError(t, err)
+	auth := NewAuthService(store, nil)
+
+	identity, err := auth.AuthenticateAPIKey("acme-key")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", identity.Tenant)
+	assert.Equal(t, "acme", identity.Subject)
+	assert.False(t, identity.HasRole(models.RoleAdmin))
+
+	identity, err = auth.AuthenticateBearer("ops-key")
+	require.NoError(t, err)
+	assert.Equal(t, "ops", identity.Tenant)
+	assert.True(t, identity.HasRole(models.RoleAdmin))
+
+	_, err = auth.AuthenticateAPIKey("wrong-key")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = auth.AuthenticateAPIKey("")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// Without token verification, JWTs are just unknown API keys
+	_, err = auth.AuthenticateBearer("eyJhbGciOiJSUzI1NiJ9.e30.c2ln")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// Without API keys, none is valid
+	_, err = NewAuthService(nil, nil).AuthenticateAPIKey("acme-key")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+func TestNewMemoryAPIKeyStore_Invalid(t *testing.T) {
+	hash := HashAPIKey("key")
+
+	tests := []struct {
+		name string
+		keys []models.APIKey
+		want string
+	}{
+		{"no id", []models.APIKey{{SHA256: hash}}, "no id"},
+		{"bad hash", []models.APIKey{{ID: "a", SHA256: "abc"}}, "64 hex"},
+		{"plain key", []models.APIKey{{ID: "a", SHA256: "key"}}, "64 hex"},
+		{"duplicate id", []models.APIKey{{ID: "a", SHA256: hash}, {ID: "a", SHA256: HashAPIKey("other")}}, "duplicate"},
+		{"duplicate hash", []models.APIKey{{ID: "a", SHA256: hash}, {ID: "b", SHA256: hash}}, "another key"},
+		{"unknown scope", []models.APIKey{{ID: "a", SHA256: hash, Scopes: []string{"root"}}}, "unknown scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMemoryAPIKeyStore(tt.keys)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestLoadAPIKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys.json")
+
+	content := `{"keys": [{"id": "acme", "sha256": "` + HashAPIKey("acme-key") + `"}]}`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	store, err := LoadAPIKeyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+
+	key, found := store.FindAPIKey(HashAPIKey("acme-key"))
+	assert.True(t, found)
+	assert.Equal(t, "acme", key.ID)
+
+	_, err = LoadAPIKeyFile(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("acme-key"), 0600))
+	_, err = LoadAPIKeyFile(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ContentEncoding is a compression a download can be delivered with
+type ContentEncoding string
+
+const (
+	EncodingIdentity ContentEncoding = "identity"
+	EncodingGzip     ContentEncoding = "gzip"
+	EncodingZstd     ContentEncoding = "zstd"
+)
+
+// ExtGzip is appended to processed files stored compressed on disk
+const ExtGzip = ".gz"
+
+// ParseContentEncoding validates an encoding name such as "gzip". An empty
+// name or "none" means no compression.
+func ParseContentEncoding(name string) (ContentEncoding, error) {
+	switch encoding := ContentEncoding(strings.ToLower(strings.TrimSpace(name))); encoding {
+	case "", "none", EncodingIdentity:
+		return EncodingIdentity, nil
+	case EncodingGzip, EncodingZstd:
+		return encoding, nil
+	default:
+		return "", fmt.Errorf("unsupported compression %q", name)
+	}
+}
+
+// NegotiateEncoding picks the compression to use from an Accept-Encoding header.
+// The coding with the highest q-value wins, gzip on ties; identity is returned
+// when the client accepts neither gzip nor zstd.
+func NegotiateEncoding(acceptEncoding string) ContentEncoding {
+	weights := map[ContentEncoding]float64{}
+	wildcard := -1.0
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		weight := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				weight = q
+			}
+		}
+
+		if coding == "*" {
+			wildcard = weight
+		} else {
+			weights[ContentEncoding(coding)] = weight
+		}
+	}
+
+	best, bestWeight := EncodingIdentity, 0.0
+	for _, encoding := range []ContentEncoding{EncodingGzip, EncodingZstd} {
+		weight, listed := weights[encoding]
+		if !listed {
+			weight = wildcard
+		}
+		if weight > bestWeight {
+			best, bestWeight = encoding, weight
+		}
+	}
+
+	return best
+}
+
+// Extension returns the file suffix for data in this encoding
+func (e ContentEncoding) Extension() string {
+	switch e {
+	case EncodingGzip:
+		return ExtGzip
+	case EncodingZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// ContentType returns the MIME type of a file compressed with this encoding
+func (e ContentEncoding) ContentType() string {
+	switch e {
+	case EncodingGzip:
+		return "application/gzip"
+	case EncodingZstd:
+		return "application/zstd"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// NewEncoder wraps w so that everything written is compressed with the given
+// encoding. The returned writer must be closed to flush the compressed stream;
+// closing it does not close w.
+func NewEncoder(w io.Writer, encoding ContentEncoding) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingZstd:
+		return zstd.NewWriter(w)
+	case EncodingIdentity:
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", encoding)
+	}
+}
+
+// StoredEncoding reports how a processed file is compressed on disk
+func StoredEncoding(path string) ContentEncoding {
+	if strings.HasSuffix(path, ExtGzip) {
+		return EncodingGzip
+	}
+	return EncodingIdentity
+}
+
+// OpenProcessedFile opens a processed file for reading, transparently
+// decompressing it if it was stored compressed
+func (fs *FileService) OpenProcessedFile(path string) (io.ReadCloser, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if StoredEncoding(path) != EncodingGzip {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open compressed file: %w", err)
+	}
+
+	return &gzipFile{Reader: gz, file: file}, nil
+}
+
+// gzipFile closes both the gzip stream and the file underneath it
+type gzipFile struct {
+	*gzip.Reader
+	file io.Closer
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// nopWriteCloser adds a no-op Close to an io.Writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
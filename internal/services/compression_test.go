@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContentEncoding(t *testing.T) {
+	for name, expected := range map[string]ContentEncoding{
+		"":         EncodingIdentity,
+		"none":     EncodingIdentity,
+		"identity": EncodingIdentity,
+		"GZIP":     EncodingGzip,
+		" zstd ":   EncodingZstd,
+	} {
+		encoding, err := ParseContentEncoding(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, encoding, name)
+	}
+
+	_, err := ParseContentEncoding("br")
+	assert.Error(t, err)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected ContentEncoding
+	}{
+		{"", EncodingIdentity},
+		{"gzip", EncodingGzip},
+		{"zstd", EncodingZstd},
+		{"gzip, deflate, br, zstd", EncodingGzip},
+		{"gzip;q=0.5, zstd", EncodingZstd},
+		{"gzip;q=0, zstd;q=0", EncodingIdentity},
+		{"br, deflate", EncodingIdentity},
+		{"*", EncodingGzip},
+		{"*;q=0.1, gzip;q=0", EncodingZstd},
+		{"identity", EncodingIdentity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NegotiateEncoding(tt.header))
+		})
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	content := []byte("name,email,has_email\nChirag,Chirag@example.com,true\n")
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(&buf, EncodingGzip)
+	require.NoError(t, err)
+	encoder.Write(content)
+	require.NoError(t, encoder.Close())
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, content, decoded)
+
+	buf.Reset()
+	encoder, err = NewEncoder(&buf, EncodingZstd)
+	require.NoError(t, err)
+	encoder.Write(content)
+	require.NoError(t, encoder.Close())
+
+	decoder, err := zstd.NewReader(&buf)
+	require.NoError(t, err)
+	defer decoder.Close()
+	decoded, err = io.ReadAll(decoder)
+	require.NoError(t, err)
+	assert.Equal(t, content, decoded)
+
+	buf.Reset()
+	encoder, err = NewEncoder(&buf, EncodingIdentity)
+	require.NoError(t, err)
+	encoder.Write(content)
+	require.NoError(t, encoder.Close())
+	assert.Equal(t, content, buf.Bytes())
+}
+
+func TestOpenProcessedFile(t *testing.T) {
+	tempDir := t.TempDir()
+	content := []byte("name,has_email\nChirag,false\n")
+
+	plain := filepath.Join(tempDir, "processed.csv")
+	require.NoError(t, os.WriteFile(plain, content, 0644))
+
+	compressed := filepath.Join(tempDir, "processed.csv.gz")
+	file, err := os.Create(compressed)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	gz.Write(content)
+	require.NoError(t, gz.Close())
+	require.NoError(t, file.Close())
+
+	fs := NewFileService(tempDir, tempDir)
+
+	assert.Equal(t, EncodingIdentity, StoredEncoding(plain))
+	assert.Equal(t, EncodingGzip, StoredEncoding(compressed))
+
+	for _, path := range []string{plain, compressed} {
+		reader, err := fs.OpenProcessedFile(path)
+		require.NoError(t, err)
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Equal(t, content, data, path)
+	}
+
+	_, err = fs.OpenProcessedFile(filepath.Join(tempDir, "missing.csv"))
+	assert.Error(t, err)
+}
@@ -1,21 +1,42 @@
 package services
 
 import (
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	"csv-validator/internal/metrics"
 	"csv-validator/internal/models"
+	"csv-validator/internal/spreadsheet"
+	"csv-validator/internal/tracing"
 	"csv-validator/internal/utils"
 	"csv-validator/pkg/logger"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// progressInterval is the least time between progress updates of a job
+const progressInterval = time.Second
+
 // CSVService handles CSV file processing
 type CSVService struct {
 	fileService *FileService
 	jobService  *JobService
+
+	progressInterval time.Duration
+	// workbookLimits bounds how far the parts of an uploaded workbook may inflate
+	workbookLimits ArchiveLimits
+
+	// cancels holds the cancel function of every job being processed
+	cancels map[string]context.CancelFunc
+	mu      sync.Mutex
 }
 
 // NewCSVService creates a new CSV service
@@ -23,22 +44,78 @@ func NewCSVService(fileService *FileService, jobService *JobService) *CSVService
 	return &CSVService{
 		fileService: fileService,
 		jobService:  jobService,
+
+		progressInterval: progressInterval,
+		cancels:          make(map[string]context.CancelFunc),
 	}
 }
 
-// ProcessFile processes a CSV file asynchronously
-func (cs *CSVService) ProcessFile(jobID string) {
+// SetWorkbookLimits sets how far the parts of a workbook may inflate. Workbooks
+// are zip archives, so they share the limits of compressed uploads; MaxTotalSize
+// caps each part and MaxEntries does not apply.
+func (cs *CSVService) SetWorkbookLimits(limits ArchiveLimits) {
+	cs.workbookLimits = limits
+}
+
+// ProcessFile processes a CSV file asynchronously. ctx is the context of the
+// request starting the job: its logger, with the job ID added, logs the
+// processing, and the processing span is a child of its span, so a trace shows
+// the upload and its processing together. Processing outlives the request, so
+// it isn't cancelled with it.
+func (cs *CSVService) ProcessFile(ctx context.Context, jobID string) {
+	ctx = logger.NewContext(context.WithoutCancel(ctx), "job_id", jobID)
+	ctx, cancel := context.WithCancel(ctx)
+
+	cs.mu.Lock()
+	cs.cancels[jobID] = cancel
+	cs.mu.Unlock()
+
 	// Start processing in a goroutine
 	go func() {
-		if err := cs.processFileSync(jobID); err != nil {
-			logger.Error(fmt.Sprintf("Failed to process file for job %s: %v", jobID, err))
+		defer func() {
+			cs.mu.Lock()
+			delete(cs.cancels, jobID)
+			cs.mu.Unlock()
+			cancel()
+		}()
+
+		ctx, span := tracing.Tracer().Start(ctx, "CSVService.ProcessFile",
+			trace.WithAttributes(attribute.String("job.id", jobID)))
+
+		err := cs.processFileSync(ctx, jobID)
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrJobCancelled) || errors.Is(err, context.Canceled):
+			logger.FromContext(ctx).Info("Stopped processing cancelled job")
+			span.SetAttributes(attribute.Bool("job.cancelled", true))
+			err = nil
+		default:
+			logger.FromContext(ctx).Error("Failed to process file", "error", err)
 			cs.jobService.UpdateJobError(jobID, err.Error())
 		}
+		tracing.End(span, err)
 	}()
 }
 
-// processFileSync processes a CSV file synchronously
-func (cs *CSVService) processFileSync(jobID string) error {
+// CancelJob cancels a pending or processing job and stops its processing
+func (cs *CSVService) CancelJob(ctx context.Context, jobID string) (*models.Job, error) {
+	job, err := cs.jobService.CancelJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	if cancel, running := cs.cancels[jobID]; running {
+		cancel()
+	}
+	cs.mu.Unlock()
+
+	logger.FromContext(ctx).Info("Cancelled job", "job_id", jobID)
+	return job, nil
+}
+
+// processFileSync processes a CSV file synchronously, stopping early once ctx is done
+func (cs *CSVService) processFileSync(ctx context.Context, jobID string) error {
 	// Update job status to processing
 	if err := cs.jobService.UpdateJobStatus(jobID, models.JobStatusProcessing); err != nil {
 		return fmt.Errorf("failed to update job status: %w", err)
@@ -50,36 +127,49 @@ func (cs *CSVService) processFileSync(jobID string) error {
 		return ErrJobNotFound
 	}
 
-	// Open original file
-	file, err := os.Open(job.OriginalFile)
-	if err != nil {
-		return fmt.Errorf("failed to open original file: %w", err)
+	if reused, err := cs.reuseResult(ctx, job); reused || err != nil {
+		return err
 	}
-	defer file.Close()
-
-	// Create CSV reader
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1 // Allow variable number of fields
 
-	// Read all records
-	records, err := reader.ReadAll()
+	_, endStage := startStage(ctx, "read")
+	records, err := cs.readJobRecords(job)
+	endStage(err)
 	if err != nil {
-		return fmt.Errorf("failed to read CSV file: %w", err)
+		return err
 	}
 
-	if len(records) == 0 {
-		return fmt.Errorf("CSV file is empty")
+	// Process records
+	stageCtx, endStage := startStage(ctx, "validate")
+	processedRecords, summary, err := cs.processRecords(stageCtx, records, job.Options, cs.progressReporter(jobID, len(records)-1))
+	endStage(err)
+	if err != nil {
+		return err
 	}
 
-	// Process records
-	processedRecords := cs.processRecords(records)
+	// Create processed file path, always a CSV whatever the upload was
+	baseName := filepath.Base(job.OriginalFile)
+	stem := strings.TrimSuffix(baseName, filepath.Ext(baseName))
+	if job.SHA256 != "" {
+		// Uploads of the same content share their path, so name results after
+		// the job; jobs only share a result through reuseResult
+		stem += "_" + job.ID
+	}
+	processedFileName := fmt.Sprintf("processed_%s.csv", stem)
+	if cs.fileService.CompressOutputs() {
+		processedFileName += ExtGzip
+	}
+	processedFilePath := filepath.Join(cs.fileService.ForTenant(job.Owner).GetDownloadDir(), processedFileName)
 
-	// Create processed file path
-	processedFileName := fmt.Sprintf("processed_%s", filepath.Base(job.OriginalFile))
-	processedFilePath := filepath.Join(cs.fileService.GetDownloadDir(), processedFileName)
+	// Don't write a result for a job cancelled in the meantime
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	// Write processed CSV
-	if err := cs.writeProcessedCSV(processedFilePath, processedRecords); err != nil {
+	_, endStage = startStage(ctx, "write")
+	err = cs.writeProcessedCSV(processedFilePath, processedRecords)
+	endStage(err)
+	if err != nil {
 		return fmt.Errorf("failed to write processed CSV: %w", err)
 	}
 
@@ -88,42 +178,238 @@ func (cs *CSVService) processFileSync(jobID string) error {
 		return fmt.Errorf("failed to update job processed file: %w", err)
 	}
 
+	if err := cs.jobService.UpdateJobSummary(jobID, summary); err != nil {
+		return fmt.Errorf("failed to update job summary: %w", err)
+	}
+
 	// Mark job as completed
 	if err := cs.jobService.UpdateJobStatus(jobID, models.JobStatusCompleted); err != nil {
 		return fmt.Errorf("failed to update job status: %w", err)
 	}
 
-	logger.Info(fmt.Sprintf("Successfully processed file for job %s", jobID))
+	logger.FromContext(ctx).Info("Successfully processed file",
+		"rows", summary.TotalRows, "file", processedFilePath)
 	return nil
 }
 
-// processRecords adds email validation flag to CSV records
-func (cs *CSVService) processRecords(records [][]string) [][]string {
+// startStage starts a stage of processing a job, in a span of its own. The
+// returned function ends the span and records how long the stage took, unless
+// it failed.
+func startStage(ctx context.Context, stage string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, stage)
+
+	return ctx, func(err error) {
+		if err == nil {
+			metrics.JobStageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+		}
+		tracing.End(span, err)
+	}
+}
+
+// progressReporter returns a function recording how many of a job's rows have
+// been processed, at most once per progressInterval. The start is always recorded.
+func (cs *CSVService) progressReporter(jobID string, totalRows int) func(rows int) {
+	totalRows = max(totalRows, 0)
+	cs.jobService.UpdateJobProgress(jobID, models.JobProgress{TotalRows: totalRows})
+
+	last := time.Now()
+	return func(rows int) {
+		if time.Since(last) < cs.progressInterval {
+			return
+		}
+		last = time.Now()
+		cs.jobService.UpdateJobProgress(jobID, models.JobProgress{RowsProcessed: rows, TotalRows: totalRows})
+	}
+}
+
+// reuseResult completes a job with the result of an earlier job that processed
+// the same content with the same options, as long as that result is still stored
+func (cs *CSVService) reuseResult(ctx context.Context, job *models.Job) (bool, error) {
+	if job.SHA256 == "" {
+		return false, nil
+	}
+
+	source, found := cs.jobService.FindCompletedDuplicate(job.Owner, job.SHA256, job.Options, job.ID)
+	if !found {
+		return false, nil
+	}
+
+	if _, err := cs.fileService.Stat(source.ProcessedFile); err != nil {
+		return false, nil
+	}
+
+	if err := cs.jobService.CompleteAsDuplicate(job.ID, source); err != nil {
+		return false, fmt.Errorf("failed to complete duplicate job: %w", err)
+	}
+
+	logger.FromContext(ctx).Info("Reused result of earlier job", "source_job_id", source.ID, "sha256", job.SHA256)
+	return true, nil
+}
+
+// ValidateCSV reads CSV data from r and runs it through the same processing as
+// uploaded files, returning the annotated records instead of writing them to disk.
+// Processing stops with the context error once ctx is done.
+func (cs *CSVService) ValidateCSV(ctx context.Context, r io.Reader, options models.ProcessingOptions) ([][]string, models.JobSummary, error) {
+	records, err := cs.readRecords(r)
+	if err != nil {
+		return nil, models.JobSummary{}, err
+	}
+
+	return cs.processRecords(ctx, records, options, nil)
+}
+
+// ValidateRecords processes already parsed rows, the first one being the header
+func (cs *CSVService) ValidateRecords(ctx context.Context, records [][]string, options models.ProcessingOptions) ([][]string, models.JobSummary, error) {
 	if len(records) == 0 {
-		return records
+		return nil, models.JobSummary{}, ErrEmptyCSV
 	}
 
-	result := make([][]string, len(records))
+	return cs.processRecords(ctx, records, options, nil)
+}
 
-	// Add header
-	if len(records) > 0 {
-		header := make([]string, len(records[0])+1)
-		copy(header, records[0])
-		header[len(header)-1] = "has_email"
-		result[0] = header
+// readJobRecords loads the rows of a job's original file, reading the selected
+// sheet for spreadsheet uploads and parsing everything else as CSV
+func (cs *CSVService) readJobRecords(job *models.Job) ([][]string, error) {
+	if spreadsheet.IsSpreadsheet(job.OriginalFile) {
+		records, err := cs.readSpreadsheet(job.OriginalFile, job.Options.Sheet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spreadsheet: %w", err)
+		}
+		if len(records) == 0 {
+			return nil, ErrEmptyCSV
+		}
+		return records, nil
 	}
 
+	// Open original file
+	file, err := cs.fileService.Open(job.OriginalFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open original file: %w", err)
+	}
+	defer file.Close()
+
+	return cs.readRecords(file)
+}
+
+// readSpreadsheet reads a sheet of a stored workbook, which needs random access
+func (cs *CSVService) readSpreadsheet(path, sheet string) ([][]string, error) {
+	file, cleanup, err := cs.fileService.OpenLocal(path)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return spreadsheet.Read(file, info.Size(), path, sheet, spreadsheet.Limits{
+		MaxPartSize: cs.workbookLimits.MaxTotalSize,
+		MaxRatio:    cs.workbookLimits.MaxRatio,
+	})
+}
+
+// readRecords parses all CSV records from r
+func (cs *CSVService) readRecords(r io.Reader) ([][]string, error) {
+	// Create CSV reader
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // Allow variable number of fields
+
+	// Read all records
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV file: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil, ErrEmptyCSV
+	}
+
+	return records, nil
+}
+
+// processRecords adds email validation flag to CSV records and counts the rows it saw.
+// Blank rows are handled according to options.EmptyRows; with EmptyRowPolicyPad every
+// row narrower than the header is padded so the output stays rectangular. Rows wider
+// than the header are handled according to options.LongRows. progress, if set, is
+// called with the number of rows processed so far every thousand rows.
+func (cs *CSVService) processRecords(ctx context.Context, records [][]string, options models.ProcessingOptions, progress func(rows int)) ([][]string, models.JobSummary, error) {
+	var summary models.JobSummary
+
+	if len(records) == 0 {
+		return records, summary, nil
+	}
+
+	policy := options.EmptyRows
+	if policy == "" {
+		policy = models.EmptyRowPolicyPad
+	}
+	truncate := options.LongRows == models.LongRowPolicyTruncate
+
+	result := make([][]string, 0, len(records))
+
+	// Add header, named out to the widest row unless long rows are cut down to it
+	width := len(records[0])
+	if !truncate {
+		for _, row := range records[1:] {
+			if len(row) > width && !cs.isEmptyRow(row) {
+				width = len(row)
+			}
+		}
+	}
+	header := make([]string, width+1)
+	copy(header, records[0])
+	for i := len(records[0]); i < width; i++ {
+		header[i] = fmt.Sprintf("column_%d", i+1)
+	}
+	header[width] = "has_email"
+	result = append(result, header)
+
 	// Process rows
 	for i := 1; i < len(records); i++ {
+		// Check for cancellation and report progress every so often rather than on each row
+		if i%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, summary, err
+			}
+			if progress != nil {
+				progress(i - 1)
+			}
+		}
+
 		row := records[i]
+		summary.TotalRows++
+
+		empty := cs.isEmptyRow(row)
+		if empty {
+			summary.EmptyRows++
+
+			switch policy {
+			case models.EmptyRowPolicyDrop:
+				continue
+			case models.EmptyRowPolicyKeep:
+				result = append(result, row)
+				continue
+			}
+		}
 
-		// Skip if empty
-		if cs.isEmptyRow(row) {
-			result[i] = row
-			continue
+		// Padding makes the output rectangular by filling out short rows. Cells
+		// past the header are only cut off when asked to, and still count as
+		// emails below.
+		size := len(row)
+		if truncate && size > width {
+			size = width
+			if !empty {
+				summary.TruncatedRows++
+			}
+		}
+		if policy == models.EmptyRowPolicyPad {
+			size = width
 		}
 
-		newRow := make([]string, len(row)+1)
+		newRow := make([]string, size+1)
 		copy(newRow, row)
 
 		// Check for emails
@@ -136,15 +422,23 @@ func (cs *CSVService) processRecords(records [][]string) [][]string {
 		}
 
 		if foundEmail {
-			newRow[len(newRow)-1] = "true"
+			newRow[size] = "true"
+			summary.RowsWithEmail++
 		} else {
-			newRow[len(newRow)-1] = "false"
+			newRow[size] = "false"
+			if !empty {
+				summary.RowsWithoutEmail++
+			}
 		}
 
-		result[i] = newRow
+		result = append(result, newRow)
 	}
 
-	return result
+	metrics.RowsProcessed.WithLabelValues(metrics.ResultValidEmail).Add(float64(summary.RowsWithEmail))
+	metrics.RowsProcessed.WithLabelValues(metrics.ResultInvalidEmail).Add(float64(summary.RowsWithoutEmail))
+	metrics.RowsProcessed.WithLabelValues(metrics.ResultEmpty).Add(float64(summary.EmptyRows))
+
+	return result, summary, ctx.Err()
 }
 
 // isEmptyRow checks if a CSV row is empty or contains only whitespace
@@ -157,22 +451,41 @@ func (cs *CSVService) isEmptyRow(record []string) bool {
 	return true
 }
 
-// writeProcessedCSV writes processed records to a CSV file
+// writeProcessedCSV writes processed records to a CSV file, gzip-compressed
+// when the path ends in .gz. Nothing is stored if writing fails.
 func (cs *CSVService) writeProcessedCSV(filePath string, records [][]string) error {
-	file, err := os.Create(filePath)
-	if err != nil {
+	file := cs.fileService.Create(filePath)
+
+	if err := writeCSV(file, StoredEncoding(filePath), records); err != nil {
+		file.Abort(err)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
 		return fmt.Errorf("failed to create processed file: %w", err)
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	return nil
+}
+
+// writeCSV encodes records as CSV into w with the given compression
+func writeCSV(w io.Writer, encoding ContentEncoding, records [][]string) error {
+	encoder, err := NewEncoder(w, encoding)
+	if err != nil {
+		return err
+	}
 
+	writer := csv.NewWriter(encoder)
 	for _, record := range records {
 		if err := writer.Write(record); err != nil {
 			return fmt.Errorf("failed to write CSV record: %w", err)
 		}
 	}
 
-	return nil
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV record: %w", err)
+	}
+
+	return encoder.Close()
 }
@@ -1,13 +1,17 @@
 package services
 
 import (
+	"context"
 	"encoding/csv"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"csv-validator/internal/models"
+	"csv-validator/internal/spreadsheet"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,8 +24,10 @@ func TestCSVService_ProcessRecords(t *testing.T) {
 
 	tests := []struct {
 		name     string
+		options  models.ProcessingOptions
 		input    [][]string
 		expected [][]string
+		summary  models.JobSummary
 	}{
 		{
 			name: "CSV with valid emails",
@@ -37,6 +43,7 @@ func TestCSVService_ProcessRecords(t *testing.T) {
 				{"Yash", "Yash@test.com", "25", "true"},
 				{"Rohan", "not-an-email", "35", "false"},
 			},
+			summary: models.JobSummary{TotalRows: 3, RowsWithEmail: 2, RowsWithoutEmail: 1},
 		},
 		{
 			name: "CSV with no emails",
@@ -50,9 +57,11 @@ func TestCSVService_ProcessRecords(t *testing.T) {
 				{"Chirag", "123-456-7890", "30", "false"},
 				{"Yash", "987-654-3210", "25", "false"},
 			},
+			summary: models.JobSummary{TotalRows: 2, RowsWithoutEmail: 2},
 		},
 		{
-			name: "CSV with empty rows",
+			name:    "CSV with empty rows kept as-is",
+			options: models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyKeep},
 			input: [][]string{
 				{"name", "email"},
 				{"Chirag", "Chirag@example.com"},
@@ -65,6 +74,99 @@ func TestCSVService_ProcessRecords(t *testing.T) {
 				{"", ""},
 				{"Yash", "Yash@test.com", "true"},
 			},
+			summary: models.JobSummary{TotalRows: 3, RowsWithEmail: 2, EmptyRows: 1},
+		},
+		{
+			name:    "CSV with empty rows padded",
+			options: models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyPad},
+			input: [][]string{
+				{"name", "email"},
+				{"Chirag", "Chirag@example.com"},
+				{""},
+				{"Yash", "Yash@test.com"},
+			},
+			expected: [][]string{
+				{"name", "email", "has_email"},
+				{"Chirag", "Chirag@example.com", "true"},
+				{"", "", "false"},
+				{"Yash", "Yash@test.com", "true"},
+			},
+			summary: models.JobSummary{TotalRows: 3, RowsWithEmail: 2, EmptyRows: 1},
+		},
+		{
+			name:    "CSV with empty rows dropped",
+			options: models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyDrop},
+			input: [][]string{
+				{"name", "email"},
+				{"", ""},
+				{"Yash", "Yash@test.com"},
+				{"  ", ""},
+			},
+			expected: [][]string{
+				{"name", "email", "has_email"},
+				{"Yash", "Yash@test.com", "true"},
+			},
+			summary: models.JobSummary{TotalRows: 3, RowsWithEmail: 1, EmptyRows: 2},
+		},
+		{
+			name: "Short rows padded by default",
+			input: [][]string{
+				{"name", "email", "age"},
+				{"Chirag"},
+			},
+			expected: [][]string{
+				{"name", "email", "age", "has_email"},
+				{"Chirag", "", "", "false"},
+			},
+			summary: models.JobSummary{TotalRows: 1, RowsWithoutEmail: 1},
+		},
+		{
+			name: "Header extended to long rows by default",
+			input: [][]string{
+				{"name", "email"},
+				{"Chirag", "", "chirag@example.com"},
+				{"Yash", "yash@test.com"},
+				{"", "", "", ""},
+			},
+			expected: [][]string{
+				{"name", "email", "column_3", "has_email"},
+				{"Chirag", "", "chirag@example.com", "true"},
+				{"Yash", "yash@test.com", "", "true"},
+				{"", "", "", "false"},
+			},
+			summary: models.JobSummary{TotalRows: 3, RowsWithEmail: 2, EmptyRows: 1},
+		},
+		{
+			name:    "Long rows cut to the header when asked to",
+			options: models.ProcessingOptions{LongRows: models.LongRowPolicyTruncate},
+			input: [][]string{
+				{"name", "email"},
+				{"Chirag", "", "chirag@example.com"},
+				{"Yash", "yash@test.com", "extra"},
+				{"Rohan", "none"},
+			},
+			expected: [][]string{
+				{"name", "email", "has_email"},
+				{"Chirag", "", "true"},
+				{"Yash", "yash@test.com", "true"},
+				{"Rohan", "none", "false"},
+			},
+			summary: models.JobSummary{TotalRows: 3, RowsWithEmail: 2, RowsWithoutEmail: 1, TruncatedRows: 2},
+		},
+		{
+			name:    "Long rows cut when kept as they are",
+			options: models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyKeep, LongRows: models.LongRowPolicyTruncate},
+			input: [][]string{
+				{"name", "email", "age"},
+				{"Chirag", "chirag@example.com", "30", "extra"},
+				{"Yash"},
+			},
+			expected: [][]string{
+				{"name", "email", "age", "has_email"},
+				{"Chirag", "chirag@example.com", "30", "true"},
+				{"Yash", "false"},
+			},
+			summary: models.JobSummary{TotalRows: 2, RowsWithEmail: 1, RowsWithoutEmail: 1, TruncatedRows: 1},
 		},
 		{
 			name:     "Empty CSV",
@@ -75,12 +177,50 @@ func TestCSVService_ProcessRecords(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := csvService.processRecords(tt.input)
+			result, summary, err := csvService.processRecords(context.Background(), tt.input, tt.options, nil)
+			require.NoError(t, err)
 			assert.Equal(t, tt.expected, result)
+			assert.Equal(t, tt.summary, summary)
 		})
 	}
 }
 
+func TestCSVService_ValidateCSV(t *testing.T) {
+	fileService := NewFileService("./test-uploads", "./test-downloads")
+	jobService := NewJobService()
+	csvService := NewCSVService(fileService, jobService)
+
+	input := "name,email\nChirag,Chirag@example.com\n,\nYash,not-an-email"
+	records, summary, err := csvService.ValidateCSV(context.Background(), strings.NewReader(input), models.ProcessingOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"name", "email", "has_email"},
+		{"Chirag", "Chirag@example.com", "true"},
+		{"", "", "false"},
+		{"Yash", "not-an-email", "false"},
+	}, records)
+	assert.Equal(t, models.JobSummary{TotalRows: 3, RowsWithEmail: 1, RowsWithoutEmail: 1, EmptyRows: 1}, summary)
+
+	// Empty input is rejected
+	_, _, err = csvService.ValidateCSV(context.Background(), strings.NewReader(""), models.ProcessingOptions{})
+	assert.ErrorIs(t, err, ErrEmptyCSV)
+}
+
+func TestCSVService_ValidateRecords_Cancelled(t *testing.T) {
+	fileService := NewFileService("./test-uploads", "./test-downloads")
+	jobService := NewJobService()
+	csvService := NewCSVService(fileService, jobService)
+
+	records := [][]string{{"name", "email"}, {"Chirag", "Chirag@example.com"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := csvService.ValidateRecords(ctx, records, models.ProcessingOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestCSVService_IsEmptyRow(t *testing.T) {
 	fileService := NewFileService("./test-uploads", "./test-downloads")
 	jobService := NewJobService()
@@ -184,7 +324,7 @@ func TestCSVService_ProcessFileSync_Success(t *testing.T) {
 	job := jobService.CreateJob(testFile)
 
 	// Process file
-	err = csvService.processFileSync(job.ID)
+	err = csvService.processFileSync(context.Background(), job.ID)
 	require.NoError(t, err)
 
 	// Verify job status
@@ -210,6 +350,116 @@ func TestCSVService_ProcessFileSync_Success(t *testing.T) {
 	assert.Equal(t, "true", records[1][3])  // Chirag has valid email
 	assert.Equal(t, "false", records[2][3]) // Yash has invalid email
 	assert.Equal(t, "true", records[3][3])  // Rohan has valid email
+
+	// Check summary
+	require.NotNil(t, updatedJob.Summary)
+	assert.Equal(t, 3, updatedJob.Summary.TotalRows)
+	assert.Equal(t, 2, updatedJob.Summary.RowsWithEmail)
+	assert.Equal(t, 1, updatedJob.Summary.RowsWithoutEmail)
+}
+
+func TestCSVService_ProcessFileSync_CompressedOutput(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testFile := filepath.Join(tempDir, "test.csv")
+	err := os.WriteFile(testFile, []byte("name,email\nChirag,Chirag@example.com\n"), 0644)
+	require.NoError(t, err)
+
+	fileService := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+	fileService.SetCompressOutputs(true)
+	jobService := NewJobService()
+	csvService := NewCSVService(fileService, jobService)
+
+	job := jobService.CreateJob(testFile)
+	require.NoError(t, csvService.processFileSync(context.Background(), job.ID))
+
+	updatedJob, _ := jobService.GetJob(job.ID)
+	assert.True(t, strings.HasSuffix(updatedJob.ProcessedFile, ".csv.gz"))
+
+	reader, err := fileService.OpenProcessedFile(updatedJob.ProcessedFile)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	records, err := csv.NewReader(reader).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"name", "email", "has_email"}, {"Chirag", "Chirag@example.com", "true"}}, records)
+}
+
+func TestCSVService_ProcessFileSync_EmptyRowPolicy(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "csv-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	csvContent := "name,email\nChirag,Chirag@example.com\n,\nYash,Yash@test.com"
+	testFile := filepath.Join(tempDir, "blank.csv")
+	err = os.WriteFile(testFile, []byte(csvContent), 0644)
+	require.NoError(t, err)
+
+	fileService := NewFileService(tempDir, tempDir+"-downloads")
+	jobService := NewJobService()
+	csvService := NewCSVService(fileService, jobService)
+
+	job := jobService.CreateJobWithOptions(models.Identity{}, testFile, models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyDrop})
+
+	err = csvService.processFileSync(context.Background(), job.ID)
+	require.NoError(t, err)
+
+	updatedJob, exists := jobService.GetJob(job.ID)
+	require.True(t, exists)
+	require.NotNil(t, updatedJob.Summary)
+	assert.Equal(t, 1, updatedJob.Summary.EmptyRows)
+
+	processedFile, err := os.Open(updatedJob.ProcessedFile)
+	require.NoError(t, err)
+	defer processedFile.Close()
+
+	records, err := csv.NewReader(processedFile).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+}
+
+func TestCSVService_ProcessFileSync_Spreadsheet(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "csv-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Build a workbook with the streaming writer
+	testFile := filepath.Join(tempDir, "people.xlsx")
+	file, err := os.Create(testFile)
+	require.NoError(t, err)
+	writer, err := spreadsheet.NewXLSXWriter(file)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteRow([]string{"name", "email"}))
+	require.NoError(t, writer.WriteRow([]string{"Chirag", "Chirag@example.com"}))
+	require.NoError(t, writer.Close())
+	require.NoError(t, file.Close())
+
+	fileService := NewFileService(tempDir, tempDir+"-downloads")
+	jobService := NewJobService()
+	csvService := NewCSVService(fileService, jobService)
+	defer os.RemoveAll(tempDir + "-downloads")
+
+	job := jobService.CreateJobWithOptions(models.Identity{}, testFile, models.ProcessingOptions{Sheet: "Sheet1"})
+
+	err = csvService.processFileSync(context.Background(), job.ID)
+	require.NoError(t, err)
+
+	updatedJob, exists := jobService.GetJob(job.ID)
+	require.True(t, exists)
+	assert.Equal(t, "processed_people.csv", filepath.Base(updatedJob.ProcessedFile))
+
+	processedFile, err := os.Open(updatedJob.ProcessedFile)
+	require.NoError(t, err)
+	defer processedFile.Close()
+
+	records, err := csv.NewReader(processedFile).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"name", "email", "has_email"}, {"Chirag", "Chirag@example.com", "true"}}, records)
+
+	// Unknown sheets fail the job
+	job = jobService.CreateJobWithOptions(models.Identity{}, testFile, models.ProcessingOptions{Sheet: "Missing"})
+	err = csvService.processFileSync(context.Background(), job.ID)
+	assert.ErrorIs(t, err, spreadsheet.ErrSheetNotFound)
 }
 
 func TestCSVService_ProcessFileSync_FileNotFound(t *testing.T) {
@@ -225,7 +475,7 @@ func TestCSVService_ProcessFileSync_FileNotFound(t *testing.T) {
 	job := jobService.CreateJob("non-existent.csv")
 
 	// Process file should fail
-	err = csvService.processFileSync(job.ID)
+	err = csvService.processFileSync(context.Background(), job.ID)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to open original file")
 }
@@ -248,7 +498,7 @@ func TestCSVService_ProcessFileSync_EmptyFile(t *testing.T) {
 	job := jobService.CreateJob(testFile)
 
 	// Process file should fail
-	err = csvService.processFileSync(job.ID)
+	err = csvService.processFileSync(context.Background(), job.ID)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "CSV file is empty")
 }
@@ -272,7 +522,7 @@ func TestCSVService_ProcessFile_Async(t *testing.T) {
 	job := jobService.CreateJob(testFile)
 
 	// Start async processing
-	csvService.ProcessFile(job.ID)
+	csvService.ProcessFile(context.Background(), job.ID)
 
 	// Wait for processing to complete (with timeout)
 	timeout := time.After(5 * time.Second)
@@ -295,3 +545,141 @@ func TestCSVService_ProcessFile_Async(t *testing.T) {
 		}
 	}
 }
+
+func TestCSVService_ProcessFileSync_Progress(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "csv-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	defer os.RemoveAll(tempDir + "-downloads")
+
+	var content strings.Builder
+	content.WriteString("name,email\n")
+	for i := 0; i < 2500; i++ {
+		fmt.Fprintf(&content, "user%d,user%d@example.com\n", i, i)
+	}
+	testFile := filepath.Join(tempDir, "test.csv")
+	require.NoError(t, os.WriteFile(testFile, []byte(content.String()), 0644))
+
+	fileService := NewFileService(tempDir, tempDir+"-downloads")
+	jobService := NewJobService()
+	csvService := NewCSVService(fileService, jobService)
+	csvService.progressInterval = 0
+
+	job := jobService.CreateJob(testFile)
+	require.NoError(t, csvService.processFileSync(context.Background(), job.ID))
+
+	var progress []models.JobProgress
+	events, _ := jobService.EventsSince(job.ID, 0)
+	for _, event := range events {
+		if event.Type == models.JobEventProgress {
+			progress = append(progress, *event.Job.Progress)
+		}
+	}
+	assert.Equal(t, []models.JobProgress{
+		{RowsProcessed: 0, TotalRows: 2500},
+		{RowsProcessed: 999, TotalRows: 2500},
+		{RowsProcessed: 1999, TotalRows: 2500},
+	}, progress)
+
+	// Progress is cleared once the job is done
+	updatedJob, _ := jobService.GetJob(job.ID)
+	assert.Equal(t, models.JobStatusCompleted, updatedJob.Status)
+	assert.Nil(t, updatedJob.Progress)
+}
+
+func TestCSVService_CancelJob(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "csv-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	testFile := filepath.Join(tempDir, "test.csv")
+	require.NoError(t, os.WriteFile(testFile, []byte("name,email\nChirag,Chirag@example.com"), 0644))
+
+	fileService := NewFileService(tempDir, tempDir+"-downloads")
+	defer os.RemoveAll(tempDir + "-downloads")
+	jobService := NewJobService()
+	csvService := NewCSVService(fileService, jobService)
+
+	// A job cancelled before it starts is never processed
+	job := jobService.CreateJob(testFile)
+	cancelled, err := csvService.CancelJob(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusCancelled, cancelled.Status)
+	assert.ErrorIs(t, csvService.processFileSync(context.Background(), job.ID), ErrJobCancelled)
+
+	// Processing that sees its context cancelled writes no result
+	job = jobService.CreateJob(testFile)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, csvService.processFileSync(ctx, job.ID), context.Canceled)
+	updatedJob, _ := jobService.GetJob(job.ID)
+	assert.Empty(t, updatedJob.ProcessedFile)
+
+	// Finished jobs stay as they are
+	job = jobService.CreateJob(testFile)
+	require.NoError(t, csvService.processFileSync(context.Background(), job.ID))
+	_, err = csvService.CancelJob(context.Background(), job.ID)
+	assert.ErrorIs(t, err, ErrJobFinished)
+}
+
+func TestCSVService_ProcessFileSync_Deduplicated(t *testing.T) {
+	tempDir := t.TempDir()
+
+	fileService := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+	jobService := NewJobService()
+	csvService := NewCSVService(fileService, jobService)
+
+	content := "name,email\nChirag,Chirag@example.com\n,\n"
+	upload := func(owner, name string, options models.ProcessingOptions) *models.Job {
+		stored, err := fileService.SaveStream(strings.NewReader(content), name)
+		require.NoError(t, err)
+
+		job := jobService.CreateJobWithOptions(models.Identity{Tenant: owner}, name, options)
+		require.NoError(t, jobService.AttachUpload(job.ID, stored.Path, stored.SHA256, ""))
+		require.NoError(t, csvService.processFileSync(context.Background(), job.ID))
+
+		updated, _ := jobService.GetJob(job.ID)
+		return updated
+	}
+
+	pad := models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyPad}
+	drop := models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyDrop}
+
+	first := upload("", "contacts.csv", pad)
+	assert.Empty(t, first.DeduplicatedFrom)
+	assert.Equal(t, models.JobStatusCompleted, first.Status)
+
+	// Results are named after the job that wrote them, so jobs processing the
+	// same content at once, before either could reuse the other, never write
+	// the same file
+	assert.Contains(t, filepath.Base(first.ProcessedFile), first.ID)
+
+	// Same content and options, under another name: the result is reused
+	second := upload("", "copy.csv", pad)
+	assert.Equal(t, first.ID, second.DeduplicatedFrom)
+	assert.Equal(t, models.JobStatusCompleted, second.Status)
+	assert.Equal(t, first.ProcessedFile, second.ProcessedFile)
+	assert.Equal(t, first.Summary, second.Summary)
+	assert.NotNil(t, second.CompletedAt)
+
+	// Copies of copies point at the job that did the work
+	third := upload("", "again.csv", pad)
+	assert.Equal(t, first.ID, third.DeduplicatedFrom)
+
+	// Results are never shared with jobs of another API key
+	other := upload("key-2", "contacts.csv", pad)
+	assert.Empty(t, other.DeduplicatedFrom)
+	assert.Equal(t, models.JobStatusCompleted, other.Status)
+
+	// Different options are processed from scratch into their own result
+	dropped := upload("", "contacts.csv", drop)
+	assert.Empty(t, dropped.DeduplicatedFrom)
+	assert.NotEqual(t, first.ProcessedFile, dropped.ProcessedFile)
+	assert.Equal(t, 1, dropped.Summary.EmptyRows)
+
+	// A result that is gone is not reused
+	require.NoError(t, os.Remove(first.ProcessedFile))
+	fourth := upload("", "contacts.csv", pad)
+	assert.Empty(t, fourth.DeduplicatedFrom)
+	assert.FileExists(t, fourth.ProcessedFile)
+}
@@ -7,6 +7,28 @@ var (
 	ErrJobNotFound     = errors.New("job not found")
 	ErrJobInProgress   = errors.New("job is still in progress")
 	ErrJobFailed       = errors.New("job processing failed")
+	ErrJobCancelled    = errors.New("job was cancelled")
+	ErrJobFinished     = errors.New("job has already finished")
 	ErrInvalidFileType = errors.New("invalid file type")
 	ErrFileTooLarge    = errors.New("file size exceeds limit")
+	ErrEmptyCSV        = errors.New("CSV file is empty")
+	ErrInvalidArchive  = errors.New("invalid compressed file")
+	ErrArchiveTooLarge = errors.New("compressed file expands beyond limits")
+	ErrArchiveEmpty    = errors.New("archive contains no CSV files")
+
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+	ErrUploadIncomplete     = errors.New("upload is incomplete")
+	ErrInvalidChecksum      = errors.New("invalid checksum")
+	ErrChecksumMismatch     = errors.New("checksum mismatch")
+
+	ErrIdempotencyKeyReused     = errors.New("idempotency key reused with a different payload")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is in progress")
+
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrInvalidToken  = errors.New("invalid token")
+
+	ErrQuotaExceeded = errors.New("tenant quota exceeded")
+
+	ErrWebhookAddressNotAllowed = errors.New("webhook address is not public")
 )
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"csv-validator/internal/spreadsheet"
+)
+
+// OutputFormat is a representation a processed file can be downloaded in
+type OutputFormat string
+
+const (
+	FormatCSV    OutputFormat = "csv"
+	FormatJSON   OutputFormat = "json"
+	FormatNDJSON OutputFormat = "ndjson"
+	FormatXLSX   OutputFormat = "xlsx"
+)
+
+// OutputFormats lists the supported formats, CSV first as the default
+var OutputFormats = []OutputFormat{FormatCSV, FormatJSON, FormatNDJSON, FormatXLSX}
+
+// ParseOutputFormat validates a format name such as "ndjson"
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	format := OutputFormat(strings.ToLower(strings.TrimSpace(name)))
+	for _, known := range OutputFormats {
+		if format == known {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported format %q", name)
+}
+
+// OutputFormatForContentType returns the format matching a MIME type
+func OutputFormatForContentType(contentType string) (OutputFormat, bool) {
+	for _, format := range OutputFormats {
+		if format.ContentType() == contentType {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// ContentType returns the MIME type served for the format
+func (f OutputFormat) ContentType() string {
+	switch f {
+	case FormatJSON:
+		return "application/json"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return spreadsheet.XLSXContentType
+	default:
+		return "text/csv"
+	}
+}
+
+// ConvertCSV streams CSV records from r to w in the given format. The first
+// record is used as field names for JSON and NDJSON; cells beyond the header
+// are named column_N. Rows are converted one at a time, never buffered whole.
+func ConvertCSV(w io.Writer, r io.Reader, format OutputFormat) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // Allow variable number of fields
+
+	switch format {
+	case FormatCSV:
+		_, err := io.Copy(w, r)
+		return err
+	case FormatJSON, FormatNDJSON:
+		return convertToJSON(w, reader, format == FormatNDJSON)
+	case FormatXLSX:
+		return convertToXLSX(w, reader)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// convertToJSON writes one object per data row, either as a JSON array or newline delimited
+func convertToJSON(w io.Writer, reader *csv.Reader, ndjson bool) error {
+	bw := bufio.NewWriter(w)
+
+	header, err := reader.Read()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	keys := newJSONKeys(header)
+
+	if !ndjson {
+		bw.WriteString("[")
+	}
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CSV record: %w", err)
+		}
+
+		if !ndjson && !first {
+			bw.WriteString(",")
+		}
+
+		if err := writeJSONObject(bw, keys, record); err != nil {
+			return err
+		}
+
+		if ndjson {
+			bw.WriteString("\n")
+		}
+	}
+
+	if !ndjson {
+		bw.WriteString("]")
+	}
+
+	return bw.Flush()
+}
+
+// jsonKeys names the columns of the objects written for a CSV. Columns are named
+// after the header, or column_N past it or when the header cell is blank. Names
+// that are taken already get a suffix, name_2, name_3 and so on, since an object
+// can't hold two values under one key.
+type jsonKeys struct {
+	keys []string
+	used map[string]bool
+}
+
+func newJSONKeys(header []string) *jsonKeys {
+	k := &jsonKeys{used: make(map[string]bool)}
+	for i, name := range header {
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		k.add(name)
+	}
+	return k
+}
+
+// key returns the name of the column at index i
+func (k *jsonKeys) key(i int) string {
+	for len(k.keys) <= i {
+		k.add(fmt.Sprintf("column_%d", len(k.keys)+1))
+	}
+	return k.keys[i]
+}
+
+// add names the next column, suffixing name until it is unique
+func (k *jsonKeys) add(name string) {
+	key := name
+	for n := 2; k.used[key]; n++ {
+		key = fmt.Sprintf("%s_%d", name, n)
+	}
+	k.used[key] = true
+	k.keys = append(k.keys, key)
+}
+
+// writeJSONObject writes a record as an object keyed by its column names,
+// preserving column order
+func writeJSONObject(w *bufio.Writer, keys *jsonKeys, record []string) error {
+	width := len(keys.keys)
+	if len(record) > width {
+		width = len(record)
+	}
+
+	w.WriteString("{")
+	for i := 0; i < width; i++ {
+		if i > 0 {
+			w.WriteString(",")
+		}
+
+		value := ""
+		if i < len(record) {
+			value = record[i]
+		}
+
+		encodedKey, err := json.Marshal(keys.key(i))
+		if err != nil {
+			return err
+		}
+		encodedValue, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		w.Write(encodedKey)
+		w.WriteString(":")
+		w.Write(encodedValue)
+	}
+	w.WriteString("}")
+
+	return nil
+}
+
+// convertToXLSX writes every record, header included, as a worksheet row
+func convertToXLSX(w io.Writer, reader *csv.Reader) error {
+	writer, err := spreadsheet.NewXLSXWriter(w)
+	if err != nil {
+		return err
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CSV record: %w", err)
+		}
+
+		if err := writer.WriteRow(record); err != nil {
+			return fmt.Errorf("failed to write worksheet row: %w", err)
+		}
+	}
+
+	return writer.Close()
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exportInput = "name,email,has_email\nChirag,Chirag@example.com,true\nYash,\"not, an email\",false,extra\n"
+
+func TestParseOutputFormat(t *testing.T) {
+	format, err := ParseOutputFormat("NDJSON")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatNDJSON, format)
+
+	_, err = ParseOutputFormat("pdf")
+	assert.Error(t, err)
+}
+
+func TestOutputFormatForContentType(t *testing.T) {
+	format, ok := OutputFormatForContentType("application/x-ndjson")
+	assert.True(t, ok)
+	assert.Equal(t, FormatNDJSON, format)
+
+	_, ok = OutputFormatForContentType("application/pdf")
+	assert.False(t, ok)
+}
+
+func TestConvertCSV_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := ConvertCSV(&buf, strings.NewReader(exportInput), FormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, exportInput, buf.String())
+}
+
+func TestConvertCSV_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := ConvertCSV(&buf, strings.NewReader(exportInput), FormatJSON)
+	require.NoError(t, err)
+
+	assert.Equal(t, `[{"name":"Chirag","email":"Chirag@example.com","has_email":"true"},`+
+		`{"name":"Yash","email":"not, an email","has_email":"false","column_4":"extra"}]`, buf.String())
+
+	var rows []map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rows))
+	assert.Len(t, rows, 2)
+}
+
+func TestConvertCSV_JSONHeaderOnly(t *testing.T) {
+	var buf bytes.Buffer
+	err := ConvertCSV(&buf, strings.NewReader("name,email,has_email\n"), FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", buf.String())
+}
+
+func TestConvertCSV_JSONDuplicateHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	input := "name,name,,column_3,name\nChirag,Yash,x,y,z,extra\n"
+	err := ConvertCSV(&buf, strings.NewReader(input), FormatNDJSON)
+	require.NoError(t, err)
+
+	// Every column keeps its own key, so no value is lost when the object is parsed
+	assert.Equal(t, `{"name":"Chirag","name_2":"Yash","column_3":"x","column_3_2":"y","name_3":"z","column_6":"extra"}`+"\n", buf.String())
+
+	var row map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &row))
+	assert.Len(t, row, 6)
+}
+
+func TestConvertCSV_NDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := ConvertCSV(&buf, strings.NewReader(exportInput), FormatNDJSON)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, `{"name":"Chirag","email":"Chirag@example.com","has_email":"true"}`, lines[0])
+}
+
+func TestConvertCSV_XLSX(t *testing.T) {
+	var buf bytes.Buffer
+	err := ConvertCSV(&buf, strings.NewReader(exportInput), FormatXLSX)
+	require.NoError(t, err)
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	found := false
+	for _, f := range reader.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
@@ -1,24 +1,55 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 
 	"csv-validator/internal/models"
+	"csv-validator/internal/spreadsheet"
+	"csv-validator/internal/storage"
+	"csv-validator/internal/tracing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// FileService handles file operations
+// FileService handles file operations. Files live in a storage backend, keyed
+// by the paths under the upload and download directories that name them.
+// Uploads are stored content-addressed, by the SHA-256 of their content.
 type FileService struct {
 	uploadDir   string
 	downloadDir string
+	storage     storage.Storage
+	// tempDir is where uploads are spooled while they are hashed, the OS default if empty
+	tempDir         string
+	compressOutputs bool
+	// refs is shared by the tenant scoped services, since tenants are
+	// directories of the same storage
+	refs *contentRefs
+}
+
+// StoredFile is an upload saved by its content
+type StoredFile struct {
+	Path   string
+	SHA256 string
+	Size   int64
+	// Deduplicated reports that the same content was already stored
+	Deduplicated bool
 }
 
-// NewFileService creates a new file service
+// NewFileService creates a new file service storing files on the local filesystem
 func NewFileService(uploadDir, downloadDir string) *FileService {
 	// Create upload directory if it doesn't exist
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
@@ -30,60 +61,253 @@ func NewFileService(uploadDir, downloadDir string) *FileService {
 		panic(fmt.Sprintf("Failed to create download directory: %v", err))
 	}
 
+	fs := NewFileServiceWithStorage(uploadDir, downloadDir, storage.NewLocal(""))
+	// Spool next to the uploads so storing one is a rename
+	fs.tempDir = uploadDir
+	return fs
+}
+
+// NewFileServiceWithStorage creates a file service on top of any storage
+// backend. The directories are only key prefixes, nothing is created locally.
+func NewFileServiceWithStorage(uploadDir, downloadDir string, store storage.Storage) *FileService {
 	return &FileService{
 		uploadDir:   uploadDir,
 		downloadDir: downloadDir,
+		storage:     store,
+		refs:        &contentRefs{held: make(map[string]*contentRef)},
+	}
+}
+
+// tenantsDir is the directory below the upload and download directories that
+// holds one directory per tenant
+const tenantsDir = "tenants"
+
+// ForTenant returns a file service storing files in the tenant's own
+// directories below the upload and download directories, so tenants never share
+// content. The empty tenant, used without authentication, stores at the top.
+func (fs *FileService) ForTenant(tenant string) *FileService {
+	if tenant == "" {
+		return fs
+	}
+
+	scoped := *fs
+	scoped.uploadDir = filepath.Join(fs.uploadDir, tenantsDir, tenantDirName(tenant))
+	scoped.downloadDir = filepath.Join(fs.downloadDir, tenantsDir, tenantDirName(tenant))
+	return &scoped
+}
+
+// tenantDirName escapes a tenant ID, which may come from a token claim, into a
+// single path element. Dots are escaped too so no ID can name "." or "..".
+func tenantDirName(tenant string) string {
+	return strings.ReplaceAll(url.PathEscape(tenant), ".", "%2E")
+}
+
+// StorageUsed returns the bytes stored in the upload and download directories
+func (fs *FileService) StorageUsed() (int64, error) {
+	used, err := fs.dirUsage(fs.uploadDir)
+	if err != nil || fs.downloadDir == fs.uploadDir {
+		return used, err
+	}
+
+	downloads, err := fs.dirUsage(fs.downloadDir)
+	return used + downloads, err
+}
+
+// DiskUsage returns the bytes stored in the upload and download directories,
+// keyed "upload" and "download", including those of every tenant
+func (fs *FileService) DiskUsage() (map[string]int64, error) {
+	uploads, err := fs.dirUsage(fs.uploadDir)
+	if err != nil {
+		return nil, err
+	}
+	downloads, err := fs.dirUsage(fs.downloadDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]int64{"upload": uploads, "download": downloads}, nil
+}
+
+// dirUsage adds up the size of every file below dir
+func (fs *FileService) dirUsage(dir string) (int64, error) {
+	objects, err := fs.storage.List(context.Background(), filepath.ToSlash(dir)+"/")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list stored files: %w", err)
+	}
+
+	var used int64
+	for _, object := range objects {
+		used += object.Size
+	}
+	return used, nil
+}
+
+// CheckWritable stores and removes a small probe file in dir, proving new
+// files can be saved there
+func (fs *FileService) CheckWritable(ctx context.Context, dir string) error {
+	key := filepath.Join(dir, ".probe-"+uuid.New().String())
+	if _, err := fs.storage.Put(ctx, key, strings.NewReader("ok")); err != nil {
+		return fmt.Errorf("failed to write probe file: %w", err)
+	}
+	if err := fs.storage.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to remove probe file: %w", err)
+	}
+	return nil
+}
+
+// FreeSpace returns the bytes that can still be stored in dir. ok is false
+// when the storage backend has no meaningful limit, like an object store, or
+// can't measure it on this platform.
+func (fs *FileService) FreeSpace(ctx context.Context, dir string) (free int64, ok bool, err error) {
+	reporter, isReporter := fs.storage.(storage.SpaceReporter)
+	if !isReporter {
+		return 0, false, nil
+	}
+
+	free, err = reporter.FreeSpace(ctx, dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return 0, false, nil
 	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to measure free space: %w", err)
+	}
+	return free, true, nil
 }
 
 // SaveFile saves an uploaded file to the upload directory
-func (fs *FileService) SaveFile(file *multipart.FileHeader, jobID string) (string, error) {
-	// Create a unique filename
-	timestamp := time.Now().Unix()
-	filename := fmt.Sprintf("%s_%d_%s", jobID, timestamp, file.Filename)
-	filepath := filepath.Join(fs.uploadDir, filename)
+func (fs *FileService) SaveFile(ctx context.Context, file *multipart.FileHeader) (stored StoredFile, err error) {
+	_, span := tracing.Tracer().Start(ctx, "FileService.SaveFile", trace.WithAttributes(
+		attribute.String("file.name", file.Filename),
+		attribute.Int64("file.size", file.Size),
+	))
+	defer func() { tracing.End(span, err) }()
 
 	// Open uploaded file
 	src, err := file.Open()
 	if err != nil {
-		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+		return StoredFile{}, fmt.Errorf("failed to open uploaded file: %w", err)
 	}
 	defer src.Close()
 
-	// Create destination file
-	dst, err := os.Create(filepath)
+	// Copy file content
+	stored, err = fs.SaveStream(src, file.Filename)
 	if err != nil {
-		return "", fmt.Errorf("failed to create destination file: %w", err)
+		return StoredFile{}, fmt.Errorf("failed to copy file: %w", err)
 	}
-	defer dst.Close()
 
-	// Copy file content
-	if _, err := io.Copy(dst, src); err != nil {
-		return "", fmt.Errorf("failed to copy file: %w", err)
+	span.SetAttributes(attribute.Bool("file.deduplicated", stored.Deduplicated))
+	return stored, nil
+}
+
+// MoveFile moves a file that is already on disk, such as a completed resumable
+// upload, into the upload directory. The file is removed either way.
+func (fs *FileService) MoveFile(srcPath, filename string) (StoredFile, error) {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return StoredFile{}, fmt.Errorf("failed to move file: %w", err)
 	}
 
-	return filepath, nil
+	// Hash in place, then hand the file itself to the backend
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	file.Close()
+	if err != nil {
+		return StoredFile{}, fmt.Errorf("failed to move file: %w", err)
+	}
+
+	stored, err := fs.importContent(srcPath, filename, hex.EncodeToString(hasher.Sum(nil)), size)
+	if err != nil {
+		return StoredFile{}, fmt.Errorf("failed to move file: %w", err)
+	}
+
+	return stored, nil
 }
 
 // GetFile returns the file path if it exists
 func (fs *FileService) GetFile(filename string) (string, error) {
 	filepath := filepath.Join(fs.uploadDir, filename)
 
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
+	if _, err := fs.storage.Stat(context.Background(), filepath); err != nil {
 		return "", fmt.Errorf("file not found: %s", filename)
 	}
 
 	return filepath, nil
 }
 
-// DeleteFile removes a file from the filesystem
+// DeleteFile removes a file from the upload directory
 func (fs *FileService) DeleteFile(filename string) error {
 	filepath := filepath.Join(fs.uploadDir, filename)
-	return os.Remove(filepath)
+
+	if _, err := fs.storage.Stat(context.Background(), filepath); err != nil {
+		return err
+	}
+
+	return fs.storage.Delete(context.Background(), filepath)
+}
+
+// Open opens a stored file by the path it was saved under
+func (fs *FileService) Open(path string) (io.ReadCloser, error) {
+	return fs.storage.Get(context.Background(), path)
+}
+
+// Create returns a writer that stores a file under path once it is closed
+func (fs *FileService) Create(path string) *storage.Writer {
+	return storage.NewWriter(context.Background(), fs.storage, path)
+}
+
+// Stat returns the size and modification time of a stored file
+func (fs *FileService) Stat(path string) (storage.ObjectInfo, error) {
+	return fs.storage.Stat(context.Background(), path)
+}
+
+// Remove deletes a stored file by the path it was saved under
+func (fs *FileService) Remove(path string) error {
+	return fs.storage.Delete(context.Background(), path)
+}
+
+// OpenLocal returns a stored file as a local *os.File, which spreadsheet and
+// archive readers need for random access. Files in remote storage are copied to
+// a temporary file first; the returned cleanup closes and removes it.
+func (fs *FileService) OpenLocal(path string) (*os.File, func(), error) {
+	src, err := fs.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if file, ok := src.(*os.File); ok {
+		return file, func() { file.Close() }, nil
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "csv-validator-*"+filepath.Ext(path))
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return tmp, cleanup, nil
 }
 
 // ValidateFile validates the uploaded file
-func (fs *FileService) ValidateFile(file *multipart.FileHeader, maxSize int64) (*models.FileInfo, error) {
+func (fs *FileService) ValidateFile(ctx context.Context, file *multipart.FileHeader, maxSize int64) (info *models.FileInfo, err error) {
+	_, span := tracing.Tracer().Start(ctx, "FileService.ValidateFile", trace.WithAttributes(
+		attribute.String("file.name", file.Filename),
+		attribute.Int64("file.size", file.Size),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	// Check file size
 	if file.Size > maxSize {
 		return nil, fmt.Errorf("file size (%d bytes) exceeds maximum allowed size (%d bytes)", file.Size, maxSize)
@@ -91,8 +315,8 @@ func (fs *FileService) ValidateFile(file *multipart.FileHeader, maxSize int64) (
 
 	// Check file extension
 	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if ext != ".csv" {
-		return nil, fmt.Errorf("invalid file format. Only CSV files are allowed")
+	if ext != ".csv" && !spreadsheet.IsSpreadsheet(file.Filename) {
+		return nil, fmt.Errorf("invalid file format. Only CSV, XLSX and ODS files are allowed")
 	}
 
 	// Get MIME type by reading file header
@@ -112,10 +336,9 @@ func (fs *FileService) ValidateFile(file *multipart.FileHeader, maxSize int64) (
 	// Reset file pointer
 	src.Close()
 
-	// Additional validation: check if it's a text file
-	mimeType := "text/csv"
-	if !isTextFile(buffer[:n]) {
-		return nil, fmt.Errorf("file does not appear to be a valid text/CSV file")
+	mimeType, err := DetectContentType(file.Filename, buffer[:n])
+	if err != nil {
+		return nil, err
 	}
 
 	return &models.FileInfo{
@@ -125,6 +348,219 @@ func (fs *FileService) ValidateFile(file *multipart.FileHeader, maxSize int64) (
 	}, nil
 }
 
+// SaveStream writes everything read from r to the upload directory. Nothing is
+// stored if reading or writing fails.
+func (fs *FileService) SaveStream(r io.Reader, name string) (StoredFile, error) {
+	stored, err := fs.putContent(name, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+	if err != nil {
+		return StoredFile{}, fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return stored, nil
+}
+
+// contentRefs tracks the stored uploads that were saved but not yet handed to a
+// job or discarded. Uploads with the same content share one file, so it may only
+// be removed once nobody holds it and no job reads it.
+type contentRefs struct {
+	mu   sync.Mutex
+	held map[string]*contentRef
+	// inUse reports whether a job reads the file at a path
+	inUse func(path string) bool
+}
+
+type contentRef struct {
+	holders int
+	// stored reports that one of the holders wrote the file, rather than
+	// finding it stored before
+	stored bool
+}
+
+// SetInUse sets how the service finds out whether a job still reads a stored
+// upload, which keeps Discard from removing it
+func (fs *FileService) SetInUse(inUse func(path string) bool) {
+	fs.refs.mu.Lock()
+	defer fs.refs.mu.Unlock()
+	fs.refs.inUse = inUse
+}
+
+// Release hands a saved file over to the job it was saved for. From then on
+// the job keeps it from being discarded.
+func (fs *FileService) Release(stored StoredFile) {
+	fs.refs.mu.Lock()
+	defer fs.refs.mu.Unlock()
+	fs.refs.release(stored.Path)
+}
+
+// Discard removes a file saved by this service, unless its content was already
+// stored before, another upload of the same content has not been released or
+// discarded yet, or a job still reads it
+func (fs *FileService) Discard(stored StoredFile) {
+	fs.refs.mu.Lock()
+	defer fs.refs.mu.Unlock()
+
+	ref := fs.refs.release(stored.Path)
+	if ref == nil || ref.holders > 0 || !ref.stored {
+		return
+	}
+	if fs.refs.inUse != nil && fs.refs.inUse(stored.Path) {
+		return
+	}
+	fs.Remove(stored.Path)
+}
+
+// hold records one more holder of the file at path. The caller holds mu.
+func (r *contentRefs) hold(path string) *contentRef {
+	ref, exists := r.held[path]
+	if !exists {
+		ref = &contentRef{}
+		r.held[path] = ref
+	}
+	ref.holders++
+	return ref
+}
+
+// release drops one holder of the file at path and returns what is left of it,
+// nil if it was not held. The caller holds mu.
+func (r *contentRefs) release(path string) *contentRef {
+	ref, exists := r.held[path]
+	if !exists {
+		return nil
+	}
+	ref.holders--
+	if ref.holders == 0 {
+		delete(r.held, path)
+	}
+	return ref
+}
+
+// putContent spools what write produces to a temporary file while hashing it,
+// then stores it under its content path. Content that is already stored is not
+// written again.
+func (fs *FileService) putContent(name string, write func(w io.Writer) error) (StoredFile, error) {
+	tmp, err := os.CreateTemp(fs.tempDir, ".upload-*")
+	if err != nil {
+		return StoredFile{}, err
+	}
+
+	hasher := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, hasher)}
+	err = write(counter)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return StoredFile{}, err
+	}
+
+	stored, err := fs.importContent(tmp.Name(), name, hex.EncodeToString(hasher.Sum(nil)), counter.n)
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return stored, err
+}
+
+// importContent moves the local file at localPath, whose content hashes to sum,
+// to its content path, or just removes it when that content is already stored
+func (fs *FileService) importContent(localPath, name, sum string, size int64) (StoredFile, error) {
+	stored := StoredFile{Path: fs.contentPath(sum, name), SHA256: sum, Size: size}
+
+	// Held before it is checked, so a Discard of the same content cannot
+	// remove it once it was found
+	fs.refs.mu.Lock()
+	ref := fs.refs.hold(stored.Path)
+	fs.refs.mu.Unlock()
+
+	if _, err := fs.storage.Stat(context.Background(), stored.Path); err == nil {
+		stored.Deduplicated = true
+		os.Remove(localPath)
+		return stored, nil
+	}
+
+	err := storage.Import(context.Background(), fs.storage, stored.Path, localPath)
+
+	fs.refs.mu.Lock()
+	defer fs.refs.mu.Unlock()
+	if err != nil {
+		fs.refs.release(stored.Path)
+		return StoredFile{}, err
+	}
+	ref.stored = true
+	return stored, nil
+}
+
+// contentPath is where content with the given SHA-256 is stored. The extension of
+// name is kept since it decides how the file is read.
+func (fs *FileService) contentPath(sum, name string) string {
+	return filepath.Join(fs.uploadDir, "sha256", sum[:2], sum+strings.ToLower(filepath.Ext(name)))
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// DetectContentType checks that the first bytes of a file match what its name
+// claims it is and returns its MIME type. Workbooks and archives must start with
+// their magic numbers; everything else must look like text.
+func DetectContentType(name string, head []byte) (string, error) {
+	lower := strings.ToLower(name)
+	ext := filepath.Ext(lower)
+
+	switch {
+	case ext == spreadsheet.ExtXLSX || ext == spreadsheet.ExtODS:
+		if !bytes.HasPrefix(head, zipMagic) {
+			return "", fmt.Errorf("file does not appear to be a valid %s workbook", strings.TrimPrefix(ext, "."))
+		}
+		return spreadsheetMimeTypes[ext], nil
+	case ext == ".zip":
+		if !bytes.HasPrefix(head, zipMagic) {
+			return "", fmt.Errorf("file does not appear to be a valid zip archive")
+		}
+		return "application/zip", nil
+	case strings.HasSuffix(lower, ".csv.gz"):
+		if !bytes.HasPrefix(head, gzipMagic) {
+			return "", fmt.Errorf("file does not appear to be a valid gzip file")
+		}
+		return EncodingGzip.ContentType(), nil
+	case strings.HasSuffix(lower, ".csv.zst"):
+		if !bytes.HasPrefix(head, zstdMagic) {
+			return "", fmt.Errorf("file does not appear to be a valid zstd file")
+		}
+		return EncodingZstd.ContentType(), nil
+	default:
+		if !isTextFile(head) {
+			return "", fmt.Errorf("file does not appear to be a valid text/CSV file")
+		}
+		return "text/csv", nil
+	}
+}
+
+// Magic numbers of the binary formats accepted for upload
+var (
+	// zipMagic is the local file header signature every xlsx, ods and zip file starts with
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// spreadsheetMimeTypes maps workbook extensions to their MIME types
+var spreadsheetMimeTypes = map[string]string{
+	spreadsheet.ExtXLSX: spreadsheet.XLSXContentType,
+	spreadsheet.ExtODS:  "application/vnd.oasis.opendocument.spreadsheet",
+}
+
 // isTextFile checks if the file content appears to be text
 func isTextFile(data []byte) bool {
 	if len(data) == 0 {
@@ -151,7 +587,22 @@ func isTextFile(data []byte) bool {
 	return ratio >= 0.95
 }
 
+// GetUploadDir returns the upload directory path
+func (fs *FileService) GetUploadDir() string {
+	return fs.uploadDir
+}
+
 // GetDownloadDir returns the download directory path
 func (fs *FileService) GetDownloadDir() string {
 	return fs.downloadDir
 }
+
+// SetCompressOutputs controls whether processed files are stored gzip-compressed
+func (fs *FileService) SetCompressOutputs(enabled bool) {
+	fs.compressOutputs = enabled
+}
+
+// CompressOutputs reports whether processed files are stored gzip-compressed
+func (fs *FileService) CompressOutputs() bool {
+	return fs.compressOutputs
+}
@@ -2,11 +2,19 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"csv-validator/internal/spreadsheet"
+	"csv-validator/internal/storage"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -32,6 +40,46 @@ func TestFileService_GetFile(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestFileService_ForTenant(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(filepath.Join(tempDir, "uploads"), filepath.Join(tempDir, "downloads"))
+
+	acme := fs.ForTenant("acme")
+	assert.Equal(t, filepath.Join(tempDir, "downloads", "tenants", "acme"), acme.GetDownloadDir())
+	assert.Same(t, fs, fs.ForTenant(""))
+
+	// The same content is stored separately for each tenant
+	stored, err := acme.SaveStream(strings.NewReader("name,email\n"), "a.csv")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.Path, filepath.Join(tempDir, "uploads", "tenants", "acme")+string(filepath.Separator)))
+
+	other, err := fs.ForTenant("globex").SaveStream(strings.NewReader("name,email\n"), "a.csv")
+	require.NoError(t, err)
+	assert.False(t, other.Deduplicated)
+	assert.NotEqual(t, stored.Path, other.Path)
+
+	// IDs can't climb out of the tenants directory
+	for _, tenant := range []string{"..", "../acme", "a/b"} {
+		dir := fs.ForTenant(tenant).GetDownloadDir()
+		assert.Equal(t, filepath.Join(tempDir, "downloads", "tenants"), filepath.Dir(dir), tenant)
+		assert.NotEqual(t, filepath.Join(tempDir, "downloads", "tenants", "acme"), dir, tenant)
+	}
+
+	require.NoError(t, acme.Create(filepath.Join(acme.GetDownloadDir(), "processed.csv")).Close())
+	used, err := acme.StorageUsed()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("name,email\n")), used)
+
+	// Everything stored counts for the top level
+	used, err = fs.StorageUsed()
+	require.NoError(t, err)
+	assert.Equal(t, 2*int64(len("name,email\n")), used)
+
+	usage, err := fs.DiskUsage()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"upload": 2 * int64(len("name,email\n")), "download": 0}, usage)
+}
+
 func TestFileService_ValidateFile_ExtensionCheck(t *testing.T) {
 	tempDir, _ := os.MkdirTemp("", "file-test")
 	defer os.RemoveAll(tempDir)
@@ -53,12 +101,17 @@ func TestFileService_ValidateFile_ExtensionCheck(t *testing.T) {
 
 	// CSV should pass
 	csvFile := makeFile("good.csv")
-	_, err := fs.ValidateFile(csvFile, 10*1024)
+	_, err := fs.ValidateFile(context.Background(), csvFile, 10*1024)
 	assert.NoError(t, err)
 
+	// Spreadsheet extension with text content should fail
+	fakeWorkbook := makeFile("fake.xlsx")
+	_, err = fs.ValidateFile(context.Background(), fakeWorkbook, 10*1024)
+	assert.Error(t, err)
+
 	// TXT should fail
 	txtFile := makeFile("bad.txt")
-	_, err = fs.ValidateFile(txtFile, 10*1024)
+	_, err = fs.ValidateFile(context.Background(), txtFile, 10*1024)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "CSV")
 }
@@ -100,3 +153,130 @@ func TestIsTextFile(t *testing.T) {
 	mixedData := []byte("name,email\n\r\tJohn,test@example.com")
 	assert.True(t, isTextFile(mixedData))
 }
+
+// memoryStorage keeps objects in memory, standing in for a remote backend
+type memoryStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{objects: map[string][]byte{}}
+}
+
+func (m *memoryStorage) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	return int64(len(data)), nil
+}
+
+func (m *memoryStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memoryStorage) Stat(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return storage.ObjectInfo{}, storage.ErrNotFound
+	}
+	return storage.ObjectInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (m *memoryStorage) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memoryStorage) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var objects []storage.ObjectInfo
+	for key, data := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, storage.ObjectInfo{Key: key, Size: int64(len(data))})
+		}
+	}
+	return objects, nil
+}
+
+func TestFileService_RemoteStorage(t *testing.T) {
+	// Nothing may touch the local directories when another backend is configured
+	tempDir := t.TempDir()
+	uploadDir := filepath.Join(tempDir, "uploads")
+	downloadDir := filepath.Join(tempDir, "downloads")
+
+	store := newMemoryStorage()
+	fs := NewFileServiceWithStorage(uploadDir, downloadDir, store)
+	jobService := NewJobService()
+	csvService := NewCSVService(fs, jobService)
+
+	// CSV upload
+	stored, err := fs.SaveStream(strings.NewReader("name,email\nChirag,Chirag@example.com\n"), "people.csv")
+	require.NoError(t, err)
+	assert.Contains(t, store.objects, stored.Path)
+
+	job := jobService.CreateJob(stored.Path)
+	require.NoError(t, csvService.processFileSync(context.Background(), job.ID))
+
+	updatedJob, _ := jobService.GetJob(job.ID)
+	reader, err := fs.OpenProcessedFile(updatedJob.ProcessedFile)
+	require.NoError(t, err)
+	records, err := csv.NewReader(reader).ReadAll()
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"name", "email", "has_email"}, {"Chirag", "Chirag@example.com", "true"}}, records)
+
+	// Workbooks are spooled to a temporary file for random access
+	var workbook bytes.Buffer
+	writer, err := spreadsheet.NewXLSXWriter(&workbook)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteRow([]string{"name", "email"}))
+	require.NoError(t, writer.WriteRow([]string{"Yash", "not-an-email"}))
+	require.NoError(t, writer.Close())
+
+	stored, err = fs.SaveStream(&workbook, "people.xlsx")
+	require.NoError(t, err)
+
+	job = jobService.CreateJob(stored.Path)
+	require.NoError(t, csvService.processFileSync(context.Background(), job.ID))
+
+	updatedJob, _ = jobService.GetJob(job.ID)
+	reader, err = fs.OpenProcessedFile(updatedJob.ProcessedFile)
+	require.NoError(t, err)
+	records, err = csv.NewReader(reader).ReadAll()
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"name", "email", "has_email"}, {"Yash", "not-an-email", "false"}}, records)
+
+	// Archives are extracted into the store, and nothing is left behind on failure
+	archive := zipBytes(t, map[string]string{"a.csv": "name\n"})
+	extracted, err := fs.ExtractArchiveFrom(bytes.NewReader(archive), int64(len(archive)), ArchiveLimits{})
+	require.NoError(t, err)
+	require.Len(t, extracted, 1)
+	assert.Contains(t, store.objects, extracted[0].Path)
+
+	_, err = fs.SaveDecompressed(bytes.NewReader(gzipBytes(t, bytes.Repeat([]byte("a"), 2048))), "big.csv.gz", ArchiveLimits{MaxTotalSize: 1024})
+	assert.ErrorIs(t, err, ErrArchiveTooLarge)
+
+	_, err = fs.GetFile("missing.csv")
+	assert.Error(t, err)
+
+	assert.NoDirExists(t, uploadDir)
+	assert.NoDirExists(t, downloadDir)
+	assert.Len(t, store.objects, 5)
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"csv-validator/internal/models"
+)
+
+// Names of the readiness checks
+const (
+	CheckUploadDir   = "upload_dir"
+	CheckDownloadDir = "download_dir"
+	CheckJobStore    = "job_store"
+	CheckJobQueue    = "job_queue"
+)
+
+// HealthConfig configures the readiness checks
+type HealthConfig struct {
+	// MinFreeBytes is the free space the upload and download directories need
+	// when they are on the local filesystem
+	MinFreeBytes int64
+	// MaxActiveJobs is how many jobs may be pending or processing before the
+	// service reports itself saturated; 0 means no limit
+	MaxActiveJobs int64
+	// Timeout bounds each check; a check still running by then fails
+	Timeout time.Duration
+}
+
+// healthCheck looks at one thing the service depends on. Details are reported
+// even when the check fails, so callers can see how close to a limit it is.
+type healthCheck func(ctx context.Context) (details map[string]int64, err error)
+
+// HealthService decides whether the service is ready to take work: whether
+// files can be stored, and whether the job store answers and has room
+type HealthService struct {
+	cfg         HealthConfig
+	fileService *FileService
+	jobService  *JobService
+}
+
+// NewHealthService creates a health service checking the given services
+func NewHealthService(cfg HealthConfig, fileService *FileService, jobService *JobService) *HealthService {
+	return &HealthService{
+		cfg:         cfg,
+		fileService: fileService,
+		jobService:  jobService,
+	}
+}
+
+// Ready runs every readiness check at once and reports each result. The
+// service is ready only when every check passed.
+func (hs *HealthService) Ready(ctx context.Context) models.ReadinessResponse {
+	checks := map[string]healthCheck{
+		CheckUploadDir: func(ctx context.Context) (map[string]int64, error) {
+			return hs.checkDir(ctx, hs.fileService.GetUploadDir())
+		},
+		CheckDownloadDir: func(ctx context.Context) (map[string]int64, error) {
+			return hs.checkDir(ctx, hs.fileService.GetDownloadDir())
+		},
+		CheckJobStore: hs.checkJobStore,
+		CheckJobQueue: hs.checkJobQueue,
+	}
+
+	response := models.ReadinessResponse{
+		Status: models.ReadinessReady,
+		Checks: make(map[string]models.CheckResult, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check healthCheck) {
+			defer wg.Done()
+			result := hs.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[name] = result
+			if result.Status != models.CheckPass {
+				response.Status = models.ReadinessNotReady
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return response
+}
+
+// run runs check, failing it if it doesn't finish within the timeout. A check
+// stuck on a hung filesystem is left behind rather than waited for.
+func (hs *HealthService) run(ctx context.Context, check healthCheck) models.CheckResult {
+	if hs.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hs.cfg.Timeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		details map[string]int64
+		err     error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		details, err := check(ctx)
+		done <- outcome{details, err}
+	}()
+
+	var result outcome
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result.err = fmt.Errorf("check did not finish: %w", ctx.Err())
+	}
+
+	checkResult := models.CheckResult{
+		Status:     models.CheckPass,
+		DurationMs: time.Since(start).Milliseconds(),
+		Details:    result.details,
+	}
+	if result.err != nil {
+		checkResult.Status = models.CheckFail
+		checkResult.Error = result.err.Error()
+	}
+	return checkResult
+}
+
+// checkDir makes sure a file can be stored in dir and, on the local
+// filesystem, that enough space is left for more
+func (hs *HealthService) checkDir(ctx context.Context, dir string) (map[string]int64, error) {
+	if err := hs.fileService.CheckWritable(ctx, dir); err != nil {
+		return nil, err
+	}
+
+	free, ok, err := hs.fileService.FreeSpace(ctx, dir)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	details := map[string]int64{"free_bytes": free, "min_free_bytes": hs.cfg.MinFreeBytes}
+	if free < hs.cfg.MinFreeBytes {
+		return details, fmt.Errorf("only %d bytes free, %d required", free, hs.cfg.MinFreeBytes)
+	}
+	return details, nil
+}
+
+// checkJobStore makes sure the job store answers, which it won't while its
+// lock is stuck
+func (hs *HealthService) checkJobStore(ctx context.Context) (map[string]int64, error) {
+	var jobs int64
+	for _, count := range hs.jobService.CountByStatus() {
+		jobs += int64(count)
+	}
+	return map[string]int64{"jobs": jobs}, nil
+}
+
+// checkJobQueue fails when so many jobs are pending or processing that new ones
+// would wait too long
+func (hs *HealthService) checkJobQueue(ctx context.Context) (map[string]int64, error) {
+	counts := hs.jobService.CountByStatus()
+	active := int64(counts[models.JobStatusPending] + counts[models.JobStatusProcessing])
+
+	details := map[string]int64{"active_jobs": active}
+	if hs.cfg.MaxActiveJobs == 0 {
+		return details, nil
+	}
+
+	details["max_active_jobs"] = hs.cfg.MaxActiveJobs
+	if active >= hs.cfg.MaxActiveJobs {
+		return details, fmt.Errorf("%d jobs pending or processing, at most %d allowed", active, hs.cfg.MaxActiveJobs)
+	}
+	return details, nil
+}
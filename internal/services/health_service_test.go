@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"csv-validator/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthService_Ready(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(filepath.Join(tempDir, "uploads"), filepath.Join(tempDir, "downloads"))
+	js := NewJobService()
+	hs := NewHealthService(HealthConfig{MaxActiveJobs: 2, Timeout: time.Second}, fs, js)
+
+	readiness := hs.Ready(context.Background())
+	assert.Equal(t, models.ReadinessReady, readiness.Status)
+	require.Len(t, readiness.Checks, 4)
+	for name, check := range readiness.Checks {
+		assert.Equal(t, models.CheckPass, check.Status, name)
+		assert.Empty(t, check.Error, name)
+	}
+	assert.Equal(t, int64(0), readiness.Checks[CheckJobQueue].Details["active_jobs"])
+	assert.Equal(t, int64(2), readiness.Checks[CheckJobQueue].Details["max_active_jobs"])
+
+	// Probe files don't linger
+	entries, err := os.ReadDir(filepath.Join(tempDir, "uploads"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Two jobs waiting saturate the queue; finished ones don't count
+	js.CreateJob("a.csv")
+	js.CreateJob("b.csv")
+	require.NoError(t, js.UpdateJobStatus(js.CreateJob("c.csv").ID, models.JobStatusCompleted))
+
+	readiness = hs.Ready(context.Background())
+	assert.Equal(t, models.ReadinessNotReady, readiness.Status)
+	assert.Equal(t, models.CheckFail, readiness.Checks[CheckJobQueue].Status)
+	assert.Contains(t, readiness.Checks[CheckJobQueue].Error, "2 jobs pending or processing")
+	assert.Equal(t, int64(3), readiness.Checks[CheckJobStore].Details["jobs"])
+	assert.Equal(t, models.CheckPass, readiness.Checks[CheckUploadDir].Status)
+}
+
+func TestHealthService_Ready_FreeSpace(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(filepath.Join(tempDir, "uploads"), filepath.Join(tempDir, "downloads"))
+	if _, ok, _ := fs.FreeSpace(context.Background(), tempDir); !ok {
+		t.Skip("free space can't be measured on this platform")
+	}
+
+	// No disk has this much room
+	hs := NewHealthService(HealthConfig{MinFreeBytes: 1 << 62}, fs, NewJobService())
+	readiness := hs.Ready(context.Background())
+	assert.Equal(t, models.ReadinessNotReady, readiness.Status)
+
+	check := readiness.Checks[CheckDownloadDir]
+	assert.Equal(t, models.CheckFail, check.Status)
+	assert.Contains(t, check.Error, "bytes free")
+	assert.Positive(t, check.Details["free_bytes"])
+	assert.Equal(t, int64(1<<62), check.Details["min_free_bytes"])
+}
+
+func TestHealthService_Ready_Unwritable(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(filepath.Join(tempDir, "uploads"), filepath.Join(tempDir, "downloads"))
+
+	// A file where the upload directory should be can't hold anything
+	require.NoError(t, os.RemoveAll(filepath.Join(tempDir, "uploads")))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "uploads"), []byte("x"), 0644))
+
+	readiness := NewHealthService(HealthConfig{}, fs, NewJobService()).Ready(context.Background())
+	assert.Equal(t, models.ReadinessNotReady, readiness.Status)
+	assert.Equal(t, models.CheckFail, readiness.Checks[CheckUploadDir].Status)
+	assert.Contains(t, readiness.Checks[CheckUploadDir].Error, "probe file")
+	assert.Equal(t, models.CheckPass, readiness.Checks[CheckDownloadDir].Status)
+}
+
+func TestHealthService_Ready_RemoteStorage(t *testing.T) {
+	// Object stores don't run out of space, so only writing is checked
+	store := newMemoryStorage()
+	fs := NewFileServiceWithStorage("uploads", "downloads", store)
+
+	readiness := NewHealthService(HealthConfig{MinFreeBytes: 1 << 62}, fs, NewJobService()).Ready(context.Background())
+	assert.Equal(t, models.ReadinessReady, readiness.Status)
+	assert.Empty(t, readiness.Checks[CheckUploadDir].Details)
+	assert.Empty(t, store.objects)
+}
+
+func TestHealthService_Ready_Timeout(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(filepath.Join(tempDir, "uploads"), filepath.Join(tempDir, "downloads"))
+	js := NewJobService()
+	hs := NewHealthService(HealthConfig{Timeout: 20 * time.Millisecond}, fs, js)
+
+	// A job store stuck on its lock doesn't hold up the answer
+	js.mu.Lock()
+	readiness := hs.Ready(context.Background())
+	js.mu.Unlock()
+
+	assert.Equal(t, models.ReadinessNotReady, readiness.Status)
+	assert.Equal(t, models.CheckFail, readiness.Checks[CheckJobStore].Status)
+	assert.Contains(t, readiness.Checks[CheckJobStore].Error, "did not finish")
+	assert.Equal(t, models.CheckPass, readiness.Checks[CheckUploadDir].Status)
+}
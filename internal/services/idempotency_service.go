@@ -0,0 +1,100 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// IdempotentResponse is a response recorded for an idempotency key
+type IdempotentResponse struct {
+	Status int
+	Body   []byte
+}
+
+// idempotencyEntry tracks one key. response is nil while the first request
+// with the key is still being handled.
+type idempotencyEntry struct {
+	payloadHash string
+	response    *IdempotentResponse
+	createdAt   time.Time
+}
+
+// IdempotencyService remembers the response to each request sent with an
+// Idempotency-Key, so a client retrying the request gets the same response
+// instead of creating the work twice
+type IdempotencyService struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	now     func() time.Time
+}
+
+// NewIdempotencyService creates a service that remembers keys for ttl
+func NewIdempotencyService(ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+		now:     time.Now,
+	}
+}
+
+// Begin claims key for a request whose payload hashes to payloadHash. It returns
+// nil when the caller should handle the request and then Complete or Release the
+// key, or the recorded response when the same request was already handled. A key
+// reused for another payload fails with ErrIdempotencyKeyReused, and one whose
+// first request is still running with ErrIdempotencyKeyInProgress.
+func (s *IdempotencyService) Begin(key, payloadHash string) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+
+	entry, exists := s.entries[key]
+	if !exists {
+		s.entries[key] = &idempotencyEntry{payloadHash: payloadHash, createdAt: s.now()}
+		return nil, nil
+	}
+
+	if entry.payloadHash != payloadHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if entry.response == nil {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	return entry.response, nil
+}
+
+// Complete records the response for a key claimed with Begin
+func (s *IdempotencyService) Complete(key string, status int, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, exists := s.entries[key]; exists {
+		entry.response = &IdempotentResponse{Status: status, Body: append([]byte(nil), body...)}
+	}
+}
+
+// Release forgets a key claimed with Begin without recording a response, so the
+// request can be retried, for example after a server error
+func (s *IdempotencyService) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+}
+
+// expire drops keys older than the ttl. Callers must hold the lock.
+func (s *IdempotencyService) expire() {
+	if s.ttl <= 0 {
+		return
+	}
+
+	cutoff := s.now().Add(-s.ttl)
+	for key, entry := range s.entries {
+		if entry.createdAt.Before(cutoff) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyService(t *testing.T) {
+	s := NewIdempotencyService(time.Hour)
+
+	// First use claims the key
+	response, err := s.Begin("key-1", "hash-a")
+	require.NoError(t, err)
+	assert.Nil(t, response)
+
+	// Retries while it runs are told to wait
+	_, err = s.Begin("key-1", "hash-a")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyInProgress)
+
+	s.Complete("key-1", 200, []byte(`{"id":"job-1"}`))
+
+	// Retries get the recorded response
+	response, err = s.Begin("key-1", "hash-a")
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.Equal(t, 200, response.Status)
+	assert.Equal(t, `{"id":"job-1"}`, string(response.Body))
+
+	// Another payload under the same key is rejected
+	_, err = s.Begin("key-1", "hash-b")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	// Released keys can be used again
+	_, err = s.Begin("key-2", "hash-a")
+	require.NoError(t, err)
+	s.Release("key-2")
+	response, err = s.Begin("key-2", "hash-b")
+	require.NoError(t, err)
+	assert.Nil(t, response)
+}
+
+func TestIdempotencyService_Expiry(t *testing.T) {
+	s := NewIdempotencyService(time.Hour)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	_, err := s.Begin("key-1", "hash-a")
+	require.NoError(t, err)
+	s.Complete("key-1", 200, []byte("{}"))
+
+	// Past the window the key is forgotten
+	now = now.Add(2 * time.Hour)
+	response, err := s.Begin("key-1", "hash-b")
+	require.NoError(t, err)
+	assert.Nil(t, response)
+}
@@ -1,36 +1,183 @@
 package services
 
 import (
+	"errors"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
+	"csv-validator/internal/metrics"
 	"csv-validator/internal/models"
 
 	"github.com/google/uuid"
 )
 
+// maxJobEvents is how many of its most recent events are kept per job, for
+// clients catching up on what they missed
+const maxJobEvents = 100
+
+// JobListener is called with every job event, in the order the events happened.
+// Listeners run on the goroutine that caused the event, so they must return
+// quickly, and must not change jobs themselves.
+type JobListener func(event models.JobEvent)
+
+// jobEventLog holds the most recent events of a job
+type jobEventLog struct {
+	lastID int64
+	events []models.JobEvent
+}
+
 // JobService manages file processing jobs
 type JobService struct {
-	jobs map[string]*models.Job
-	mu   sync.RWMutex
+	jobs    map[string]*models.Job
+	batches map[string][]string
+	events  map[string]*jobEventLog
+	mu      sync.RWMutex
+
+	listeners    map[int]JobListener
+	nextListener int
+	// notifyMu is held while events are recorded and handed to listeners, so
+	// listeners see them in order
+	notifyMu sync.Mutex
 }
 
 // NewJobService creates a new job service
 func NewJobService() *JobService {
 	return &JobService{
-		jobs: make(map[string]*models.Job),
+		jobs:      make(map[string]*models.Job),
+		batches:   make(map[string][]string),
+		events:    make(map[string]*jobEventLog),
+		listeners: make(map[int]JobListener),
+	}
+}
+
+// Subscribe registers a listener for the events of all jobs and returns a
+// function that removes it again
+func (js *JobService) Subscribe(listener JobListener) (unsubscribe func()) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	id := js.nextListener
+	js.nextListener++
+	js.listeners[id] = listener
+
+	return func() {
+		js.mu.Lock()
+		defer js.mu.Unlock()
+		delete(js.listeners, id)
 	}
 }
 
+// EventsSince returns the recorded events of a job with an ID above afterID,
+// oldest first. Only the most recent events are kept, so the first one returned
+// may be later than afterID+1. The boolean reports whether the job exists.
+func (js *JobService) EventsSince(id string, afterID int64) ([]models.JobEvent, bool) {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	if _, exists := js.jobs[id]; !exists {
+		return nil, false
+	}
+
+	var events []models.JobEvent
+	if log := js.events[id]; log != nil {
+		for _, event := range log.events {
+			if event.ID > afterID {
+				events = append(events, event)
+			}
+		}
+	}
+
+	return events, true
+}
+
 // CreateJob creates a new job with pending status
 func (js *JobService) CreateJob(originalFile string) *models.Job {
+	return js.CreateJobWithOptions(models.Identity{}, originalFile, models.ProcessingOptions{})
+}
+
+// CreateJobWithOptions creates a new pending job that will be processed with the
+// given options. creator is the caller creating it, empty without authentication.
+// The job is visible to others at once, so a copy is returned; change it
+// through the service.
+func (js *JobService) CreateJobWithOptions(creator models.Identity, originalFile string, options models.ProcessingOptions) *models.Job {
+	var jobCopy models.Job
+	js.publish(func() []models.JobEvent {
+		job := js.newJob(creator, originalFile, options)
+		jobCopy = *job
+		return []models.JobEvent{js.record(job, models.JobEventStatus, "")}
+	})
+
+	return &jobCopy
+}
+
+// CreateBatch creates one pending job per file, grouped under batchID, and
+// returns copies of them like CreateJobWithOptions
+func (js *JobService) CreateBatch(creator models.Identity, batchID string, originalFiles []string, options models.ProcessingOptions) []*models.Job {
+	jobs := make([]*models.Job, len(originalFiles))
+	js.publish(func() []models.JobEvent {
+		events := make([]models.JobEvent, len(originalFiles))
+		for i, originalFile := range originalFiles {
+			job := js.newJob(creator, originalFile, options)
+			job.BatchID = batchID
+			js.batches[batchID] = append(js.batches[batchID], job.ID)
+			jobCopy := *job
+			jobs[i] = &jobCopy
+			events[i] = js.record(job, models.JobEventStatus, "")
+		}
+		return events
+	})
+
+	return jobs
+}
+
+// AttachUpload records where a job's upload was stored and the SHA-256 of its
+// content, once it has been saved. A non-empty filename replaces the name the
+// job was created with.
+func (js *JobService) AttachUpload(id, path, sha256, filename string) error {
 	js.mu.Lock()
 	defer js.mu.Unlock()
 
+	job, exists := js.jobs[id]
+	if !exists {
+		return ErrJobNotFound
+	}
+
+	job.OriginalFile = path
+	job.SHA256 = sha256
+	if filename != "" {
+		job.Filename = filename
+	}
+	return nil
+}
+
+// ListBatchJobs returns the jobs of a batch in the order they were created
+func (js *JobService) ListBatchJobs(batchID string) []*models.Job {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	var jobs []*models.Job
+	for _, id := range js.batches[batchID] {
+		if job, exists := js.jobs[id]; exists {
+			jobCopy := *job
+			jobs = append(jobs, &jobCopy)
+		}
+	}
+
+	return jobs
+}
+
+// newJob registers a new pending job. Callers must hold the write lock.
+func (js *JobService) newJob(creator models.Identity, originalFile string, options models.ProcessingOptions) *models.Job {
 	job := &models.Job{
 		ID:           uuid.New().String(),
 		Status:       models.JobStatusPending,
+		Filename:     filepath.Base(originalFile),
 		OriginalFile: originalFile,
+		Owner:        creator.Tenant,
+		CreatedBy:    creator.Subject,
+		Options:      options,
 		CreatedAt:    time.Now(),
 	}
 
@@ -53,23 +200,175 @@ func (js *JobService) GetJob(id string) (*models.Job, bool) {
 	return &jobCopy, true
 }
 
+// FindCompletedDuplicate returns a completed job of owner, other than excludeID,
+// that processed content with the given SHA-256 using the same options. Where the
+// jobs report to does not affect their result, so callback URLs are ignored.
+func (js *JobService) FindCompletedDuplicate(owner, sha256 string, options models.ProcessingOptions, excludeID string) (*models.Job, bool) {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	options.CallbackURL = ""
+	for _, job := range js.jobs {
+		jobOptions := job.Options
+		jobOptions.CallbackURL = ""
+		if job.ID != excludeID && job.Owner == owner && job.Status == models.JobStatusCompleted &&
+			job.SHA256 == sha256 && jobOptions == options && job.ProcessedFile != "" {
+			jobCopy := *job
+			return &jobCopy, true
+		}
+	}
+
+	return nil, false
+}
+
+// CompleteAsDuplicate completes a job with the result of source, recording
+// which job originally produced it
+func (js *JobService) CompleteAsDuplicate(id string, source *models.Job) error {
+	return js.transition(id, func(job *models.Job) error {
+		job.ProcessedFile = source.ProcessedFile
+		if source.Summary != nil {
+			summary := *source.Summary
+			job.Summary = &summary
+		}
+
+		job.DeduplicatedFrom = source.ID
+		if source.DeduplicatedFrom != "" {
+			job.DeduplicatedFrom = source.DeduplicatedFrom
+		}
+
+		job.Status = models.JobStatusCompleted
+		return nil
+	})
+}
+
 // UpdateJobStatus updates the status of a job
 func (js *JobService) UpdateJobStatus(id string, status models.JobStatus) error {
+	return js.transition(id, func(job *models.Job) error {
+		job.Status = status
+		return nil
+	})
+}
+
+// CancelJob stops a pending or processing job from producing a result
+func (js *JobService) CancelJob(id string) (*models.Job, error) {
+	err := js.transition(id, func(job *models.Job) error {
+		if job.Status.IsFinished() {
+			return ErrJobFinished
+		}
+		job.Status = models.JobStatusCancelled
+		return nil
+	})
+	if errors.Is(err, ErrJobCancelled) {
+		return nil, ErrJobFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Cancelled jobs no longer change
+	job, _ := js.GetJob(id)
+	return job, nil
+}
+
+// transition applies change to a job and records a status event if its status
+// changed. A cancelled job keeps its status: updates from work that was still
+// running for it fail with ErrJobCancelled.
+func (js *JobService) transition(id string, change func(job *models.Job) error) error {
+	var err error
+	js.publish(func() []models.JobEvent {
+		job, exists := js.jobs[id]
+		if !exists {
+			err = ErrJobNotFound
+			return nil
+		}
+		if job.Status == models.JobStatusCancelled {
+			err = ErrJobCancelled
+			return nil
+		}
+
+		previous := job.Status
+		if err = change(job); err != nil {
+			return nil
+		}
+		if job.Status.IsFinished() {
+			now := time.Now()
+			job.CompletedAt = &now
+			job.Progress = nil
+
+			if !previous.IsFinished() {
+				metrics.JobDuration.WithLabelValues(string(job.Status)).Observe(now.Sub(job.CreatedAt).Seconds())
+			}
+		}
+
+		if job.Status == previous {
+			return nil
+		}
+		return []models.JobEvent{js.record(job, models.JobEventStatus, previous)}
+	})
+
+	return err
+}
+
+// UpdateJobProgress records how far processing of a job has got. Progress
+// reported for a job that is no longer processing is ignored.
+func (js *JobService) UpdateJobProgress(id string, progress models.JobProgress) error {
+	var err error
+	js.publish(func() []models.JobEvent {
+		job, exists := js.jobs[id]
+		if !exists {
+			err = ErrJobNotFound
+			return nil
+		}
+		if job.Status != models.JobStatusProcessing {
+			return nil
+		}
+
+		job.Progress = &progress
+		return []models.JobEvent{js.record(job, models.JobEventProgress, "")}
+	})
+
+	return err
+}
+
+// publish runs update under the write lock, then hands the events it recorded
+// to every listener once the lock is released
+func (js *JobService) publish(update func() []models.JobEvent) {
+	js.notifyMu.Lock()
+	defer js.notifyMu.Unlock()
+
 	js.mu.Lock()
-	defer js.mu.Unlock()
+	events := update()
+	listeners := make([]JobListener, 0, len(js.listeners))
+	for _, listener := range js.listeners {
+		listeners = append(listeners, listener)
+	}
+	js.mu.Unlock()
 
-	job, exists := js.jobs[id]
-	if !exists {
-		return ErrJobNotFound
+	for _, event := range events {
+		for _, listener := range listeners {
+			listener(event)
+		}
 	}
+}
 
-	job.Status = status
-	if status == models.JobStatusCompleted || status == models.JobStatusFailed {
-		now := time.Now()
-		job.CompletedAt = &now
+// record adds an event with the current state of job to its log; previous is
+// the status a status change came from. Callers must hold the write lock.
+func (js *JobService) record(job *models.Job, eventType models.JobEventType, previous models.JobStatus) models.JobEvent {
+	log := js.events[job.ID]
+	if log == nil {
+		log = &jobEventLog{}
+		js.events[job.ID] = log
 	}
 
-	return nil
+	log.lastID++
+	event := models.JobEvent{ID: log.lastID, Type: eventType, PreviousStatus: previous, Job: *job, Time: time.Now()}
+
+	log.events = append(log.events, event)
+	if len(log.events) > maxJobEvents {
+		log.events = log.events[len(log.events)-maxJobEvents:]
+	}
+
+	return event
 }
 
 // UpdateJobProcessedFile updates the processed file path for a job
@@ -86,8 +385,8 @@ func (js *JobService) UpdateJobProcessedFile(id string, processedFile string) er
 	return nil
 }
 
-// UpdateJobError updates the error message for a job
-func (js *JobService) UpdateJobError(id string, errorMessage string) error {
+// UpdateJobSummary records the row counts collected while processing a job
+func (js *JobService) UpdateJobSummary(id string, summary models.JobSummary) error {
 	js.mu.Lock()
 	defer js.mu.Unlock()
 
@@ -96,15 +395,20 @@ func (js *JobService) UpdateJobError(id string, errorMessage string) error {
 		return ErrJobNotFound
 	}
 
-	job.ErrorMessage = errorMessage
-	job.Status = models.JobStatusFailed
-	now := time.Now()
-	job.CompletedAt = &now
-
+	job.Summary = &summary
 	return nil
 }
 
-// ListJobs returns all jobs (for debugging/monitoring)
+// UpdateJobError updates the error message for a job
+func (js *JobService) UpdateJobError(id string, errorMessage string) error {
+	return js.transition(id, func(job *models.Job) error {
+		job.ErrorMessage = errorMessage
+		job.Status = models.JobStatusFailed
+		return nil
+	})
+}
+
+// ListJobs returns all jobs, newest first
 func (js *JobService) ListJobs() []*models.Job {
 	js.mu.RLock()
 	defer js.mu.RUnlock()
@@ -115,9 +419,83 @@ func (js *JobService) ListJobs() []*models.Job {
 		jobs = append(jobs, &jobCopy)
 	}
 
+	sortNewestFirst(jobs)
 	return jobs
 }
 
+// ListOwnerJobs returns the jobs created by owner, newest first
+func (js *JobService) ListOwnerJobs(owner string) []*models.Job {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	var jobs []*models.Job
+	for _, job := range js.jobs {
+		if job.Owner == owner {
+			jobCopy := *job
+			jobs = append(jobs, &jobCopy)
+		}
+	}
+
+	sortNewestFirst(jobs)
+	return jobs
+}
+
+// CountOwnerJobs returns how many jobs of owner are pending or processing, and
+// how many it created since the given time
+func (js *JobService) CountOwnerJobs(owner string, since time.Time) (active, created int) {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	for _, job := range js.jobs {
+		if job.Owner != owner {
+			continue
+		}
+		if !job.Status.IsFinished() {
+			active++
+		}
+		if !job.CreatedAt.Before(since) {
+			created++
+		}
+	}
+
+	return active, created
+}
+
+// UsesFile reports whether any job reads its upload from path
+func (js *JobService) UsesFile(path string) bool {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	for _, job := range js.jobs {
+		if job.OriginalFile == path {
+			return true
+		}
+	}
+	return false
+}
+
+// CountByStatus returns how many jobs are held in each status
+func (js *JobService) CountByStatus() map[models.JobStatus]int {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+
+	counts := make(map[models.JobStatus]int)
+	for _, job := range js.jobs {
+		counts[job.Status]++
+	}
+	return counts
+}
+
+// sortNewestFirst orders jobs by creation time, newest first
+func sortNewestFirst(jobs []*models.Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
+
 // CleanupOldJobs removes jobs older than the specified duration
 func (js *JobService) CleanupOldJobs(maxAge time.Duration) int {
 	js.mu.Lock()
@@ -129,9 +507,26 @@ func (js *JobService) CleanupOldJobs(maxAge time.Duration) int {
 	for id, job := range js.jobs {
 		if job.CreatedAt.Before(cutoff) {
 			delete(js.jobs, id)
+			delete(js.events, id)
 			removed++
 		}
 	}
 
+	// Forget batches whose jobs have all been removed
+	for batchID, ids := range js.batches {
+		remaining := ids[:0]
+		for _, id := range ids {
+			if _, exists := js.jobs[id]; exists {
+				remaining = append(remaining, id)
+			}
+		}
+
+		if len(remaining) == 0 {
+			delete(js.batches, batchID)
+		} else {
+			js.batches[batchID] = remaining
+		}
+	}
+
 	return removed
 }
@@ -4,9 +4,13 @@ import (
 	"testing"
 	"time"
 
+	"csv-validator/internal/metrics"
 	"csv-validator/internal/models"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestJobService_CreateJob(t *testing.T) {
@@ -95,6 +99,79 @@ func TestJobService_UpdateJobProcessedFile(t *testing.T) {
 	assert.Equal(t, ErrJobNotFound, err)
 }
 
+func TestJobService_CreateJobWithOptions(t *testing.T) {
+	js := NewJobService()
+
+	options := models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyDrop}
+	job := js.CreateJobWithOptions(models.Identity{Tenant: "acme", Subject: "user-1"}, "test.csv", options)
+
+	storedJob, exists := js.GetJob(job.ID)
+	assert.True(t, exists)
+	assert.Equal(t, options, storedJob.Options)
+	assert.Equal(t, "acme", storedJob.Owner)
+	assert.Equal(t, "user-1", storedJob.CreatedBy)
+}
+
+func TestJobService_AttachUpload(t *testing.T) {
+	js := NewJobService()
+
+	job := js.CreateJob("people.csv")
+
+	// The returned job is a copy; changing it changes nothing
+	job.Status = models.JobStatusFailed
+	stored, _ := js.GetJob(job.ID)
+	assert.Equal(t, models.JobStatusPending, stored.Status)
+
+	require.NoError(t, js.AttachUpload(job.ID, "uploads/sha256/ab/abc.csv", "abc", ""))
+	stored, _ = js.GetJob(job.ID)
+	assert.Equal(t, "uploads/sha256/ab/abc.csv", stored.OriginalFile)
+	assert.Equal(t, "abc", stored.SHA256)
+	assert.Equal(t, "people.csv", stored.Filename)
+
+	require.NoError(t, js.AttachUpload(job.ID, "uploads/sha256/de/def.csv", "def", "renamed.csv"))
+	stored, _ = js.GetJob(job.ID)
+	assert.Equal(t, "renamed.csv", stored.Filename)
+
+	assert.ErrorIs(t, js.AttachUpload("non-existent", "", "", ""), ErrJobNotFound)
+}
+
+func TestJobService_CreateBatch(t *testing.T) {
+	js := NewJobService()
+
+	options := models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyKeep}
+	jobs := js.CreateBatch(models.Identity{}, "batch-1", []string{"a.csv", "b.csv", "c.csv"}, options)
+	require.Len(t, jobs, 3)
+
+	js.CreateJob("unrelated.csv")
+
+	batchJobs := js.ListBatchJobs("batch-1")
+	require.Len(t, batchJobs, 3)
+	for i, job := range batchJobs {
+		assert.Equal(t, jobs[i].ID, job.ID)
+		assert.Equal(t, "batch-1", job.BatchID)
+		assert.Equal(t, options, job.Options)
+	}
+
+	assert.Empty(t, js.ListBatchJobs("unknown"))
+}
+
+func TestJobService_UpdateJobSummary(t *testing.T) {
+	js := NewJobService()
+
+	job := js.CreateJob("test.csv")
+
+	summary := models.JobSummary{TotalRows: 10, RowsWithEmail: 6, RowsWithoutEmail: 2, EmptyRows: 2}
+	err := js.UpdateJobSummary(job.ID, summary)
+	assert.NoError(t, err)
+
+	updatedJob, exists := js.GetJob(job.ID)
+	assert.True(t, exists)
+	assert.Equal(t, &summary, updatedJob.Summary)
+
+	err = js.UpdateJobSummary("non-existent", summary)
+	assert.Equal(t, ErrJobNotFound, err)
+}
+
 func TestJobService_UpdateJobError(t *testing.T) {
 	js := NewJobService()
 
@@ -118,6 +195,111 @@ func TestJobService_UpdateJobError(t *testing.T) {
 	assert.Equal(t, ErrJobNotFound, err)
 }
 
+func TestJobService_CancelJob(t *testing.T) {
+	js := NewJobService()
+
+	job := js.CreateJob("test.csv")
+	require.NoError(t, js.UpdateJobStatus(job.ID, models.JobStatusProcessing))
+
+	cancelled, err := js.CancelJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusCancelled, cancelled.Status)
+	assert.NotNil(t, cancelled.CompletedAt)
+
+	// Work still running for the job cannot finish it
+	assert.ErrorIs(t, js.UpdateJobStatus(job.ID, models.JobStatusCompleted), ErrJobCancelled)
+	assert.ErrorIs(t, js.UpdateJobError(job.ID, "boom"), ErrJobCancelled)
+	stored, _ := js.GetJob(job.ID)
+	assert.Equal(t, models.JobStatusCancelled, stored.Status)
+
+	// Finished jobs cannot be cancelled
+	_, err = js.CancelJob(job.ID)
+	assert.ErrorIs(t, err, ErrJobFinished)
+
+	done := js.CreateJob("done.csv")
+	require.NoError(t, js.UpdateJobStatus(done.ID, models.JobStatusCompleted))
+	_, err = js.CancelJob(done.ID)
+	assert.ErrorIs(t, err, ErrJobFinished)
+
+	_, err = js.CancelJob("non-existent")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestJobService_Subscribe(t *testing.T) {
+	js := NewJobService()
+
+	var events []models.JobEvent
+	unsubscribe := js.Subscribe(func(event models.JobEvent) {
+		// Listeners run without the lock held
+		_, exists := js.GetJob(event.Job.ID)
+		assert.True(t, exists)
+		events = append(events, event)
+	})
+
+	job := js.CreateJob("test.csv")
+	require.NoError(t, js.UpdateJobStatus(job.ID, models.JobStatusProcessing))
+	require.NoError(t, js.UpdateJobStatus(job.ID, models.JobStatusProcessing))
+	require.NoError(t, js.UpdateJobSummary(job.ID, models.JobSummary{TotalRows: 1}))
+	require.NoError(t, js.UpdateJobProgress(job.ID, models.JobProgress{RowsProcessed: 1000, TotalRows: 4000}))
+	require.NoError(t, js.UpdateJobError(job.ID, "boom"))
+
+	// Creation, changes of status and progress are reported, numbered per job
+	require.Len(t, events, 4)
+	assert.Equal(t, models.JobStatusPending, events[0].Job.Status)
+	assert.Equal(t, models.JobStatusProcessing, events[1].Job.Status)
+	assert.Equal(t, models.JobEventProgress, events[2].Type)
+	assert.Equal(t, 1000, events[2].Job.Progress.RowsProcessed)
+	assert.Equal(t, models.JobEventStatus, events[3].Type)
+	assert.Equal(t, models.JobStatusFailed, events[3].Job.Status)
+	assert.Equal(t, models.JobStatusProcessing, events[3].PreviousStatus)
+	assert.Nil(t, events[3].Job.Progress)
+	for i, event := range events {
+		assert.Equal(t, int64(i+1), event.ID)
+	}
+
+	// Progress is only recorded while processing
+	require.NoError(t, js.UpdateJobProgress(job.ID, models.JobProgress{RowsProcessed: 2000}))
+	assert.Len(t, events, 4)
+
+	unsubscribe()
+	js.CreateJob("other.csv")
+	assert.Len(t, events, 4)
+}
+
+func TestJobService_EventsSince(t *testing.T) {
+	js := NewJobService()
+
+	job := js.CreateJob("test.csv")
+	require.NoError(t, js.UpdateJobStatus(job.ID, models.JobStatusProcessing))
+	require.NoError(t, js.UpdateJobStatus(job.ID, models.JobStatusCompleted))
+
+	events, exists := js.EventsSince(job.ID, 0)
+	require.True(t, exists)
+	require.Len(t, events, 3)
+
+	events, _ = js.EventsSince(job.ID, 2)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.JobStatusCompleted, events[0].Job.Status)
+
+	events, exists = js.EventsSince(job.ID, 3)
+	assert.True(t, exists)
+	assert.Empty(t, events)
+
+	_, exists = js.EventsSince("non-existent", 0)
+	assert.False(t, exists)
+
+	// Only the most recent events are kept
+	busy := js.CreateJob("busy.csv")
+	require.NoError(t, js.UpdateJobStatus(busy.ID, models.JobStatusProcessing))
+	for i := 0; i < maxJobEvents; i++ {
+		require.NoError(t, js.UpdateJobProgress(busy.ID, models.JobProgress{RowsProcessed: i}))
+	}
+	events, _ = js.EventsSince(busy.ID, 0)
+	require.Len(t, events, maxJobEvents)
+	assert.Equal(t, int64(3), events[0].ID)
+	assert.Equal(t, int64(maxJobEvents+2), events[len(events)-1].ID)
+}
+
 func TestJobService_ListJobs(t *testing.T) {
 	js := NewJobService()
 
@@ -149,6 +331,74 @@ func TestJobService_ListJobs(t *testing.T) {
 	assert.True(t, found2)
 }
 
+func TestJobService_ListOwnerJobs(t *testing.T) {
+	js := NewJobService()
+
+	older := js.CreateJobWithOptions(models.Identity{Tenant: "key-1"}, "a.csv", models.ProcessingOptions{})
+	js.CreateJobWithOptions(models.Identity{Tenant: "key-2"}, "b.csv", models.ProcessingOptions{})
+	newer := js.CreateJobWithOptions(models.Identity{Tenant: "key-1"}, "c.csv", models.ProcessingOptions{})
+
+	js.mu.Lock()
+	js.jobs[older.ID].CreatedAt = time.Now().Add(-time.Minute)
+	js.mu.Unlock()
+
+	jobs := js.ListOwnerJobs("key-1")
+	require.Len(t, jobs, 2)
+	assert.Equal(t, newer.ID, jobs[0].ID)
+	assert.Equal(t, older.ID, jobs[1].ID)
+
+	assert.Len(t, js.ListOwnerJobs("key-2"), 1)
+	assert.Empty(t, js.ListOwnerJobs("key-3"))
+}
+
+func TestJobService_CountOwnerJobs(t *testing.T) {
+	js := NewJobService()
+	acme := models.Identity{Tenant: "acme"}
+
+	yesterday := js.CreateJobWithOptions(acme, "a.csv", models.ProcessingOptions{})
+	done := js.CreateJobWithOptions(acme, "b.csv", models.ProcessingOptions{})
+	js.CreateJobWithOptions(acme, "c.csv", models.ProcessingOptions{})
+	js.CreateJobWithOptions(models.Identity{Tenant: "globex"}, "d.csv", models.ProcessingOptions{})
+	require.NoError(t, js.UpdateJobStatus(done.ID, models.JobStatusCompleted))
+
+	js.mu.Lock()
+	js.jobs[yesterday.ID].CreatedAt = time.Now().Add(-25 * time.Hour)
+	js.mu.Unlock()
+
+	active, created := js.CountOwnerJobs("acme", time.Now().Add(-24*time.Hour))
+	assert.Equal(t, 2, active)
+	assert.Equal(t, 2, created)
+}
+
+func TestJobService_CountByStatus(t *testing.T) {
+	js := NewJobService()
+
+	js.CreateJob("a.csv")
+	done := js.CreateJob("b.csv")
+	failed := js.CreateJob("c.csv")
+	require.NoError(t, js.UpdateJobStatus(done.ID, models.JobStatusCompleted))
+	require.NoError(t, js.UpdateJobError(failed.ID, "broken"))
+
+	assert.Equal(t, map[models.JobStatus]int{
+		models.JobStatusPending:   1,
+		models.JobStatusCompleted: 1,
+		models.JobStatusFailed:    1,
+	}, js.CountByStatus())
+
+	// Finished jobs are timed once
+	durations := metrics.JobDuration.WithLabelValues(string(models.JobStatusCompleted)).(prometheus.Histogram)
+	before := histogramCount(t, durations)
+	require.NoError(t, js.UpdateJobStatus(js.CreateJob("d.csv").ID, models.JobStatusCompleted))
+	assert.Equal(t, before+1, histogramCount(t, durations))
+}
+
+// histogramCount returns how many observations h holds
+func histogramCount(t *testing.T, h prometheus.Histogram) uint64 {
+	var metric dto.Metric
+	require.NoError(t, h.Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
 func TestJobService_CleanupOldJobs(t *testing.T) {
 	js := NewJobService()
 
@@ -0,0 +1,406 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"csv-validator/internal/models"
+	"csv-validator/pkg/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksMinRefreshInterval limits how often tokens signed with an unknown key
+	// can make the verifier fetch the key set again
+	jwksMinRefreshInterval = 30 * time.Second
+
+	// jwtLeeway allows for clock skew when checking exp, nbf and iat
+	jwtLeeway = 30 * time.Second
+
+	// maxJWKSSize limits the key set read from a URL
+	maxJWKSSize = 1024 * 1024
+)
+
+// jwtMethods are the signing algorithms accepted. HMAC is left out: the
+// verifier only knows public keys.
+var jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// JWTConfig configures bearer token verification
+type JWTConfig struct {
+	// JWKSURL or JWKSFile is where the identity provider's public keys are read from
+	JWKSURL  string
+	JWKSFile string
+	// Issuer and Audience, when set, must match the iss and aud claims
+	Issuer   string
+	Audience string
+	// TenantClaim names the claim holding the caller's tenant. Nested claims are
+	// separated by dots, e.g. "org.id".
+	TenantClaim string
+	// RolesClaim names the claim holding the caller's roles, as a list or a
+	// space-separated string
+	RolesClaim string
+	// AdminRole is the role granting models.RoleAdmin
+	AdminRole string
+	// RefreshInterval is how long the key set is used before it is read again
+	RefreshInterval time.Duration
+	// Client is the HTTP client used to fetch the key set, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// JWTVerifier checks bearer tokens against the keys of a JWKS and maps their
+// claims to an identity
+type JWTVerifier struct {
+	cfg    JWTConfig
+	client *http.Client
+	parser *jwt.Parser
+
+	mu       sync.RWMutex
+	keys     map[string]jwk
+	loadedAt time.Time
+
+	// refreshMu serialises key set reloads, which lastRefresh throttles
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+	minRefresh  time.Duration
+}
+
+// jwk is a public key from a key set
+type jwk struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// NewJWTVerifier creates a verifier and loads the key set, failing if it can't
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	if cfg.TenantClaim == "" {
+		return nil, fmt.Errorf("a tenant claim is required")
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtMethods),
+		jwt.WithLeeway(jwtLeeway),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	v := &JWTVerifier{
+		cfg:        cfg,
+		client:     client,
+		parser:     jwt.NewParser(options...),
+		minRefresh: jwksMinRefreshInterval,
+	}
+
+	keys, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+	v.keys = keys
+	v.loadedAt = time.Now()
+	v.lastRefresh = v.loadedAt
+
+	return v, nil
+}
+
+// Verify checks the signature and claims of token and returns the identity it
+// carries, or an error wrapping ErrInvalidToken
+func (v *JWTVerifier) Verify(token string) (models.Identity, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keyFunc); err != nil {
+		return models.Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	tenant, _ := claimValue(claims, v.cfg.TenantClaim).(string)
+	if tenant == "" {
+		return models.Identity{}, fmt.Errorf("%w: no %s claim", ErrInvalidToken, v.cfg.TenantClaim)
+	}
+
+	identity := models.Identity{Tenant: tenant}
+	identity.Subject, _ = claims["sub"].(string)
+
+	for _, role := range claimStrings(claimValue(claims, v.cfg.RolesClaim)) {
+		if v.cfg.AdminRole != "" && role == v.cfg.AdminRole {
+			role = models.RoleAdmin
+		} else if role == models.RoleAdmin {
+			// Only the configured admin role grants admin
+			continue
+		}
+		identity.Roles = append(identity.Roles, role)
+	}
+
+	return identity, nil
+}
+
+// keyFunc finds the key a token was signed with by its kid header. Tokens
+// without a kid are accepted from key sets holding a single key.
+func (v *JWTVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, found := v.key(kid)
+	if !found {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.alg != "" && key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("signing key %q is for %s, not %s", kid, key.alg, token.Method.Alg())
+	}
+
+	return key.key, nil
+}
+
+// key looks up a signing key, reloading the key set when it is due or when the
+// key is unknown, as happens after the identity provider rotates its keys
+func (v *JWTVerifier) key(kid string) (jwk, bool) {
+	v.mu.RLock()
+	key, found := lookupKey(v.keys, kid)
+	stale := v.cfg.RefreshInterval > 0 && time.Since(v.loadedAt) > v.cfg.RefreshInterval
+	v.mu.RUnlock()
+
+	if found && !stale {
+		return key, true
+	}
+
+	v.refresh()
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return lookupKey(v.keys, kid)
+}
+
+// refresh reloads the key set, at most once per minRefresh. Keys already
+// loaded stay in use if it fails.
+func (v *JWTVerifier) refresh() {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	if time.Since(v.lastRefresh) < v.minRefresh {
+		return
+	}
+	v.lastRefresh = time.Now()
+
+	keys, err := v.load()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to reload JWKS: %v", err))
+		return
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.loadedAt = time.Now()
+	v.mu.Unlock()
+}
+
+// load reads and parses the key set from the configured file or URL
+func (v *JWTVerifier) load() (map[string]jwk, error) {
+	var data []byte
+	var err error
+	if v.cfg.JWKSFile != "" {
+		data, err = os.ReadFile(v.cfg.JWKSFile)
+	} else {
+		data, err = v.fetch()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	return parseJWKS(data)
+}
+
+// fetch downloads the key set from JWKSURL
+func (v *JWTVerifier) fetch() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// lookupKey returns the key with the given kid, or the only key of a set when
+// the token names none
+func lookupKey(keys map[string]jwk, kid string) (jwk, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, found := keys[kid]
+	return key, found
+}
+
+// parseJWKS parses the signing keys of a JSON Web Key Set (RFC 7517). Keys of
+// unsupported types or meant for encryption are skipped.
+func parseJWKS(data []byte) (map[string]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]jwk)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			key, err = ecKey(k.Crv, k.X, k.Y)
+		case "OKP":
+			key, err = edKey(k.Crv, k.X)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = jwk{key: key, alg: k.Alg}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS has no signing keys")
+	}
+	return keys, nil
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("bad n: %w", err)
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil || len(exponent) == 0 || len(exponent) > 4 {
+		return nil, fmt.Errorf("bad e")
+	}
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}
+	if key.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+	}
+	return key, nil
+}
+
+func ecKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+
+	xBytes, errX := base64.RawURLEncoding.DecodeString(x)
+	yBytes, errY := base64.RawURLEncoding.DecodeString(y)
+	if errX != nil || errY != nil {
+		return nil, fmt.Errorf("bad coordinates")
+	}
+
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xBytes), Y: new(big.Int).SetBytes(yBytes)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("point is not on %s", crv)
+	}
+	return key, nil
+}
+
+func edKey(crv, x string) (ed25519.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("bad x")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// claimValue returns the claim at a dot-separated path, nil if there is none
+func claimValue(claims jwt.MapClaims, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// claimStrings reads a list of strings from a claim holding a JSON array or a
+// space-separated string
+func claimStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"csv-validator/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwksServer serves a key set that tests can swap out, counting requests
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     []map[string]string
+	requests int
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+}
+
+func (s *jwksServer) set(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *jwksServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "alg": "RS256", "use": "sig",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return map[string]string{"kty": "EC", "kid": kid, "crv": key.Curve.Params().Name,
+		"x": b64(key.X.FillBytes(make([]byte, size))), "y": b64(key.Y.FillBytes(make([]byte, size)))}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    "https://id.example.com",
+		"aud":    "csv-validator",
+		"sub":    "user-1",
+		"tenant": "acme",
+		"roles":  []string{"uploader"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTVerifier_Verify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks := &jwksServer{}
+	jwks.set(rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+	server := httptest.NewServer(jwks)
+	defer server.Close()
+
+	verifier, err := NewJWTVerifier(JWTConfig{
+		JWKSURL:     server.URL,
+		Issuer:      "https://id.example.com",
+		Audience:    "csv-validator",
+		TenantClaim: "tenant",
+		RolesClaim:  "roles",
+		AdminRole:   "csv-admin",
+	})
+	require.NoError(t, err)
+
+	identity, err := verifier.Verify(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, models.Identity{Tenant: "acme", Subject: "user-1", Roles: []string{"uploader"}}, identity)
+
+	// The configured admin role maps to RoleAdmin; a bare "admin" role grants nothing
+	claims := validClaims()
+	claims["roles"] = "admin csv-admin"
+	identity, err = verifier.Verify(signToken(t, jwt.SigningMethodES256, "ec-1", ecKey, claims))
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.RoleAdmin}, identity.Roles)
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"expired", func() string {
+			claims := validClaims()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims)
+		}},
+		{"no expiry", func() string {
+			claims := validClaims()
+			delete(claims, "exp")
+			return signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims)
+		}},
+		{"wrong issuer", func() string {
+			claims := validClaims()
+			claims["iss"] = "https://evil.example.com"
+			return signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims)
+		}},
+		{"wrong audience", func() string {
+			claims := validClaims()
+			claims["aud"] = "other-service"
+			return signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims)
+		}},
+		{"no tenant", func() string {
+			claims := validClaims()
+			delete(claims, "tenant")
+			return signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims)
+		}},
+		{"unknown key", func() string {
+			return signToken(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, validClaims())
+		}},
+		{"wrong key", func() string {
+			return signToken(t, jwt.SigningMethodES256, "rsa-1", ecKey, validClaims())
+		}},
+		{"algorithm not allowed for key", func() string {
+			return signToken(t, jwt.SigningMethodPS256, "rsa-1", rsaKey, validClaims())
+		}},
+		{"hmac", func() string {
+			return signToken(t, jwt.SigningMethodHS256, "rsa-1", []byte("secret"), validClaims())
+		}},
+		{"tampered", func() string {
+			token := signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims())
+			return token[:len(token)-4] + "AAAA"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(tt.token())
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestJWTVerifier_KeyRotation(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks := &jwksServer{}
+	jwks.set(ecJWK("old", &oldKey.PublicKey))
+	server := httptest.NewServer(jwks)
+	defer server.Close()
+
+	verifier, err := NewJWTVerifier(JWTConfig{JWKSURL: server.URL, TenantClaim: "tenant"})
+	require.NoError(t, err)
+	require.Equal(t, 1, jwks.count())
+
+	jwks.set(ecJWK("old", &oldKey.PublicKey), ecJWK("new", &newKey.PublicKey))
+	token := signToken(t, jwt.SigningMethodES256, "new", newKey, validClaims())
+
+	// Unknown keys only trigger a reload once the last one is long enough ago
+	_, err = verifier.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, 1, jwks.count())
+
+	verifier.minRefresh = 0
+	_, err = verifier.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, 2, jwks.count())
+
+	// Known keys don't reload the set
+	_, err = verifier.Verify(signToken(t, jwt.SigningMethodES256, "old", oldKey, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, 2, jwks.count())
+
+	// Keys already loaded stay in use while the key set can't be fetched
+	server.Close()
+	verifier.cfg.RefreshInterval = time.Nanosecond
+	_, err = verifier.Verify(token)
+	assert.NoError(t, err)
+}
+
+func TestJWTVerifier_File(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	jwks := `{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "` + b64(publicKey) + `"}]}`
+	require.NoError(t, os.WriteFile(path, []byte(jwks), 0600))
+
+	verifier, err := NewJWTVerifier(JWTConfig{JWKSFile: path, TenantClaim: "org.id"})
+	require.NoError(t, err)
+
+	// A set with a single key verifies tokens without a kid
+	claims := validClaims()
+	claims["org"] = map[string]interface{}{"id": "globex"}
+	identity, err := verifier.Verify(signToken(t, jwt.SigningMethodEdDSA, "", privateKey, claims))
+	require.NoError(t, err)
+	assert.Equal(t, "globex", identity.Tenant)
+
+	_, err = NewJWTVerifier(JWTConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json"), TenantClaim: "tenant"})
+	assert.Error(t, err)
+}
+
+func TestParseJWKS_Invalid(t *testing.T) {
+	shortKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	offCurve := ecJWK("ec", &ecKey.PublicKey)
+	offCurve["y"] = offCurve["x"]
+
+	encryption := ecJWK("ec", &ecKey.PublicKey)
+	encryption["use"] = "enc"
+
+	tests := []struct {
+		name string
+		keys []map[string]string
+	}{
+		{"empty", nil},
+		{"short RSA key", []map[string]string{rsaJWK("rsa", &shortKey.PublicKey)}},
+		{"point off curve", []map[string]string{offCurve}},
+		{"only encryption keys", []map[string]string{encryption}},
+		{"only unknown types", []map[string]string{{"kty": "oct", "k": "c2VjcmV0"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(map[string]interface{}{"keys": tt.keys})
+			require.NoError(t, err)
+			_, err = parseJWKS(data)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestClaimStrings(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, claimStrings("a  b"))
+	assert.Equal(t, []string{"a", "b"}, claimStrings([]interface{}{"a", 1, "b"}))
+	assert.Nil(t, claimStrings(42))
+	assert.Nil(t, claimStrings(nil))
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimitPruneInterval is how often the memory store forgets buckets that
+// have refilled completely, which behave the same as ones never used
+const rateLimitPruneInterval = time.Minute
+
+// RateLimit configures a token bucket: it holds up to Burst tokens, refilled at
+// Rate tokens per second, and every request takes one
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit lets anything through at all; a zero limit
+// means no limit
+func (l RateLimit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// RateLimitResult is the state of a bucket after taking a token from it
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+	// RetryAfter is how long until the next token, zero when Allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps token buckets by key. The memory store suits a single
+// instance; replicas sharing limits need a store they all reach, such as
+// Redis, that takes tokens atomically.
+type RateLimitStore interface {
+	// Take takes a token from the bucket under key, creating a full bucket for
+	// keys not seen before
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// tokenBucket is a bucket of the memory store
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// MemoryRateLimitStore is a RateLimitStore holding buckets in memory
+type MemoryRateLimitStore struct {
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	mu        sync.Mutex
+
+	// now is the clock, swapped out in tests
+	now func() time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory rate limit store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Take takes a token from the bucket under key
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.prune(now)
+
+	bucket, exists := s.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = bucket
+	}
+	bucket.limit = limit
+
+	// Refill for the time since the bucket was last used
+	elapsed := now.Sub(bucket.last).Seconds()
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+elapsed*limit.Rate)
+	bucket.last = now
+
+	result := RateLimitResult{Allowed: bucket.tokens >= 1}
+	if result.Allowed {
+		bucket.tokens--
+	} else {
+		result.RetryAfter = secondsDuration((1 - bucket.tokens) / limit.Rate)
+	}
+	result.Remaining = int(bucket.tokens)
+	result.ResetAfter = secondsDuration((float64(limit.Burst) - bucket.tokens) / limit.Rate)
+
+	return result, nil
+}
+
+// prune drops the buckets that have refilled completely by now, at most once
+// per rateLimitPruneInterval. Callers must hold the lock.
+func (s *MemoryRateLimitStore) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	s.lastPrune = now
+
+	for key, bucket := range s.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.limit.Rate >= float64(bucket.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets held
+func (s *MemoryRateLimitStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// secondsDuration converts fractional seconds to a duration
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRateLimitStore_Take(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+
+	// Two requests at once, then one every 10 seconds
+	limit := RateLimit{Rate: 0.1, Burst: 2}
+	take := func(key string) RateLimitResult {
+		result, err := store.Take(context.Background(), key, limit)
+		require.NoError(t, err)
+		return result
+	}
+
+	result := take("a")
+	assert.Equal(t, RateLimitResult{Allowed: true, Remaining: 1, ResetAfter: 10 * time.Second}, result)
+	result = take("a")
+	assert.Equal(t, RateLimitResult{Allowed: true, Remaining: 0, ResetAfter: 20 * time.Second}, result)
+
+	result = take("a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 10*time.Second, result.RetryAfter)
+
+	// Other keys have their own bucket
+	assert.True(t, take("b").Allowed)
+
+	now = now.Add(4 * time.Second)
+	result = take("a")
+	assert.False(t, result.Allowed)
+	assert.InDelta(t, 6*time.Second, result.RetryAfter, float64(time.Millisecond))
+
+	now = now.Add(6 * time.Second)
+	assert.True(t, take("a").Allowed)
+	assert.False(t, take("a").Allowed)
+
+	// Buckets that refilled are forgotten
+	now = now.Add(time.Hour)
+	take("c")
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestRateLimit_Enabled(t *testing.T) {
+	assert.True(t, RateLimit{Rate: 1, Burst: 1}.Enabled())
+	assert.False(t, RateLimit{Rate: 1}.Enabled())
+	assert.False(t, RateLimit{Burst: 1}.Enabled())
+}
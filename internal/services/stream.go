@@ -0,0 +1,66 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// sniffLen is how many leading bytes UploadStream keeps for content detection,
+// the same amount ValidateFile reads
+const sniffLen = 512
+
+// UploadStream wraps a request body so that a single pass over it enforces the
+// size limit, computes the SHA-256 of the bytes and keeps the first bytes for
+// DetectContentType.
+type UploadStream struct {
+	r       io.Reader
+	maxSize int64
+	n       int64
+	hash    hash.Hash
+	head    []byte
+}
+
+// NewUploadStream wraps r, failing reads with ErrFileTooLarge once more than
+// maxSize bytes have arrived. Zero means no limit.
+func NewUploadStream(r io.Reader, maxSize int64) *UploadStream {
+	return &UploadStream{
+		r:       r,
+		maxSize: maxSize,
+		hash:    sha256.New(),
+		head:    make([]byte, 0, sniffLen),
+	}
+}
+
+func (s *UploadStream) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.n += int64(n)
+		if s.maxSize > 0 && s.n > s.maxSize {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, s.maxSize)
+		}
+
+		s.hash.Write(p[:n])
+		if room := sniffLen - len(s.head); room > 0 {
+			s.head = append(s.head, p[:min(n, room)]...)
+		}
+	}
+	return n, err
+}
+
+// Size returns the number of bytes read so far
+func (s *UploadStream) Size() int64 {
+	return s.n
+}
+
+// SHA256 returns the hex-encoded SHA-256 of the bytes read so far
+func (s *UploadStream) SHA256() string {
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// Head returns up to the first 512 bytes read
+func (s *UploadStream) Head() []byte {
+	return s.head
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadStream(t *testing.T) {
+	content := "name,email\n" + strings.Repeat("Chirag,Chirag@example.com\n", 100)
+
+	stream := NewUploadStream(strings.NewReader(content), int64(len(content)))
+	data, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+
+	sum := sha256.Sum256([]byte(content))
+	assert.Equal(t, hex.EncodeToString(sum[:]), stream.SHA256())
+	assert.Equal(t, int64(len(content)), stream.Size())
+	assert.Equal(t, content[:512], string(stream.Head()))
+}
+
+func TestUploadStream_TooLarge(t *testing.T) {
+	stream := NewUploadStream(strings.NewReader(strings.Repeat("a", 100)), 99)
+
+	_, err := io.ReadAll(stream)
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+}
+
+func TestFileService_SaveStream(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+
+	stored, err := fs.SaveStream(strings.NewReader("name,email\n"), "test.csv")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(stored.Path, stored.SHA256+".csv"))
+	assert.False(t, stored.Deduplicated)
+
+	data, err := os.ReadFile(stored.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "name,email\n", string(data))
+
+	// The same content is stored once, whatever it is called
+	again, err := fs.SaveStream(strings.NewReader("name,email\n"), "copy.CSV")
+	require.NoError(t, err)
+	assert.Equal(t, stored.Path, again.Path)
+	assert.True(t, again.Deduplicated)
+
+	// Discarding a deduplicated file keeps the content for the first upload
+	fs.Discard(again)
+	assert.FileExists(t, stored.Path)
+
+	// Failed streams leave nothing behind
+	_, err = fs.SaveStream(NewUploadStream(strings.NewReader(strings.Repeat("a", 100)), 10), "big.csv")
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+
+	matches, _ := filepath.Glob(filepath.Join(tempDir, ".upload-*"))
+	assert.Empty(t, matches)
+}
+
+func TestFileService_DiscardSharedContent(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(tempDir, filepath.Join(tempDir, "downloads"))
+	var used string
+	fs.SetInUse(func(path string) bool { return path == used })
+
+	// A second upload of the same content arrives before the first is discarded
+	first, err := fs.SaveStream(strings.NewReader("name,email\n"), "a.csv")
+	require.NoError(t, err)
+	second, err := fs.SaveStream(strings.NewReader("name,email\n"), "b.csv")
+	require.NoError(t, err)
+	require.True(t, second.Deduplicated)
+
+	fs.Discard(first)
+	assert.FileExists(t, first.Path)
+
+	// Once its job reads it, the file outlives every upload of it
+	used = second.Path
+	fs.Release(second)
+	third, err := fs.SaveStream(strings.NewReader("name,email\n"), "c.csv")
+	require.NoError(t, err)
+	fs.Discard(third)
+	assert.FileExists(t, first.Path)
+
+	// A file nobody holds or reads is removed, whichever upload discards it last
+	used = ""
+	fresh, err := fs.SaveStream(strings.NewReader("id\n"), "d.csv")
+	require.NoError(t, err)
+	again, err := fs.SaveStream(strings.NewReader("id\n"), "e.csv")
+	require.NoError(t, err)
+	fs.Discard(fresh)
+	assert.FileExists(t, fresh.Path)
+	fs.Discard(again)
+	assert.NoFileExists(t, fresh.Path)
+}
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     []byte
+		mimeType string
+		valid    bool
+	}{
+		{"data.csv", []byte("name,email\n"), "text/csv", true},
+		{"data.csv", []byte{0x00, 0x01, 0x02}, "", false},
+		{"data.xlsx", []byte("PK\x03\x04rest"), "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", true},
+		{"data.ods", []byte("name,email\n"), "", false},
+		{"data.csv.gz", []byte{0x1f, 0x8b, 0x08}, "application/gzip", true},
+		{"data.csv.gz", []byte("name,email\n"), "", false},
+		{"data.csv.zst", []byte{0x28, 0xb5, 0x2f, 0xfd}, "application/zstd", true},
+		{"data.zip", []byte("PK\x03\x04"), "application/zip", true},
+		{"data.zip", []byte("name"), "", false},
+	}
+
+	for _, tt := range tests {
+		mimeType, err := DetectContentType(tt.name, tt.head)
+		if tt.valid {
+			require.NoError(t, err, tt.name)
+			assert.Equal(t, tt.mimeType, mimeType, tt.name)
+		} else {
+			assert.Error(t, err, tt.name)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"csv-validator/internal/models"
+)
+
+// Quotas a tenant can exceed, named as in the tenants file
+const (
+	QuotaFileSize       = "max_file_size"
+	QuotaStorageBytes   = "max_storage_bytes"
+	QuotaConcurrentJobs = "max_concurrent_jobs"
+	QuotaJobsPerDay     = "max_jobs_per_day"
+)
+
+// jobQuotaWindow is the window jobs are counted in for QuotaJobsPerDay
+const jobQuotaWindow = 24 * time.Hour
+
+// QuotaError reports which limit a tenant would exceed. It matches
+// ErrQuotaExceeded with errors.Is.
+type QuotaError struct {
+	Tenant string
+	Quota  string
+	Limit  int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tenant %q would exceed %s of %d", e.Tenant, e.Quota, e.Limit)
+}
+
+// Is makes every QuotaError match ErrQuotaExceeded
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// TenantService enforces the limits of each tenant. Jobs are counted in the job
+// service and storage is measured in the tenant's directories of the file service.
+type TenantService struct {
+	defaults models.TenantLimits
+	tenants  map[string]models.TenantLimits
+
+	jobService  *JobService
+	fileService *FileService
+
+	// admitMu makes checking the job limits and creating the jobs one step, so
+	// concurrent requests can't both take a tenant's last slot
+	admitMu sync.Mutex
+}
+
+// NewTenantService creates a tenant service applying defaults to every tenant
+// except those listed in tenants, whose own limits override the defaults
+func NewTenantService(defaults models.TenantLimits, tenants []models.Tenant, jobService *JobService, fileService *FileService) (*TenantService, error) {
+	ts := &TenantService{
+		defaults:    defaults,
+		tenants:     make(map[string]models.TenantLimits, len(tenants)),
+		jobService:  jobService,
+		fileService: fileService,
+	}
+
+	for i, tenant := range tenants {
+		if tenant.ID == "" {
+			return nil, fmt.Errorf("tenant %d has no id", i+1)
+		}
+		if _, exists := ts.tenants[tenant.ID]; exists {
+			return nil, fmt.Errorf("duplicate tenant id %q", tenant.ID)
+		}
+
+		ts.tenants[tenant.ID] = models.TenantLimits{
+			MaxFileSize:       overrideLimit(tenant.MaxFileSize, defaults.MaxFileSize),
+			MaxConcurrentJobs: overrideLimit(tenant.MaxConcurrentJobs, defaults.MaxConcurrentJobs),
+			MaxStorageBytes:   overrideLimit(tenant.MaxStorageBytes, defaults.MaxStorageBytes),
+			MaxJobsPerDay:     overrideLimit(tenant.MaxJobsPerDay, defaults.MaxJobsPerDay),
+		}
+	}
+
+	return ts, nil
+}
+
+// overrideLimit resolves a limit from the tenants file: zero keeps the default
+// and negative values lift the limit
+func overrideLimit(value, fallback int64) int64 {
+	switch {
+	case value == 0:
+		return fallback
+	case value < 0:
+		return 0
+	default:
+		return value
+	}
+}
+
+// LoadTenantFile reads per-tenant limits from a JSON file of the form
+// {"tenants": [{"id": "...", "max_file_size": 1048576, "max_jobs_per_day": 100}]}
+func LoadTenantFile(path string) ([]models.Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants: %w", err)
+	}
+
+	var file struct {
+		Tenants []models.Tenant `json:"tenants"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants: %w", err)
+	}
+
+	return file.Tenants, nil
+}
+
+// Limits returns the limits that apply to tenant
+func (ts *TenantService) Limits(tenant string) models.TenantLimits {
+	if limits, exists := ts.tenants[tenant]; exists {
+		return limits
+	}
+	return ts.defaults
+}
+
+// CheckUpload checks that tenant may store a file of size bytes, failing with a
+// QuotaError for files over its file size limit or that would take it over its
+// storage limit. A size below zero means it isn't known yet and only checks
+// that the tenant has storage left.
+func (ts *TenantService) CheckUpload(tenant string, size int64) error {
+	limits := ts.Limits(tenant)
+
+	if limits.MaxFileSize > 0 && size > limits.MaxFileSize {
+		return &QuotaError{Tenant: tenant, Quota: QuotaFileSize, Limit: limits.MaxFileSize}
+	}
+
+	if limits.MaxStorageBytes > 0 {
+		used, err := ts.fileService.ForTenant(tenant).StorageUsed()
+		if err != nil {
+			return err
+		}
+		if used+max(size, 1) > limits.MaxStorageBytes {
+			return &QuotaError{Tenant: tenant, Quota: QuotaStorageBytes, Limit: limits.MaxStorageBytes}
+		}
+	}
+
+	return nil
+}
+
+// CheckStored checks files of the given sizes that tenant has already stored,
+// as CheckUpload does before storing. It is needed wherever the stored size
+// differs from what was checked up front, as for decompressed uploads or
+// streams of unknown length. The files count towards the storage used already.
+func (ts *TenantService) CheckStored(tenant string, sizes ...int64) error {
+	limits := ts.Limits(tenant)
+
+	if limits.MaxFileSize > 0 {
+		for _, size := range sizes {
+			if size > limits.MaxFileSize {
+				return &QuotaError{Tenant: tenant, Quota: QuotaFileSize, Limit: limits.MaxFileSize}
+			}
+		}
+	}
+
+	if limits.MaxStorageBytes > 0 {
+		used, err := ts.fileService.ForTenant(tenant).StorageUsed()
+		if err != nil {
+			return err
+		}
+		if used > limits.MaxStorageBytes {
+			return &QuotaError{Tenant: tenant, Quota: QuotaStorageBytes, Limit: limits.MaxStorageBytes}
+		}
+	}
+
+	return nil
+}
+
+// AdmitJobs runs create, which must create n jobs for tenant, unless that would
+// take the tenant over its concurrent or daily job limits. Nothing is created
+// when it fails with a QuotaError.
+func (ts *TenantService) AdmitJobs(tenant string, n int, create func()) error {
+	ts.admitMu.Lock()
+	defer ts.admitMu.Unlock()
+
+	if err := ts.CheckJobs(tenant, n); err != nil {
+		return err
+	}
+
+	create()
+	return nil
+}
+
+// CheckJobs reports with a QuotaError whether creating n more jobs would take
+// tenant over its concurrent or daily job limits. Only AdmitJobs holds the
+// slots it checked until the jobs exist.
+func (ts *TenantService) CheckJobs(tenant string, n int) error {
+	limits := ts.Limits(tenant)
+	if limits.MaxConcurrentJobs <= 0 && limits.MaxJobsPerDay <= 0 {
+		return nil
+	}
+
+	active, recent := ts.jobService.CountOwnerJobs(tenant, time.Now().Add(-jobQuotaWindow))
+
+	if limits.MaxConcurrentJobs > 0 && int64(active+n) > limits.MaxConcurrentJobs {
+		return &QuotaError{Tenant: tenant, Quota: QuotaConcurrentJobs, Limit: limits.MaxConcurrentJobs}
+	}
+	if limits.MaxJobsPerDay > 0 && int64(recent+n) > limits.MaxJobsPerDay {
+		return &QuotaError{Tenant: tenant, Quota: QuotaJobsPerDay, Limit: limits.MaxJobsPerDay}
+	}
+
+	return nil
+}
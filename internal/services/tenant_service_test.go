@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"csv-validator/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantService_Limits(t *testing.T) {
+	defaults := models.TenantLimits{MaxFileSize: 100, MaxJobsPerDay: 10}
+	ts, err := NewTenantService(defaults, []models.Tenant{
+		{ID: "acme", TenantLimits: models.TenantLimits{MaxFileSize: 500, MaxJobsPerDay: -1, MaxConcurrentJobs: 2}},
+	}, NewJobService(), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, models.TenantLimits{MaxFileSize: 500, MaxConcurrentJobs: 2}, ts.Limits("acme"))
+	assert.Equal(t, defaults, ts.Limits("globex"))
+
+	_, err = NewTenantService(defaults, []models.Tenant{{ID: "acme"}, {ID: "acme"}}, NewJobService(), nil)
+	assert.ErrorContains(t, err, "duplicate")
+	_, err = NewTenantService(defaults, []models.Tenant{{}}, NewJobService(), nil)
+	assert.ErrorContains(t, err, "no id")
+}
+
+func TestTenantService_CheckUpload(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(filepath.Join(tempDir, "uploads"), filepath.Join(tempDir, "downloads"))
+	ts, err := NewTenantService(models.TenantLimits{MaxFileSize: 10, MaxStorageBytes: 20}, nil, NewJobService(), fs)
+	require.NoError(t, err)
+
+	assert.NoError(t, ts.CheckUpload("acme", 10))
+
+	var quotaErr *QuotaError
+	require.ErrorAs(t, ts.CheckUpload("acme", 11), &quotaErr)
+	assert.Equal(t, QuotaFileSize, quotaErr.Quota)
+	assert.Equal(t, int64(10), quotaErr.Limit)
+	assert.ErrorIs(t, quotaErr, ErrQuotaExceeded)
+
+	_, err = fs.ForTenant("acme").SaveStream(strings.NewReader("0123456789abcdef"), "a.csv")
+	require.NoError(t, err)
+
+	require.ErrorAs(t, ts.CheckUpload("acme", 5), &quotaErr)
+	assert.Equal(t, QuotaStorageBytes, quotaErr.Quota)
+	assert.NoError(t, ts.CheckUpload("acme", 4))
+	assert.NoError(t, ts.CheckUpload("acme", -1))
+
+	// Other tenants' files don't count
+	assert.NoError(t, ts.CheckUpload("globex", 10))
+}
+
+func TestTenantService_CheckStored(t *testing.T) {
+	tempDir := t.TempDir()
+	fs := NewFileService(filepath.Join(tempDir, "uploads"), filepath.Join(tempDir, "downloads"))
+	ts, err := NewTenantService(models.TenantLimits{MaxFileSize: 10, MaxStorageBytes: 20}, nil, NewJobService(), fs)
+	require.NoError(t, err)
+
+	stored, err := fs.ForTenant("acme").SaveStream(strings.NewReader("0123456789"), "a.csv")
+	require.NoError(t, err)
+	assert.NoError(t, ts.CheckStored("acme", stored.Size))
+
+	var quotaErr *QuotaError
+	require.ErrorAs(t, ts.CheckStored("acme", 4, 11), &quotaErr)
+	assert.Equal(t, QuotaFileSize, quotaErr.Quota)
+
+	// Stored files already count towards the storage used
+	_, err = fs.ForTenant("acme").SaveStream(strings.NewReader("abcdefghijk"), "b.csv")
+	require.NoError(t, err)
+	require.ErrorAs(t, ts.CheckStored("acme", 1), &quotaErr)
+	assert.Equal(t, QuotaStorageBytes, quotaErr.Quota)
+}
+
+func TestTenantService_AdmitJobs(t *testing.T) {
+	js := NewJobService()
+	ts, err := NewTenantService(models.TenantLimits{MaxConcurrentJobs: 2, MaxJobsPerDay: 3}, nil, js, nil)
+	require.NoError(t, err)
+
+	acme := models.Identity{Tenant: "acme"}
+	create := func() { js.CreateJobWithOptions(acme, "a.csv", models.ProcessingOptions{}) }
+
+	require.NoError(t, ts.AdmitJobs("acme", 1, create))
+	first := js.ListOwnerJobs("acme")[0]
+	require.NoError(t, ts.AdmitJobs("acme", 1, create))
+
+	var quotaErr *QuotaError
+	err = ts.AdmitJobs("acme", 1, func() { t.Fatal("created over the limit") })
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, QuotaConcurrentJobs, quotaErr.Quota)
+
+	// Finished jobs free their slot but still count for the day
+	require.NoError(t, js.UpdateJobStatus(first.ID, models.JobStatusCompleted))
+	require.NoError(t, ts.AdmitJobs("acme", 1, create))
+
+	for _, job := range js.ListOwnerJobs("acme") {
+		js.UpdateJobStatus(job.ID, models.JobStatusCompleted)
+	}
+	err = ts.AdmitJobs("acme", 1, create)
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, QuotaJobsPerDay, quotaErr.Quota)
+
+	// Batches need room for all their jobs at once
+	assert.True(t, errors.Is(ts.CheckJobs("globex", 3), ErrQuotaExceeded))
+	assert.NoError(t, ts.CheckJobs("globex", 2))
+}
+
+func TestLoadTenantFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	content := `{"tenants": [{"id": "acme", "max_file_size": 1048576, "max_jobs_per_day": -1}]}`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	tenants, err := LoadTenantFile(path)
+	require.NoError(t, err)
+	require.Len(t, tenants, 1)
+	assert.Equal(t, "acme", tenants[0].ID)
+	assert.Equal(t, int64(1048576), tenants[0].MaxFileSize)
+	assert.Equal(t, int64(-1), tenants[0].MaxJobsPerDay)
+
+	_, err = LoadTenantFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
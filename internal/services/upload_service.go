@@ -0,0 +1,394 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"csv-validator/internal/models"
+	"csv-validator/internal/utils"
+	"csv-validator/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// uploadSweepInterval is the longest an expired upload waits to be swept
+const uploadSweepInterval = time.Hour
+
+// errUploadExpired is reported instead of ErrUploadNotFound for an upload that
+// was only just found to have expired
+var errUploadExpired = fmt.Errorf("%w: expired", ErrUploadNotFound)
+
+// UploadService stages resumable uploads on disk until their last chunk
+// arrives. Each upload is a data file plus a JSON metadata file, so uploads
+// survive server restarts.
+type UploadService struct {
+	dir string
+	ttl time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+// uploadLock serializes access to one upload, and is forgotten once no caller
+// holds or waits for it
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewUploadService creates an upload service staging files in dir. Uploads not
+// written to for longer than ttl are discarded; zero keeps them forever.
+func NewUploadService(dir string, ttl time.Duration) *UploadService {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		panic(fmt.Sprintf("Failed to create resumable upload directory: %v", err))
+	}
+
+	return &UploadService{
+		dir:   dir,
+		ttl:   ttl,
+		locks: make(map[string]*uploadLock),
+	}
+}
+
+// CreateUpload registers a new upload of size bytes for creator, empty without
+// authentication
+func (us *UploadService) CreateUpload(creator models.Identity, filename string, size int64, options models.ProcessingOptions) (*models.Upload, error) {
+	now := time.Now()
+	upload := &models.Upload{
+		ID:        uuid.New().String(),
+		Filename:  filename,
+		Size:      size,
+		Options:   options,
+		Owner:     creator.Tenant,
+		CreatedBy: creator.Subject,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	file, err := os.Create(us.dataPath(upload.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	file.Close()
+
+	if err := us.save(upload); err != nil {
+		os.Remove(us.dataPath(upload.ID))
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// GetUpload returns the current state of an upload
+func (us *UploadService) GetUpload(id string) (*models.Upload, error) {
+	unlock := us.lock(id)
+	defer unlock()
+
+	return us.load(id)
+}
+
+// WriteChunk appends the bytes read from r to the upload at offset, which must
+// match the bytes received so far. When checksum is set ("sha256 <base64>" or
+// "sha1 <base64>") the chunk is verified against it. A rejected chunk is rolled
+// back entirely so the client can simply resend it.
+func (us *UploadService) WriteChunk(id string, offset int64, r io.Reader, checksum string) (*models.Upload, error) {
+	var hasher hash.Hash
+	var expected []byte
+	if checksum != "" {
+		var err error
+		if hasher, expected, err = parseChecksum(checksum); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock := us.lock(id)
+	defer unlock()
+
+	upload, err := us.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset != upload.Offset {
+		return upload, fmt.Errorf("%w: expected %d, got %d", ErrUploadOffsetMismatch, upload.Offset, offset)
+	}
+
+	file, err := os.OpenFile(us.dataPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek upload file: %w", err)
+	}
+
+	var dst io.Writer = file
+	if hasher != nil {
+		dst = io.MultiWriter(file, hasher)
+	}
+
+	// Read one byte past the declared size so oversized chunks are detected
+	remaining := upload.Size - upload.Offset
+	written, err := io.Copy(dst, io.LimitReader(r, remaining+1))
+
+	rollback := func(cause error) (*models.Upload, error) {
+		file.Truncate(upload.Offset)
+		return upload, cause
+	}
+
+	switch {
+	case err != nil:
+		return rollback(fmt.Errorf("failed to write chunk: %w", err))
+	case written > remaining:
+		return rollback(fmt.Errorf("%w: upload declared %d bytes", ErrFileTooLarge, upload.Size))
+	case hasher != nil && !bytes.Equal(hasher.Sum(nil), expected):
+		return rollback(ErrChecksumMismatch)
+	}
+
+	upload.Offset += written
+	upload.UpdatedAt = time.Now()
+	if err := us.save(upload); err != nil {
+		upload.Offset -= written
+		return rollback(err)
+	}
+
+	return upload, nil
+}
+
+// CompleteUpload hands a fully received upload and the path of its data file
+// to consume, which may move the file away. The upload is forgotten once
+// consume succeeds; when it fails the upload is kept as it was, so it can be
+// completed again later. consume's error is returned unchanged.
+func (us *UploadService) CompleteUpload(id string, consume func(upload *models.Upload, path string) error) error {
+	unlock := us.lock(id)
+	defer unlock()
+
+	upload, err := us.load(id)
+	if err != nil {
+		return err
+	}
+
+	if upload.Offset != upload.Size {
+		return fmt.Errorf("%w: received %d of %d bytes", ErrUploadIncomplete, upload.Offset, upload.Size)
+	}
+
+	if err := consume(upload, us.dataPath(id)); err != nil {
+		return err
+	}
+
+	us.remove(id)
+	return nil
+}
+
+// DeleteUpload aborts an upload and removes its staged data
+func (us *UploadService) DeleteUpload(id string) error {
+	unlock := us.lock(id)
+	defer unlock()
+
+	if _, err := us.load(id); err != nil {
+		return err
+	}
+
+	us.remove(id)
+	return nil
+}
+
+// Sweep removes every upload that expired without being touched again,
+// returning how many were removed
+func (us *UploadService) Sweep() (int, error) {
+	if us.ttl <= 0 {
+		return 0, nil
+	}
+
+	entries, err := os.ReadDir(us.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list uploads: %w", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+
+		// Loading an expired upload removes it
+		unlock := us.lock(id)
+		_, err := us.load(id)
+		unlock()
+		if errors.Is(err, errUploadExpired) {
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// StartSweeper sweeps expired uploads in the background, as often as the ttl
+// but at least hourly, until the returned stop is called
+func (us *UploadService) StartSweeper() (stop func()) {
+	if us.ttl <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(min(us.ttl, uploadSweepInterval))
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				removed, err := us.Sweep()
+				if err != nil {
+					logger.Warn(fmt.Sprintf("Failed to sweep resumable uploads: %v", err))
+				} else if removed > 0 {
+					logger.Info(fmt.Sprintf("Removed %d expired resumable uploads", removed))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+// lock serializes access to one upload and returns the matching unlock
+func (us *UploadService) lock(id string) func() {
+	us.mu.Lock()
+	l, ok := us.locks[id]
+	if !ok {
+		l = &uploadLock{}
+		us.locks[id] = l
+	}
+	l.refs++
+	us.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		us.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(us.locks, id)
+		}
+		us.mu.Unlock()
+	}
+}
+
+// load reads an upload's metadata and reconciles it with its data file.
+// Callers must hold the upload's lock.
+func (us *UploadService) load(id string) (*models.Upload, error) {
+	// IDs end up in file names, so only accept what CreateUpload hands out
+	if !utils.IsValidJobID(id) {
+		return nil, ErrUploadNotFound
+	}
+
+	data, err := os.ReadFile(us.metaPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload metadata: %w", err)
+	}
+
+	var upload models.Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to parse upload metadata: %w", err)
+	}
+
+	if us.ttl > 0 && time.Since(upload.UpdatedAt) > us.ttl {
+		us.remove(id)
+		return nil, errUploadExpired
+	}
+
+	// A crash mid-chunk can leave unacknowledged bytes behind; drop them
+	info, err := os.Stat(us.dataPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat upload file: %w", err)
+	}
+	if info.Size() != upload.Offset {
+		if err := os.Truncate(us.dataPath(id), upload.Offset); err != nil {
+			return nil, fmt.Errorf("failed to truncate upload file: %w", err)
+		}
+	}
+
+	return &upload, nil
+}
+
+// save writes an upload's metadata atomically
+func (us *UploadService) save(upload *models.Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload metadata: %w", err)
+	}
+
+	tmp := us.metaPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write upload metadata: %w", err)
+	}
+
+	if err := os.Rename(tmp, us.metaPath(upload.ID)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write upload metadata: %w", err)
+	}
+
+	return nil
+}
+
+// remove deletes an upload's files
+func (us *UploadService) remove(id string) {
+	os.Remove(us.metaPath(id))
+	os.Remove(us.dataPath(id))
+}
+
+func (us *UploadService) dataPath(id string) string {
+	return filepath.Join(us.dir, id+".part")
+}
+
+func (us *UploadService) metaPath(id string) string {
+	return filepath.Join(us.dir, id+".json")
+}
+
+// parseChecksum parses a tus-style "<algorithm> <base64 digest>" checksum
+func parseChecksum(checksum string) (hash.Hash, []byte, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(checksum), " ")
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: expected \"<algorithm> <base64 digest>\"", ErrInvalidChecksum)
+	}
+
+	var hasher hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "sha256":
+		hasher = sha256.New()
+	case "sha1":
+		hasher = sha1.New()
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidChecksum, algorithm)
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(expected) != hasher.Size() {
+		return nil, nil, fmt.Errorf("%w: malformed %s digest", ErrInvalidChecksum, algorithm)
+	}
+
+	return hasher, expected, nil
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"csv-validator/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Checksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// completeUpload completes an upload, returning it along with its data
+func completeUpload(us *UploadService, id string) (*models.Upload, string, error) {
+	var completed *models.Upload
+	var data []byte
+	err := us.CompleteUpload(id, func(upload *models.Upload, path string) error {
+		completed = upload
+		var err error
+		data, err = os.ReadFile(path)
+		return err
+	})
+	return completed, string(data), err
+}
+
+func TestUploadService_ChunkedUpload(t *testing.T) {
+	us := NewUploadService(t.TempDir(), time.Hour)
+
+	content := "name,email\nChirag,Chirag@example.com\n"
+	options := models.ProcessingOptions{EmptyRows: models.EmptyRowPolicyDrop}
+
+	upload, err := us.CreateUpload(models.Identity{}, "test.csv", int64(len(content)), options)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), upload.Offset)
+
+	first, second := content[:10], content[10:]
+
+	upload, err = us.WriteChunk(upload.ID, 0, strings.NewReader(first), sha256Checksum(first))
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), upload.Offset)
+
+	// Completing early is refused
+	_, _, err = completeUpload(us, upload.ID)
+	assert.ErrorIs(t, err, ErrUploadIncomplete)
+
+	upload, err = us.WriteChunk(upload.ID, 10, strings.NewReader(second), "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), upload.Offset)
+
+	// An upload that could not be consumed is kept
+	failed := errors.New("quota exceeded")
+	err = us.CompleteUpload(upload.ID, func(*models.Upload, string) error { return failed })
+	assert.ErrorIs(t, err, failed)
+	_, err = us.GetUpload(upload.ID)
+	require.NoError(t, err)
+
+	completed, data, err := completeUpload(us, upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, options, completed.Options)
+	assert.Equal(t, content, data)
+	assert.NoFileExists(t, us.dataPath(upload.ID))
+
+	// Completed uploads are forgotten
+	_, err = us.GetUpload(upload.ID)
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+}
+
+func TestUploadService_RejectedChunks(t *testing.T) {
+	us := NewUploadService(t.TempDir(), time.Hour)
+
+	upload, err := us.CreateUpload(models.Identity{}, "test.csv", 10, models.ProcessingOptions{})
+	require.NoError(t, err)
+
+	_, err = us.WriteChunk(upload.ID, 0, strings.NewReader("abcde"), "")
+	require.NoError(t, err)
+
+	// Wrong offset
+	current, err := us.WriteChunk(upload.ID, 2, strings.NewReader("fgh"), "")
+	assert.ErrorIs(t, err, ErrUploadOffsetMismatch)
+	assert.Equal(t, int64(5), current.Offset)
+
+	// Checksum mismatch rolls the chunk back
+	_, err = us.WriteChunk(upload.ID, 5, strings.NewReader("fghij"), sha256Checksum("other"))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	// Malformed checksum
+	_, err = us.WriteChunk(upload.ID, 5, strings.NewReader("fghij"), "crc32 AAAA")
+	assert.ErrorIs(t, err, ErrInvalidChecksum)
+
+	// More data than declared
+	_, err = us.WriteChunk(upload.ID, 5, strings.NewReader("fghijklm"), "")
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+
+	upload, err = us.GetUpload(upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), upload.Offset)
+
+	upload, err = us.WriteChunk(upload.ID, 5, strings.NewReader("fghij"), sha256Checksum("fghij"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), upload.Offset)
+
+	_, data, err := completeUpload(us, upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghij", data)
+}
+
+func TestUploadService_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	us := NewUploadService(dir, time.Hour)
+
+	upload, err := us.CreateUpload(models.Identity{}, "test.csv", 10, models.ProcessingOptions{})
+	require.NoError(t, err)
+	_, err = us.WriteChunk(upload.ID, 0, strings.NewReader("abcd"), "")
+	require.NoError(t, err)
+
+	// Simulate a crash halfway through an unacknowledged chunk
+	file, err := os.OpenFile(us.dataPath(upload.ID), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	file.WriteString("xy")
+	file.Close()
+
+	restarted := NewUploadService(dir, time.Hour)
+
+	resumed, err := restarted.GetUpload(upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), resumed.Offset)
+
+	_, err = restarted.WriteChunk(upload.ID, 4, strings.NewReader("efghij"), "")
+	require.NoError(t, err)
+
+	_, data, err := completeUpload(restarted, upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghij", data)
+}
+
+func TestUploadService_Expiry(t *testing.T) {
+	dir := t.TempDir()
+	us := NewUploadService(dir, time.Millisecond)
+
+	upload, err := us.CreateUpload(models.Identity{}, "test.csv", 10, models.ProcessingOptions{})
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = us.GetUpload(upload.ID)
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+	assert.NoFileExists(t, us.dataPath(upload.ID))
+}
+
+func TestUploadService_Sweep(t *testing.T) {
+	dir := t.TempDir()
+	us := NewUploadService(dir, time.Hour)
+
+	abandoned, err := us.CreateUpload(models.Identity{}, "abandoned.csv", 10, models.ProcessingOptions{})
+	require.NoError(t, err)
+	active, err := us.CreateUpload(models.Identity{}, "active.csv", 10, models.ProcessingOptions{})
+	require.NoError(t, err)
+
+	// Age the abandoned upload past the ttl without anyone touching it again
+	upload, err := us.GetUpload(abandoned.ID)
+	require.NoError(t, err)
+	upload.UpdatedAt = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, us.save(upload))
+
+	removed, err := us.Sweep()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.NoFileExists(t, us.dataPath(abandoned.ID))
+	assert.NoFileExists(t, us.metaPath(abandoned.ID))
+	assert.FileExists(t, us.dataPath(active.ID))
+
+	// Uploads that never expire are never swept
+	removed, err = NewUploadService(dir, 0).Sweep()
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+	assert.FileExists(t, us.dataPath(active.ID))
+}
+
+func TestUploadService_ForgetsLocks(t *testing.T) {
+	us := NewUploadService(t.TempDir(), time.Hour)
+
+	upload, err := us.CreateUpload(models.Identity{}, "test.csv", 3, models.ProcessingOptions{})
+	require.NoError(t, err)
+	_, err = us.WriteChunk(upload.ID, 0, strings.NewReader("abc"), "")
+	require.NoError(t, err)
+	_, _, err = completeUpload(us, upload.ID)
+	require.NoError(t, err)
+
+	_, err = us.GetUpload("a225eb00-0907-4273-92ca-5faadeefae5f")
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+
+	// Neither completed nor unknown uploads keep a lock behind
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	assert.Empty(t, us.locks)
+}
+
+func TestUploadService_DeleteUpload(t *testing.T) {
+	us := NewUploadService(t.TempDir(), 0)
+
+	upload, err := us.CreateUpload(models.Identity{}, "test.csv", 10, models.ProcessingOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, us.DeleteUpload(upload.ID))
+	assert.ErrorIs(t, us.DeleteUpload(upload.ID), ErrUploadNotFound)
+
+	// IDs that could escape the staging directory are never looked up
+	_, err = us.GetUpload("../../etc/passwd")
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	"csv-validator/internal/models"
+	"csv-validator/internal/utils"
+	"csv-validator/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// Headers sent with every webhook request
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// maxWebhookRetryDelay caps the exponential backoff between attempts
+const maxWebhookRetryDelay = 15 * time.Minute
+
+// maxWebhookLogs caps how many jobs' delivery logs are kept. Jobs stay around
+// for as long as the server runs, so the logs of the oldest are forgotten.
+const maxWebhookLogs = 10000
+
+// WebhookConfig configures webhook delivery
+type WebhookConfig struct {
+	// URLs receive the events of every job, in addition to a job's own callback URL
+	URLs []string
+	// Secret signs each payload with HMAC-SHA256; payloads are unsigned without one
+	Secret string
+	// MaxAttempts is how often a delivery is tried before giving up
+	MaxAttempts int
+	// RetryDelay is the wait before the first retry, doubling for each retry after it
+	RetryDelay time.Duration
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// Client is the HTTP client used for the configured URLs, http.DefaultClient if nil
+	Client *http.Client
+	// AllowPrivateCallbacks lets job callback URLs, which clients choose, reach
+	// loopback, private and link-local addresses. Without it callbacks only
+	// connect to public addresses and don't follow redirects.
+	AllowPrivateCallbacks bool
+}
+
+// WebhookService posts a signed event to the configured webhooks and the job's
+// callback URL whenever a job completes, fails or is cancelled. Failed deliveries
+// are retried with exponential backoff and every attempt is logged per job.
+type WebhookService struct {
+	cfg            WebhookConfig
+	client         *http.Client
+	callbackClient *http.Client
+
+	mu         sync.RWMutex
+	deliveries map[string][]models.WebhookDelivery
+	// logged lists the jobs with a delivery log, oldest first
+	logged  []string
+	maxLogs int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	now  func() time.Time
+}
+
+// NewWebhookService creates a webhook service. Subscribe its JobChanged method
+// to JobService to start delivering events.
+func NewWebhookService(cfg WebhookConfig) *WebhookService {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	callbackClient := client
+	if !cfg.AllowPrivateCallbacks {
+		callbackClient = publicClient()
+	}
+
+	return &WebhookService{
+		cfg:            cfg,
+		client:         client,
+		callbackClient: callbackClient,
+		deliveries:     make(map[string][]models.WebhookDelivery),
+		maxLogs:        maxWebhookLogs,
+		done:           make(chan struct{}),
+		now:            time.Now,
+	}
+}
+
+// publicClient returns an HTTP client that only connects to public addresses.
+// The address is checked as the connection is made, after name resolution, so
+// a host name can't be pointed at the internal network once it was accepted.
+// Redirects aren't followed, and no proxy is used since it would be dialled
+// instead of the target.
+func publicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !utils.IsPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, address)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// JobChanged is a JobListener that queues a webhook for every job that finishes
+func (ws *WebhookService) JobChanged(event models.JobEvent) {
+	job := event.Job
+	if event.Type != models.JobEventStatus || !job.Status.IsFinished() {
+		return
+	}
+
+	targets := ws.targets(job)
+	if len(targets) == 0 {
+		return
+	}
+
+	name := "job." + string(job.Status)
+	body, err := json.Marshal(models.WebhookPayload{Event: name, Job: job, Timestamp: ws.now().UTC()})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode webhook for job %s: %v", job.ID, err))
+		return
+	}
+
+	for _, target := range targets {
+		ws.wg.Add(1)
+		go ws.deliver(job.ID, uuid.New().String(), name, target, body)
+	}
+}
+
+// Deliveries returns the delivery attempts made for a job, oldest first
+func (ws *WebhookService) Deliveries(jobID string) []models.WebhookDelivery {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return append([]models.WebhookDelivery{}, ws.deliveries[jobID]...)
+}
+
+// Close stops retrying and waits for attempts in flight, or until ctx is done
+func (ws *WebhookService) Close(ctx context.Context) error {
+	close(ws.done)
+
+	finished := make(chan struct{})
+	go func() {
+		ws.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sign returns the signature header value for body: the hex HMAC-SHA256 of the
+// body keyed with secret, prefixed with "sha256="
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// targets lists the URLs a job's events go to, without duplicates
+func (ws *WebhookService) targets(job models.Job) []string {
+	targets := append([]string{}, ws.cfg.URLs...)
+	if callback := job.Options.CallbackURL; callback != "" {
+		duplicate := false
+		for _, target := range targets {
+			duplicate = duplicate || target == callback
+		}
+		if !duplicate {
+			targets = append(targets, callback)
+		}
+	}
+	return targets
+}
+
+// deliver tries to post body to target until it is accepted, the attempts run
+// out or the service is closed
+func (ws *WebhookService) deliver(jobID, deliveryID, event, target string, body []byte) {
+	defer ws.wg.Done()
+
+	for attempt := 1; ; attempt++ {
+		delivery := models.WebhookDelivery{
+			ID:          deliveryID,
+			Event:       event,
+			URL:         target,
+			Attempt:     attempt,
+			AttemptedAt: ws.now(),
+		}
+
+		delivery.StatusCode, delivery.Error = ws.post(deliveryID, event, target, body)
+		delivery.Delivered = delivery.Error == ""
+
+		if delivery.Delivered || attempt == ws.cfg.MaxAttempts {
+			ws.record(jobID, delivery)
+			if !delivery.Delivered {
+				logger.Error(fmt.Sprintf("Giving up on webhook %s for job %s after %d attempts: %s", target, jobID, attempt, delivery.Error))
+			}
+			return
+		}
+
+		delay := ws.backoff(attempt)
+		retryAt := delivery.AttemptedAt.Add(delay)
+		delivery.NextRetryAt = &retryAt
+		ws.record(jobID, delivery)
+
+		logger.Debug(fmt.Sprintf("Webhook %s for job %s failed (%s), retrying in %s", target, jobID, delivery.Error, delay))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ws.done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// post makes one delivery attempt, returning the response status and, unless
+// the webhook answered with a 2xx, what went wrong
+func (ws *WebhookService) post(deliveryID, event, target string, body []byte) (int, string) {
+	ctx := context.Background()
+	if ws.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ws.cfg.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "csv-validator-webhook")
+	req.Header.Set(WebhookEventHeader, event)
+	req.Header.Set(WebhookDeliveryHeader, deliveryID)
+	if ws.cfg.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, Sign(ws.cfg.Secret, body))
+	}
+
+	resp, err := ws.clientFor(target).Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, ""
+}
+
+// clientFor returns the client to post to target with: the configured URLs are
+// trusted, callback URLs chosen by clients are not
+func (ws *WebhookService) clientFor(target string) *http.Client {
+	for _, configured := range ws.cfg.URLs {
+		if target == configured {
+			return ws.client
+		}
+	}
+	return ws.callbackClient
+}
+
+// backoff returns the wait after the given failed attempt: RetryDelay doubled
+// for every attempt before it, capped at maxWebhookRetryDelay
+func (ws *WebhookService) backoff(attempt int) time.Duration {
+	delay := ws.cfg.RetryDelay
+	for i := 1; i < attempt && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWebhookRetryDelay)
+}
+
+// record appends an attempt to the delivery log of a job, forgetting the log
+// of the oldest job once there are too many
+func (ws *WebhookService) record(jobID string, delivery models.WebhookDelivery) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, exists := ws.deliveries[jobID]; !exists {
+		ws.logged = append(ws.logged, jobID)
+		if len(ws.logged) > ws.maxLogs {
+			delete(ws.deliveries, ws.logged[0])
+			ws.logged = ws.logged[1:]
+		}
+	}
+
+	ws.deliveries[jobID] = append(ws.deliveries[jobID], delivery)
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"csv-validator/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver records webhook requests, failing the first failures of them
+type webhookReceiver struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	if len(r.requests) <= r.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func TestWebhookService_DeliversSignedPayload(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	ws := NewWebhookService(WebhookConfig{Secret: "s3cret", MaxAttempts: 3, RetryDelay: time.Millisecond, AllowPrivateCallbacks: true})
+	js := NewJobService()
+	js.Subscribe(ws.JobChanged)
+
+	job := js.CreateJobWithOptions(models.Identity{}, "test.csv", models.ProcessingOptions{CallbackURL: server.URL + "/hook"})
+	require.NoError(t, js.UpdateJobStatus(job.ID, models.JobStatusProcessing))
+	require.NoError(t, js.UpdateJobStatus(job.ID, models.JobStatusCompleted))
+
+	require.Eventually(t, func() bool { return len(ws.Deliveries(job.ID)) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Only the terminal status is delivered
+	require.Equal(t, 1, receiver.count())
+	req, body := receiver.requests[0], receiver.bodies[0]
+	assert.Equal(t, "/hook", req.URL.Path)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "job.completed", req.Header.Get(WebhookEventHeader))
+	assert.Equal(t, Sign("s3cret", body), req.Header.Get(WebhookSignatureHeader))
+
+	var payload models.WebhookPayload
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, "job.completed", payload.Event)
+	assert.Equal(t, job.ID, payload.Job.ID)
+	assert.Equal(t, models.JobStatusCompleted, payload.Job.Status)
+
+	delivery := ws.Deliveries(job.ID)[0]
+	assert.True(t, delivery.Delivered)
+	assert.Equal(t, http.StatusNoContent, delivery.StatusCode)
+	assert.Equal(t, req.Header.Get(WebhookDeliveryHeader), delivery.ID)
+}
+
+func TestWebhookService_CallbacksOnlyReachPublicAddresses(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	configured := server.URL + "/configured"
+	ws := NewWebhookService(WebhookConfig{URLs: []string{configured}, MaxAttempts: 1})
+	js := NewJobService()
+	js.Subscribe(ws.JobChanged)
+
+	// The name only turns out to be loopback once it is resolved
+	callback := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/callback"
+	job := js.CreateJobWithOptions(models.Identity{}, "test.csv", models.ProcessingOptions{CallbackURL: callback})
+	_, err := js.CancelJob(job.ID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(ws.Deliveries(job.ID)) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// The operator's own webhooks are trusted wherever they are
+	for _, delivery := range ws.Deliveries(job.ID) {
+		switch delivery.URL {
+		case configured:
+			assert.True(t, delivery.Delivered)
+		case callback:
+			assert.False(t, delivery.Delivered)
+			assert.Contains(t, delivery.Error, ErrWebhookAddressNotAllowed.Error())
+		}
+	}
+	require.Equal(t, 1, receiver.count())
+	assert.Equal(t, "/configured", receiver.requests[0].URL.Path)
+
+	// Redirects are answered, not followed
+	assert.ErrorIs(t, publicClient().CheckRedirect(nil, nil), http.ErrUseLastResponse)
+}
+
+func TestWebhookService_RetriesWithBackoff(t *testing.T) {
+	receiver := &webhookReceiver{failures: 2}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	ws := NewWebhookService(WebhookConfig{URLs: []string{server.URL}, MaxAttempts: 5, RetryDelay: time.Millisecond})
+	js := NewJobService()
+	js.Subscribe(ws.JobChanged)
+
+	job := js.CreateJob("test.csv")
+	require.NoError(t, js.UpdateJobError(job.ID, "boom"))
+
+	require.Eventually(t, func() bool {
+		deliveries := ws.Deliveries(job.ID)
+		return len(deliveries) > 0 && deliveries[len(deliveries)-1].Delivered
+	}, 5*time.Second, 10*time.Millisecond)
+
+	deliveries := ws.Deliveries(job.ID)
+	require.Len(t, deliveries, 3)
+	for i, delivery := range deliveries[:2] {
+		assert.Equal(t, i+1, delivery.Attempt)
+		assert.False(t, delivery.Delivered)
+		assert.Equal(t, http.StatusServiceUnavailable, delivery.StatusCode)
+		require.NotNil(t, delivery.NextRetryAt)
+		assert.Equal(t, ws.backoff(i+1), delivery.NextRetryAt.Sub(delivery.AttemptedAt))
+		assert.Equal(t, deliveries[2].ID, delivery.ID)
+	}
+	assert.Equal(t, "job.failed", deliveries[2].Event)
+
+	// Without a secret payloads go unsigned
+	assert.Empty(t, receiver.requests[0].Header.Get(WebhookSignatureHeader))
+}
+
+func TestWebhookService_GivesUp(t *testing.T) {
+	receiver := &webhookReceiver{failures: 10}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	ws := NewWebhookService(WebhookConfig{URLs: []string{server.URL}, MaxAttempts: 2, RetryDelay: time.Millisecond})
+	ws.JobChanged(models.JobEvent{Type: models.JobEventStatus, Job: models.Job{ID: "job-1", Status: models.JobStatusCancelled}})
+
+	require.Eventually(t, func() bool { return len(ws.Deliveries("job-1")) == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, ws.Close(context.Background()))
+
+	deliveries := ws.Deliveries("job-1")
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, "job.cancelled", deliveries[1].Event)
+	assert.False(t, deliveries[1].Delivered)
+	assert.Nil(t, deliveries[1].NextRetryAt)
+	assert.Equal(t, 2, receiver.count())
+}
+
+func TestWebhookService_CloseStopsRetries(t *testing.T) {
+	receiver := &webhookReceiver{failures: 10}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	ws := NewWebhookService(WebhookConfig{URLs: []string{server.URL}, MaxAttempts: 5, RetryDelay: time.Hour})
+	ws.JobChanged(models.JobEvent{Type: models.JobEventStatus, Job: models.Job{ID: "job-1", Status: models.JobStatusCompleted}})
+
+	require.Eventually(t, func() bool { return len(ws.Deliveries("job-1")) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, ws.Close(ctx))
+	assert.Len(t, ws.Deliveries("job-1"), 1)
+}
+
+func TestWebhookService_ForgetsOldestLogs(t *testing.T) {
+	ws := NewWebhookService(WebhookConfig{})
+	ws.maxLogs = 2
+
+	for _, id := range []string{"job-1", "job-2", "job-2", "job-3"} {
+		ws.record(id, models.WebhookDelivery{Event: "job.completed"})
+	}
+
+	assert.Empty(t, ws.Deliveries("job-1"))
+	assert.Len(t, ws.Deliveries("job-2"), 2)
+	assert.Len(t, ws.Deliveries("job-3"), 1)
+	assert.Len(t, ws.deliveries, 2)
+}
+
+func TestWebhookService_Targets(t *testing.T) {
+	ws := NewWebhookService(WebhookConfig{URLs: []string{"https://a.example/hook"}})
+
+	assert.Equal(t, []string{"https://a.example/hook"}, ws.targets(models.Job{}))
+	assert.Equal(t, []string{"https://a.example/hook", "https://b.example/hook"},
+		ws.targets(models.Job{Options: models.ProcessingOptions{CallbackURL: "https://b.example/hook"}}))
+	assert.Equal(t, []string{"https://a.example/hook"},
+		ws.targets(models.Job{Options: models.ProcessingOptions{CallbackURL: "https://a.example/hook"}}))
+}
+
+func TestWebhookService_Backoff(t *testing.T) {
+	ws := NewWebhookService(WebhookConfig{RetryDelay: time.Second})
+
+	assert.Equal(t, time.Second, ws.backoff(1))
+	assert.Equal(t, 2*time.Second, ws.backoff(2))
+	assert.Equal(t, 8*time.Second, ws.backoff(4))
+	assert.Equal(t, maxWebhookRetryDelay, ws.backoff(30))
+}
+
+func TestSign(t *testing.T) {
+	// Matches: printf '{"event":"job.completed"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=d9cb51b5281e6b3fcd7dc418042f6dbc4fec7a47932f83c16a467ad565a1167d",
+		Sign("secret", []byte(`{"event":"job.completed"}`)))
+}
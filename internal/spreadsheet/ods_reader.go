@@ -0,0 +1,256 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenDocument namespaces
+const (
+	odsOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// ReadODS reads the rows of one table from an OpenDocument spreadsheet
+func ReadODS(r io.ReaderAt, size int64, sheet string, limits Limits) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkbook, err)
+	}
+
+	var content *zip.File
+	for _, f := range zr.File {
+		if f.Name == "content.xml" {
+			content = f
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("%w: missing content.xml", ErrInvalidWorkbook)
+	}
+
+	// First pass only collects table names so a name match can win over an index
+	var names []string
+	err = walkODSTables(content, limits, func(decoder *xml.Decoder, start xml.StartElement) error {
+		names = append(names, attrValue(start, odsTableNS, "name"))
+		return decoder.Skip()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := selectSheet(names, sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	current := 0
+	err = walkODSTables(content, limits, func(decoder *xml.Decoder, start xml.StartElement) error {
+		defer func() { current++ }()
+		if current != index {
+			return decoder.Skip()
+		}
+
+		rows, err = readODSTable(decoder)
+		return err
+	})
+
+	return rows, err
+}
+
+// walkODSTables calls fn for every table:table element in content.xml
+func walkODSTables(content *zip.File, limits Limits, fn func(*xml.Decoder, xml.StartElement) error) error {
+	rc, err := openPart(content, limits)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: failed to parse content.xml: %w", ErrInvalidWorkbook, err)
+		}
+
+		if start, ok := token.(xml.StartElement); ok && start.Name.Space == odsTableNS && start.Name.Local == "table" {
+			if err := fn(decoder, start); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readODSTable reads rows until the end of the current table
+func readODSTable(decoder *xml.Decoder) ([][]string, error) {
+	var b rowBuilder
+	repeat := 1
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse table: %w", ErrInvalidWorkbook, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != odsTableNS {
+				continue
+			}
+
+			switch t.Name.Local {
+			case "table-row":
+				repeat = repeatCount(t, "number-rows-repeated")
+			case "table-cell", "covered-table-cell":
+				value, err := readODSCell(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				if err := b.addCell(value, repeatCount(t, "number-columns-repeated")); err != nil {
+					return nil, err
+				}
+			}
+
+		case xml.EndElement:
+			if t.Name.Space != odsTableNS {
+				continue
+			}
+
+			switch t.Name.Local {
+			case "table-row":
+				if err := b.endRow(repeat); err != nil {
+					return nil, err
+				}
+			case "table":
+				return b.rows, nil
+			}
+		}
+	}
+}
+
+// readODSCell converts a table cell to text, using the typed office:*-value
+// attributes where present and the paragraph text otherwise
+func readODSCell(decoder *xml.Decoder, start xml.StartElement) (string, error) {
+	text, err := readODSText(decoder)
+	if err != nil {
+		return "", err
+	}
+
+	switch attrValue(start, odsOfficeNS, "value-type") {
+	case "float", "percentage", "currency":
+		if number, err := strconv.ParseFloat(attrValue(start, odsOfficeNS, "value"), 64); err == nil {
+			return formatNumber(number), nil
+		}
+	case "date":
+		return formatISODate(attrValue(start, odsOfficeNS, "date-value")), nil
+	case "time":
+		if value := formatODSDuration(attrValue(start, odsOfficeNS, "time-value")); value != "" {
+			return value, nil
+		}
+	case "boolean":
+		if value, err := strconv.ParseBool(attrValue(start, odsOfficeNS, "boolean-value")); err == nil {
+			return strconv.FormatBool(value), nil
+		}
+	}
+
+	return text, nil
+}
+
+// readODSText collects the paragraphs of a cell, expanding text:s, text:tab and
+// text:line-break, and skipping annotations
+func readODSText(decoder *xml.Decoder) (string, error) {
+	var b strings.Builder
+	paragraphs := 0
+	depth := 1
+	paragraphDepth := 0
+
+	for depth > 0 {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("%w: failed to parse cell: %w", ErrInvalidWorkbook, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+
+			switch {
+			case t.Name.Space == odsOfficeNS && t.Name.Local == "annotation":
+				if err := decoder.Skip(); err != nil {
+					return "", err
+				}
+				depth--
+			case t.Name.Space == odsTextNS && t.Name.Local == "p":
+				if paragraphs > 0 {
+					b.WriteString("\n")
+				}
+				paragraphs++
+				paragraphDepth = depth
+			case t.Name.Space == odsTextNS && t.Name.Local == "s":
+				b.WriteString(strings.Repeat(" ", repeatCount(t, "c")))
+			case t.Name.Space == odsTextNS && t.Name.Local == "tab":
+				b.WriteString("\t")
+			case t.Name.Space == odsTextNS && t.Name.Local == "line-break":
+				b.WriteString("\n")
+			}
+
+		case xml.EndElement:
+			if depth == paragraphDepth {
+				paragraphDepth = 0
+			}
+			depth--
+
+		case xml.CharData:
+			// Whitespace between elements is formatting, only paragraph text counts
+			if paragraphDepth > 0 {
+				b.Write(t)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+// formatODSDuration converts an ISO 8601 duration such as PT10H30M00S to 10:30:00
+func formatODSDuration(value string) string {
+	if !strings.HasPrefix(value, "PT") {
+		return ""
+	}
+
+	duration, err := time.ParseDuration(strings.ToLower(strings.TrimPrefix(value, "PT")))
+	if err != nil {
+		return ""
+	}
+
+	seconds := int(duration.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// repeatCount reads a table:number-*-repeated style attribute, defaulting to 1
+func repeatCount(start xml.StartElement, name string) int {
+	value := attrValue(start, start.Name.Space, name)
+	if n, err := strconv.Atoi(value); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// attrValue returns the value of a namespaced attribute, or "" if absent
+func attrValue(start xml.StartElement, space, local string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
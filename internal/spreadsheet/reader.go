@@ -0,0 +1,210 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Supported workbook extensions
+const (
+	ExtXLSX = ".xlsx"
+	ExtODS  = ".ods"
+)
+
+// MaxCells caps how many cells a single sheet may expand to, guarding against
+// workbooks that use repeat attributes to describe enormous empty ranges
+var MaxCells = 20_000_000
+
+// ratioGraceBytes is how much a part may inflate to before the expansion ratio
+// is enforced, so small but repetitive parts are not rejected
+const ratioGraceBytes = 1024 * 1024
+
+// Limits bounds how far the parts of a workbook, which is a zip archive, may
+// inflate. Zero means no limit.
+type Limits struct {
+	// MaxPartSize caps the bytes a single part may inflate to, guarding
+	// against a small archive that decompresses to gigabytes of XML
+	MaxPartSize int64
+	// MaxRatio caps the bytes a part may inflate to per compressed byte
+	MaxRatio int64
+}
+
+// Reader errors
+var (
+	ErrSheetNotFound   = errors.New("sheet not found")
+	ErrInvalidWorkbook = errors.New("invalid workbook")
+	ErrTooManyCells    = errors.New("sheet has too many cells")
+	ErrPartTooLarge    = errors.New("workbook part is too large")
+)
+
+// IsSpreadsheet reports whether the filename has a supported workbook extension
+func IsSpreadsheet(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ExtXLSX, ExtODS:
+		return true
+	}
+	return false
+}
+
+// ReadFile reads the rows of one sheet from an .xlsx or .ods file. The sheet is
+// chosen by name or by 1-based index; an empty sheet selects the first one.
+// Cell values are converted to text: numbers in plain decimal notation, booleans
+// as true/false and dates as 2006-01-02, 2006-01-02 15:04:05 or 15:04:05.
+func ReadFile(path, sheet string, limits Limits) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return Read(file, info.Size(), path, sheet, limits)
+}
+
+// Read reads the rows of one sheet like ReadFile, from a workbook of size bytes
+// whose type is given by the extension of name
+func Read(r io.ReaderAt, size int64, name, sheet string, limits Limits) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ExtXLSX:
+		return ReadXLSX(r, size, sheet, limits)
+	case ExtODS:
+		return ReadODS(r, size, sheet, limits)
+	default:
+		return nil, fmt.Errorf("unsupported workbook type: %s", filepath.Ext(name))
+	}
+}
+
+// selectSheet picks a sheet by exact name, then by 1-based index, defaulting to the first
+func selectSheet(names []string, want string) (int, error) {
+	if len(names) == 0 {
+		return 0, fmt.Errorf("%w: workbook has no sheets", ErrSheetNotFound)
+	}
+
+	if want == "" {
+		return 0, nil
+	}
+
+	for i, name := range names {
+		if name == want {
+			return i, nil
+		}
+	}
+
+	if index, err := strconv.Atoi(want); err == nil && index >= 1 && index <= len(names) {
+		return index - 1, nil
+	}
+
+	return 0, fmt.Errorf("%w: %q", ErrSheetNotFound, want)
+}
+
+// rowBuilder collects cells and rows, only materialising runs of empty cells
+// and rows once a value follows them so trailing blanks never take up memory
+type rowBuilder struct {
+	rows         [][]string
+	current      []string
+	pendingCells int
+	pendingRows  int
+	cells        int
+}
+
+// addCell appends value repeat times to the current row
+func (b *rowBuilder) addCell(value string, repeat int) error {
+	if value == "" {
+		b.pendingCells += repeat
+		return nil
+	}
+
+	if err := b.count(b.pendingCells + repeat); err != nil {
+		return err
+	}
+
+	for ; b.pendingCells > 0; b.pendingCells-- {
+		b.current = append(b.current, "")
+	}
+	for i := 0; i < repeat; i++ {
+		b.current = append(b.current, value)
+	}
+
+	return nil
+}
+
+// endRow finishes the current row and repeats it repeat times
+func (b *rowBuilder) endRow(repeat int) error {
+	row := b.current
+	b.current = nil
+	b.pendingCells = 0
+
+	if len(row) == 0 {
+		b.pendingRows += repeat
+		return nil
+	}
+
+	if err := b.count(b.pendingRows + len(row)*repeat); err != nil {
+		return err
+	}
+
+	for ; b.pendingRows > 0; b.pendingRows-- {
+		b.rows = append(b.rows, []string{})
+	}
+	for i := 0; i < repeat; i++ {
+		b.rows = append(b.rows, row)
+	}
+
+	return nil
+}
+
+// count tracks materialised cells against MaxCells
+func (b *rowBuilder) count(n int) error {
+	b.cells += n
+	if b.cells > MaxCells {
+		return ErrTooManyCells
+	}
+	return nil
+}
+
+// openPart opens a part of a workbook archive for reading, refusing parts that
+// inflate past the limits. archive/zip stops reading a part at the size the
+// archive declares, so a forged size can't get past the size check; the ratio is
+// checked as the part is read.
+func openPart(f *zip.File, limits Limits) (io.ReadCloser, error) {
+	if limits.MaxPartSize > 0 && f.UncompressedSize64 > uint64(limits.MaxPartSize) {
+		return nil, fmt.Errorf("%w: %s inflates to %d bytes, more than the %d allowed", ErrPartTooLarge, f.Name, f.UncompressedSize64, limits.MaxPartSize)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkbook, err)
+	}
+	if limits.MaxRatio <= 0 {
+		return rc, nil
+	}
+	return &ratioReader{ReadCloser: rc, file: f, maxRatio: limits.MaxRatio}, nil
+}
+
+// ratioReader fails a part once it has inflated more than maxRatio times its
+// compressed size
+type ratioReader struct {
+	io.ReadCloser
+	file     *zip.File
+	maxRatio int64
+	read     int64
+}
+
+func (r *ratioReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	if r.read > ratioGraceBytes && r.read > r.maxRatio*int64(r.file.CompressedSize64) {
+		return n, fmt.Errorf("%w: %s inflates more than %d times", ErrPartTooLarge, r.file.Name, r.maxRatio)
+	}
+	return n, err
+}
@@ -0,0 +1,237 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildZip(t *testing.T, parts map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for name, content := range parts {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func testXLSX(t *testing.T) []byte {
+	return buildZip(t, testXLSXParts())
+}
+
+func testXLSXParts() map[string]string {
+	return map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="People" sheetId="1" r:id="rId1"/><sheet name="Other" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>name</t></si><si><t>email</t></si><si><r><t>Chi</t></r><r><t>rag</t></r></si><si><t>Chirag@example.com</t></si></sst>`,
+		"xl/styles.xml": `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd\ hh:mm"/></numFmts>
+<cellXfs count="4"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="10"/></cellXfs></styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>joined</t></is></c><c r="D1" t="inlineStr"><is><t>score</t></is></c><c r="E1" t="inlineStr"><is><t>active</t></is></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" t="s"><v>3</v></c><c r="C2" s="1"><v>45306</v></c><c r="D2"><v>1.5E-2</v></c><c r="E2" t="b"><v>1</v></c></row>
+<row r="4"><c r="A4" t="str"><f>UPPER("x")</f><v>X</v></c><c r="C4" s="2"><v>45306.5</v></c><c r="D4" s="3"><v>0.25</v></c></row>
+<row r="6"><c r="A6"/></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row><c t="inlineStr"><is><t>other</t></is></c></row></sheetData></worksheet>`,
+	}
+}
+
+func testODS(t *testing.T) []byte {
+	return buildZip(t, map[string]string{
+		"mimetype": "application/vnd.oasis.opendocument.spreadsheet",
+		"content.xml": `<office:document-content
+ xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+ xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+ xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet>
+<table:table table:name="First"><table:table-row><table:table-cell office:value-type="string"><text:p>first</text:p></table:table-cell></table:table-row></table:table>
+<table:table table:name="People">
+  <table:table-row>
+    <table:table-cell office:value-type="string"><text:p>name</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>email</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>joined</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>score</text:p></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>active</text:p></table:table-cell>
+  </table:table-row>
+  <table:table-row>
+    <table:table-cell office:value-type="string"><text:p>Chirag<text:s text:c="2"/>S</text:p><office:annotation><text:p>note</text:p></office:annotation></table:table-cell>
+    <table:table-cell office:value-type="string"><text:p>Chirag@example.com</text:p></table:table-cell>
+    <table:table-cell office:value-type="date" office:date-value="2024-01-15"><text:p>15/01/24</text:p></table:table-cell>
+    <table:table-cell office:value-type="percentage" office:value="0.015"><text:p>1.5%</text:p></table:table-cell>
+    <table:table-cell office:value-type="boolean" office:boolean-value="true"><text:p>TRUE</text:p></table:table-cell>
+    <table:table-cell table:number-columns-repeated="1020"/>
+  </table:table-row>
+  <table:table-row table:number-rows-repeated="2"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+  <table:table-row>
+    <table:table-cell office:value-type="time" office:time-value="PT10H30M00S"><text:p>10:30</text:p></table:table-cell>
+    <table:table-cell table:number-columns-repeated="2" office:value-type="float" office:value="7"><text:p>7</text:p></table:table-cell>
+  </table:table-row>
+  <table:table-row table:number-rows-repeated="1048570"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table>
+</office:spreadsheet></office:body></office:document-content>`,
+	})
+}
+
+func TestReadXLSX(t *testing.T) {
+	data := testXLSX(t)
+
+	rows, err := ReadXLSX(bytes.NewReader(data), int64(len(data)), "", Limits{})
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"name", "email", "joined", "score", "active"},
+		{"Chirag", "Chirag@example.com", "2024-01-15", "0.015", "true"},
+		{},
+		{"X", "", "2024-01-15 12:00:00", "0.25"},
+	}, rows)
+}
+
+func TestReadXLSX_SheetSelection(t *testing.T) {
+	data := testXLSX(t)
+
+	rows, err := ReadXLSX(bytes.NewReader(data), int64(len(data)), "Other", Limits{})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"other"}}, rows)
+
+	rows, err = ReadXLSX(bytes.NewReader(data), int64(len(data)), "2", Limits{})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"other"}}, rows)
+
+	_, err = ReadXLSX(bytes.NewReader(data), int64(len(data)), "Missing", Limits{})
+	assert.ErrorIs(t, err, ErrSheetNotFound)
+}
+
+func TestReadXLSX_NotAWorkbook(t *testing.T) {
+	data := []byte("name,email\n")
+
+	_, err := ReadXLSX(bytes.NewReader(data), int64(len(data)), "", Limits{})
+	assert.ErrorIs(t, err, ErrInvalidWorkbook)
+}
+
+func TestReadODS(t *testing.T) {
+	data := testODS(t)
+
+	rows, err := ReadODS(bytes.NewReader(data), int64(len(data)), "People", Limits{})
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"name", "email", "joined", "score", "active"},
+		{"Chirag  S", "Chirag@example.com", "2024-01-15", "0.015", "true"},
+		{},
+		{},
+		{"10:30:00", "7", "7"},
+	}, rows)
+}
+
+func TestReadODS_SheetSelection(t *testing.T) {
+	data := testODS(t)
+
+	rows, err := ReadODS(bytes.NewReader(data), int64(len(data)), "", Limits{})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"first"}}, rows)
+
+	rows, err = ReadODS(bytes.NewReader(data), int64(len(data)), "2", Limits{})
+	require.NoError(t, err)
+	assert.Len(t, rows, 5)
+
+	_, err = ReadODS(bytes.NewReader(data), int64(len(data)), "9", Limits{})
+	assert.ErrorIs(t, err, ErrSheetNotFound)
+}
+
+func TestReadODS_TooManyCells(t *testing.T) {
+	data := buildZip(t, map[string]string{
+		"content.xml": `<office:document-content
+ xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+ xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+ xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet><table:table table:name="Bomb">
+<table:table-row table:number-rows-repeated="1000000"><table:table-cell table:number-columns-repeated="1000" office:value-type="float" office:value="1"/></table:table-row>
+</table:table></office:spreadsheet></office:body></office:document-content>`,
+	})
+
+	_, err := ReadODS(bytes.NewReader(data), int64(len(data)), "", Limits{})
+	assert.ErrorIs(t, err, ErrTooManyCells)
+}
+
+func TestReadXLSX_PartTooLarge(t *testing.T) {
+	// A few kilobytes of archive that inflate to a megabyte of shared strings
+	parts := testXLSXParts()
+	parts["xl/sharedStrings.xml"] = "<sst><si><t>" + strings.Repeat("x", 1<<20) + "</t></si></sst>"
+	data := buildZip(t, parts)
+	require.Less(t, len(data), 4096)
+
+	_, err := ReadXLSX(bytes.NewReader(data), int64(len(data)), "", Limits{MaxPartSize: 1024})
+	assert.ErrorIs(t, err, ErrPartTooLarge)
+	assert.Contains(t, err.Error(), "xl/sharedStrings.xml")
+
+	// The same workbook is fine within the limit
+	_, err = ReadXLSX(bytes.NewReader(data), int64(len(data)), "", Limits{MaxPartSize: 2 << 20})
+	assert.NoError(t, err)
+}
+
+func TestReadXLSX_PartRatioTooHigh(t *testing.T) {
+	parts := testXLSXParts()
+	parts["xl/sharedStrings.xml"] = "<sst><si><t>" + strings.Repeat("x", 4<<20) + "</t></si></sst>"
+	data := buildZip(t, parts)
+
+	// Shared strings are decoded in full, so the ratio is checked as they inflate
+	_, err := ReadXLSX(bytes.NewReader(data), int64(len(data)), "", Limits{MaxRatio: 100})
+	assert.ErrorIs(t, err, ErrPartTooLarge)
+	assert.Contains(t, err.Error(), "xl/sharedStrings.xml")
+
+	_, err = ReadXLSX(bytes.NewReader(data), int64(len(data)), "", Limits{MaxRatio: 10000})
+	assert.NoError(t, err)
+
+	// Parts within the grace are never held to the ratio
+	small := testXLSX(t)
+	_, err = ReadXLSX(bytes.NewReader(small), int64(len(small)), "", Limits{MaxRatio: 1})
+	assert.NoError(t, err)
+}
+
+func TestReadFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	path := filepath.Join(tempDir, "people.xlsx")
+	require.NoError(t, os.WriteFile(path, testXLSX(t), 0644))
+
+	rows, err := ReadFile(path, "", Limits{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "email", "joined", "score", "active"}, rows[0])
+
+	_, err = ReadFile(filepath.Join(tempDir, "people.csv"), "", Limits{})
+	assert.Error(t, err)
+}
+
+func TestIsSpreadsheet(t *testing.T) {
+	assert.True(t, IsSpreadsheet("report.xlsx"))
+	assert.True(t, IsSpreadsheet("REPORT.ODS"))
+	assert.False(t, IsSpreadsheet("report.csv"))
+	assert.False(t, IsSpreadsheet("report.xls"))
+}
+
+func TestIsDateFormat(t *testing.T) {
+	assert.True(t, isDateFormat("yyyy-mm-dd"))
+	assert.True(t, isDateFormat("[h]:mm:ss"))
+	assert.True(t, isDateFormat(`[$-409]d\-mmm;@`))
+	assert.False(t, isDateFormat("General"))
+	assert.False(t, isDateFormat("#,##0.00"))
+	assert.False(t, isDateFormat(`0.00 "days"`))
+	assert.False(t, isDateFormat("[Red]0.00"))
+}
@@ -0,0 +1,413 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxText struct {
+	Text string `xml:",chardata"`
+}
+
+// xlsxString is a shared or inline string, either plain or made of rich text runs
+type xlsxString struct {
+	T *xlsxText `xml:"t"`
+	R []struct {
+		T xlsxText `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s xlsxString) String() string {
+	if s.T != nil {
+		return s.T.Text
+	}
+
+	var b strings.Builder
+	for _, run := range s.R {
+		b.WriteString(run.T.Text)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxString `xml:"si"`
+}
+
+type xlsxCell struct {
+	Ref    string     `xml:"r,attr"`
+	Type   string     `xml:"t,attr"`
+	Style  int        `xml:"s,attr"`
+	Value  string     `xml:"v"`
+	Inline xlsxString `xml:"is"`
+}
+
+// xlsxReader holds the workbook-wide lookups needed to convert cells
+type xlsxReader struct {
+	files      map[string]*zip.File
+	strings    []string
+	dateStyles map[int]bool
+	date1904   bool
+	limits     Limits
+}
+
+// ReadXLSX reads the rows of one worksheet from an Office Open XML workbook
+func ReadXLSX(r io.ReaderAt, size int64, sheet string, limits Limits) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkbook, err)
+	}
+
+	x := &xlsxReader{files: make(map[string]*zip.File, len(zr.File)), limits: limits}
+	for _, f := range zr.File {
+		x.files[f.Name] = f
+	}
+
+	var workbook xlsxWorkbook
+	if err := x.decode("xl/workbook.xml", &workbook, true); err != nil {
+		return nil, err
+	}
+	x.date1904 = workbook.Properties.Date1904
+
+	var rels xlsxRelationships
+	if err := x.decode("xl/_rels/workbook.xml.rels", &rels, true); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(workbook.Sheets))
+	for i, s := range workbook.Sheets {
+		names[i] = s.Name
+	}
+
+	index, err := selectSheet(names, sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	target := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[index].RID {
+			target = rel.Target
+		}
+	}
+	if target == "" {
+		return nil, fmt.Errorf("%w: no part for sheet %q", ErrInvalidWorkbook, names[index])
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	var shared xlsxSharedStrings
+	if err := x.decode("xl/sharedStrings.xml", &shared, false); err != nil {
+		return nil, err
+	}
+	x.strings = make([]string, len(shared.Items))
+	for i, item := range shared.Items {
+		x.strings[i] = item.String()
+	}
+
+	var styles xlsxStyles
+	if err := x.decode("xl/styles.xml", &styles, false); err != nil {
+		return nil, err
+	}
+	x.dateStyles = dateStyles(styles)
+
+	return x.readSheet(target)
+}
+
+// decode unmarshals a workbook part, which may be optional
+func (x *xlsxReader) decode(name string, v interface{}, required bool) error {
+	f, ok := x.files[name]
+	if !ok {
+		if required {
+			return fmt.Errorf("%w: missing %s", ErrInvalidWorkbook, name)
+		}
+		return nil
+	}
+
+	rc, err := openPart(f, x.limits)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("%w: failed to parse %s: %w", ErrInvalidWorkbook, name, err)
+	}
+	return nil
+}
+
+// readSheet streams a worksheet part row by row
+func (x *xlsxReader) readSheet(name string) ([][]string, error) {
+	f, ok := x.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidWorkbook, name)
+	}
+
+	rc, err := openPart(f, x.limits)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var b rowBuilder
+	rowNumber := 0
+	column := 0
+
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse %s: %w", ErrInvalidWorkbook, name, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				next := rowNumber + 1
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "r" {
+						if n, err := strconv.Atoi(attr.Value); err == nil && n > rowNumber {
+							next = n
+						}
+					}
+				}
+				// Rows the sheet leaves out are blank
+				if err := b.endRow(next - rowNumber - 1); err != nil {
+					return nil, err
+				}
+				rowNumber = next
+				column = 0
+
+			case "c":
+				var cell xlsxCell
+				if err := decoder.DecodeElement(&cell, &t); err != nil {
+					return nil, fmt.Errorf("%w: failed to parse cell: %w", ErrInvalidWorkbook, err)
+				}
+
+				if index, ok := columnIndex(cell.Ref); ok && index >= column {
+					if err := b.addCell("", index-column); err != nil {
+						return nil, err
+					}
+					column = index
+				}
+
+				if err := b.addCell(x.cellValue(cell), 1); err != nil {
+					return nil, err
+				}
+				column++
+			}
+
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				if err := b.endRow(1); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return b.rows, nil
+}
+
+// cellValue converts a cell to text according to its type and style
+func (x *xlsxReader) cellValue(cell xlsxCell) string {
+	switch cell.Type {
+	case "s":
+		index, err := strconv.Atoi(strings.TrimSpace(cell.Value))
+		if err != nil || index < 0 || index >= len(x.strings) {
+			return ""
+		}
+		return x.strings[index]
+	case "inlineStr":
+		return cell.Inline.String()
+	case "b":
+		if strings.TrimSpace(cell.Value) == "1" {
+			return "true"
+		}
+		return "false"
+	case "str", "e":
+		return cell.Value
+	case "d":
+		return formatISODate(cell.Value)
+	}
+
+	// Numeric cell, possibly a date depending on its number format
+	if cell.Value == "" {
+		return ""
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(cell.Value), 64)
+	if err != nil {
+		return cell.Value
+	}
+
+	if x.dateStyles[cell.Style] {
+		return formatSerialDate(number, x.date1904)
+	}
+
+	return formatNumber(number)
+}
+
+// dateStyles returns the cell style indexes whose number format displays a date or time
+func dateStyles(styles xlsxStyles) map[int]bool {
+	custom := make(map[int]string, len(styles.NumFmts))
+	for _, f := range styles.NumFmts {
+		custom[f.ID] = f.Code
+	}
+
+	result := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		if code, ok := custom[xf.NumFmtID]; ok {
+			result[i] = isDateFormat(code)
+		} else {
+			result[i] = isBuiltinDateFormat(xf.NumFmtID)
+		}
+	}
+	return result
+}
+
+// isBuiltinDateFormat reports whether a built-in number format id is a date or time format
+func isBuiltinDateFormat(id int) bool {
+	return (id >= 14 && id <= 22) || (id >= 27 && id <= 36) || (id >= 45 && id <= 47) || (id >= 50 && id <= 58)
+}
+
+// isDateFormat reports whether a custom format code contains date or time tokens
+// outside of quoted literals and bracketed colour or condition sections
+func isDateFormat(code string) bool {
+	inQuote, inBracket := false, false
+
+	for i := 0; i < len(code); i++ {
+		ch := code[i]
+		switch {
+		case inQuote:
+			inQuote = ch != '"'
+		case inBracket:
+			inBracket = ch != ']'
+		case ch == '"':
+			inQuote = true
+		case ch == '[':
+			// Elapsed time such as [h]:mm is still a time format
+			if i+1 < len(code) && strings.IndexByte("hHmMsS", code[i+1]) >= 0 {
+				return true
+			}
+			inBracket = true
+		case ch == '\\' || ch == '_' || ch == '*':
+			// Escaped literal or padding character
+			i++
+		case strings.IndexByte("yYmMdDhHsS", ch) >= 0:
+			return true
+		}
+	}
+
+	return false
+}
+
+// columnIndex converts a cell reference such as "AB12" to a zero-based column index
+func columnIndex(ref string) (int, bool) {
+	index := 0
+	letters := 0
+
+	for _, ch := range ref {
+		if ch >= 'a' && ch <= 'z' {
+			ch -= 'a' - 'A'
+		}
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		index = index*26 + int(ch-'A'+1)
+		letters++
+	}
+
+	if letters == 0 {
+		return 0, false
+	}
+	return index - 1, true
+}
+
+// formatNumber renders a number in plain decimal notation without trailing zeros
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// formatSerialDate converts a spreadsheet serial date to ISO 8601 text
+func formatSerialDate(serial float64, date1904 bool) string {
+	var epoch time.Time
+	switch {
+	case date1904:
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	case serial < 61:
+		// Serials before March 1900 predate the fictitious 29 February 1900
+		epoch = time.Date(1899, 12, 31, 0, 0, 0, 0, time.UTC)
+	default:
+		epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	}
+
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+
+	return formatTime(t, days != 0, seconds != 0)
+}
+
+// formatISODate normalises an ISO 8601 date or date-time value
+func formatISODate(value string) string {
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return formatTime(t, true, t.Hour() != 0 || t.Minute() != 0 || t.Second() != 0)
+		}
+	}
+	return value
+}
+
+// formatTime renders the date part, the time part or both
+func formatTime(t time.Time, hasDate, hasTime bool) string {
+	switch {
+	case hasDate && hasTime:
+		return t.Format("2006-01-02 15:04:05")
+	case hasTime:
+		return t.Format("15:04:05")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
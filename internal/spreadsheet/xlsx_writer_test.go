@@ -0,0 +1,63 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		index    int
+		expected string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, ColumnName(tt.index))
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	writer, err := NewXLSXWriter(&buf)
+	require.NoError(t, err)
+
+	require.NoError(t, writer.WriteRow([]string{"name", "email", "has_email"}))
+	require.NoError(t, writer.WriteRow([]string{"Chirag & Co", "Chirag@example.com", "true"}))
+	require.NoError(t, writer.Close())
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	names := make(map[string]*zip.File)
+	for _, f := range reader.File {
+		names[f.Name] = f
+	}
+
+	assert.Contains(t, names, "[Content_Types].xml")
+	assert.Contains(t, names, "xl/workbook.xml")
+	require.Contains(t, names, "xl/worksheets/sheet1.xml")
+
+	sheet, err := names["xl/worksheets/sheet1.xml"].Open()
+	require.NoError(t, err)
+	defer sheet.Close()
+
+	content, err := io.ReadAll(sheet)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(content), `<c r="C1" t="inlineStr"><is><t xml:space="preserve">has_email</t></is></c>`)
+	assert.Contains(t, string(content), `Chirag &amp; Co`)
+	assert.Contains(t, string(content), `<row r="2">`)
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package storage
+
+import "errors"
+
+// diskFree can't measure free space on this platform
+func diskFree(path string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
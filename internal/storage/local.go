@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores objects as files on the local filesystem
+type Local struct {
+	root string
+}
+
+// NewLocal creates a local backend. Keys are resolved inside root; with an
+// empty root they are used as filesystem paths as they are, which is how the
+// services address UPLOAD_DIR and DOWNLOAD_DIR.
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+// Put writes r to a temporary file next to the destination and renames it into
+// place, so readers never see a partial object
+func (l *Local) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	// CreateTemp uses 0600; match the permissions os.Create would have given
+	tmp.Chmod(0644)
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+
+	return written, nil
+}
+
+// Get opens the file for key. The returned reader is an *os.File, so callers
+// may use it as an io.ReadSeeker or io.ReaderAt.
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return file, err
+}
+
+// Stat returns the size and modification time of the file for key
+func (l *Local) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the file for key
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks the directory containing prefix and returns the files below it
+// whose key starts with prefix. Temporary files from unfinished Puts are skipped.
+func (l *Local) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	base, err := l.path(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := base
+	if !strings.HasSuffix(prefix, "/") {
+		dir = filepath.Dir(base)
+	}
+
+	var objects []ObjectInfo
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".put-") || !strings.HasPrefix(path, base) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, ObjectInfo{Key: l.key(path), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+
+	return objects, err
+}
+
+// Import renames a local file into place, copying only when it lives on another filesystem
+func (l *Local) Import(ctx context.Context, key, localPath string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := os.Rename(localPath, path); err == nil {
+		return nil
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	_, err = l.Put(ctx, key, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(localPath)
+}
+
+// FreeSpace returns the bytes available to unprivileged users on the
+// filesystem holding prefix, which must exist. It fails with
+// errors.ErrUnsupported on platforms where it can't be measured.
+func (l *Local) FreeSpace(ctx context.Context, prefix string) (int64, error) {
+	path, err := l.path(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	return diskFree(path)
+}
+
+// path resolves key to a filesystem path
+func (l *Local) path(key string) (string, error) {
+	if l.root == "" {
+		if key == "" {
+			return "", fmt.Errorf("empty key")
+		}
+		return filepath.Clean(filepath.FromSlash(key)), nil
+	}
+
+	return filepath.Join(l.root, filepath.FromSlash(CleanKey(key))), nil
+}
+
+// key turns a filesystem path back into the key addressing it
+func (l *Local) key(path string) string {
+	if l.root == "" {
+		return filepath.ToSlash(path)
+	}
+
+	rel, err := filepath.Rel(l.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
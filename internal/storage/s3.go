@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize is the multipart upload part size used when S3Config.PartSize
+// is not set. S3 requires at least 5MB for every part but the last.
+const DefaultPartSize = 8 * 1024 * 1024
+
+// S3Config configures an S3-compatible backend such as AWS S3 or MinIO
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Prefix is prepended to every key, so several deployments can share a bucket
+	Prefix string
+	// VirtualHosted addresses the bucket as a subdomain of the endpoint instead of a path
+	VirtualHosted bool
+	// PartSize is how much of an object Put buffers per request
+	PartSize int64
+	// Client is the HTTP client used for requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// S3 stores objects in an S3-compatible bucket, signing requests with AWS Signature Version 4
+type S3 struct {
+	endpoint *url.URL
+	cfg      S3Config
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3 creates an S3 backend
+func NewS3(cfg S3Config) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PartSize <= 0 {
+		cfg.PartSize = DefaultPartSize
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &S3{endpoint: endpoint, cfg: cfg, client: client, now: time.Now}, nil
+}
+
+// Put uploads r in a single request when it fits in one part, and as a
+// multipart upload otherwise, so at most one part is held in memory
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	part := make([]byte, s.cfg.PartSize)
+
+	n, err := io.ReadFull(r, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		resp, err := s.do(ctx, http.MethodPut, key, nil, part[:n])
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return int64(n), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return s.putMultipart(ctx, key, r, part)
+}
+
+// putMultipart uploads first and the rest of r as a multipart upload, aborting it on failure
+func (s *S3) putMultipart(ctx context.Context, key string, r io.Reader, first []byte) (int64, error) {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return 0, err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = decodeXML(resp, &initiated)
+	if err != nil {
+		return 0, err
+	}
+
+	uploadID := initiated.UploadID
+	abort := func(cause error) (int64, error) {
+		// Use a fresh context: the request context may be what failed
+		if resp, err := s.do(context.Background(), http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil); err == nil {
+			resp.Body.Close()
+		}
+		return 0, cause
+	}
+
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []completedPart
+	var total int64
+
+	part := first
+	for number := 1; ; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+		resp, err := s.do(ctx, http.MethodPut, key, query, part)
+		if err != nil {
+			return abort(err)
+		}
+		resp.Body.Close()
+
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		total += int64(len(part))
+
+		n, err := io.ReadFull(r, first[:cap(first)])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+		if n == 0 {
+			break
+		}
+		part = first[:n]
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return abort(err)
+	}
+
+	resp, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return abort(err)
+	}
+	// S3 can report a failed completion with a 200 and an error document
+	var completed struct {
+		XMLName xml.Name
+		Message string `xml:"Message"`
+	}
+	if err := decodeXML(resp, &completed); err != nil {
+		return abort(err)
+	}
+	if completed.XMLName.Local == "Error" {
+		return abort(fmt.Errorf("s3: completing upload of %s: %s", key, completed.Message))
+	}
+
+	return total, nil
+}
+
+// Get streams the object from the bucket
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat issues a HEAD request for the object
+func (s *S3) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return ObjectInfo{Key: key, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+// Delete removes the object; S3 treats deleting a missing key as success
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List pages through ListObjectsV2 for every key starting with prefix
+func (s *S3) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	token := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.objectName(prefix, true)}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := decodeXML(resp, &result); err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:     strings.TrimPrefix(object.Key, s.objectPrefix()),
+				Size:    object.Size,
+				ModTime: object.LastModified,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request for key (or the bucket itself when key is empty)
+// and turns non-2xx responses into errors
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	target := *s.endpoint
+	target.RawQuery = encodeQuery(query)
+
+	objectPath := ""
+	if key != "" {
+		objectPath = "/" + s.objectName(key, false)
+	}
+	if s.cfg.VirtualHosted {
+		target.Host = s.cfg.Bucket + "." + target.Host
+		target.Path = strings.TrimSuffix(target.Path, "/") + objectPath
+	} else {
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/" + s.cfg.Bucket + objectPath
+	}
+	if target.Path == "" {
+		target.Path = "/"
+	}
+	target.RawPath = uriEncode(target.Path, false)
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+
+	s.sign(req, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var s3Err struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+			return nil, fmt.Errorf("s3: %s %s: %s: %s", method, key, s3Err.Code, s3Err.Message)
+		}
+		return nil, fmt.Errorf("s3: %s %s: unexpected status %s", method, key, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// objectPrefix returns the configured key prefix, normalized to end in a slash
+func (s *S3) objectPrefix() string {
+	prefix := CleanKey(s.cfg.Prefix)
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// objectName maps a key to its object name in the bucket. Prefixes used for
+// listing keep their trailing slash.
+func (s *S3) objectName(key string, isPrefix bool) string {
+	name := s.objectPrefix() + CleanKey(key)
+	if isPrefix && strings.HasSuffix(key, "/") && !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	return name
+}
+
+// decodeXML decodes and closes a response body
+func decodeXML(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("s3: invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible server such as
+// MinIO. It serves one bucket with path-style addressing.
+type fakeS3 struct {
+	bucket string
+
+	mu        sync.Mutex
+	objects   map[string][]byte
+	multipart map[string]map[int][]byte
+	nextID    int
+	requests  []string
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: map[string][]byte{}, multipart: map[string]map[int][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		f.fail(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != f.bucket {
+		f.fail(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	query := r.URL.Query()
+	f.requests = append(f.requests, r.Method+" "+key+" "+r.URL.RawQuery)
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, query)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextID++
+		id := fmt.Sprintf("upload-%d", f.nextID)
+		f.multipart[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.multipart[query.Get("uploadId")]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := f.multipart[query.Get("uploadId")]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		xml.Unmarshal(body, &complete)
+		var data []byte
+		for _, part := range complete.Parts {
+			data = append(data, parts[part.PartNumber]...)
+		}
+		f.objects[key] = data
+		delete(f.multipart, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.multipart, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// list serves ListObjectsV2 two keys per page to exercise pagination
+func (f *fakeS3) list(w http.ResponseWriter, query map[string][]string) {
+	prefix := ""
+	if values := query["prefix"]; len(values) > 0 {
+		prefix = values[0]
+	}
+	start := 0
+	if values := query["continuation-token"]; len(values) > 0 {
+		start, _ = strconv.Atoi(values[0])
+	}
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	fmt.Fprint(w, "<ListBucketResult>")
+	end := min(start+2, len(keys))
+	for _, key := range keys[start:end] {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>2024-01-01T00:00:00.000Z</LastModified></Contents>", key, len(f.objects[key]))
+	}
+	if end < len(keys) {
+		fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>", end)
+	} else {
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated>")
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func newTestS3(t *testing.T, prefix string) (*S3, *fakeS3) {
+	fake := newFakeS3("csv-validator")
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s, err := NewS3(S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "csv-validator",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+		Prefix:          prefix,
+		PartSize:        8 * 1024,
+	})
+	require.NoError(t, err)
+	return s, fake
+}
+
+func TestS3(t *testing.T) {
+	s, fake := newTestS3(t, "")
+	testStorage(t, s)
+
+	// Large objects went through multipart uploads, which all finished
+	var multipart bool
+	for _, request := range fake.requests {
+		if strings.Contains(request, "partNumber=2") {
+			multipart = true
+		}
+	}
+	assert.True(t, multipart)
+	assert.Empty(t, fake.multipart)
+}
+
+func TestS3_Prefix(t *testing.T) {
+	s, fake := newTestS3(t, "tenant-a/")
+	ctx := context.Background()
+
+	_, err := s.Put(ctx, "./uploads/a b.csv", strings.NewReader("x"))
+	require.NoError(t, err)
+	assert.Contains(t, fake.objects, "tenant-a/uploads/a b.csv")
+
+	objects, err := s.List(ctx, "uploads/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "uploads/a b.csv", objects[0].Key)
+}
+
+func TestS3_Errors(t *testing.T) {
+	s, _ := newTestS3(t, "")
+	s.cfg.SecretAccessKey = "wrong"
+	s.cfg.AccessKeyID = "other-key"
+
+	_, err := s.Put(context.Background(), "uploads/a.csv", strings.NewReader("x"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SignatureDoesNotMatch")
+
+	_, err = NewS3(S3Config{Endpoint: "not a url", Bucket: "b"})
+	assert.Error(t, err)
+	_, err = NewS3(S3Config{Endpoint: "http://localhost:9000"})
+	assert.Error(t, err)
+}
+
+// failingReader fails after returning some data
+type failingReader struct{ n int }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := min(len(p), r.n)
+	r.n -= n
+	return n, nil
+}
+
+func TestS3_AbortsFailedMultipart(t *testing.T) {
+	s, fake := newTestS3(t, "")
+
+	_, err := s.Put(context.Background(), "uploads/broken.csv", &failingReader{n: 20 * 1024})
+	require.Error(t, err)
+
+	assert.Empty(t, fake.multipart, "multipart upload should be aborted")
+	assert.NotContains(t, fake.objects, "uploads/broken.csv")
+}
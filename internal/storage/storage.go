@@ -0,0 +1,122 @@
+// Package storage abstracts where uploaded and processed files are kept, so the
+// service can run against the local filesystem or an S3-compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a key does not exist
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage is a flat key/value store for file contents. Keys are slash-separated
+// paths; the services use the same paths they would use on local disk.
+type Storage interface {
+	// Put stores everything read from r under key, replacing any existing object.
+	// r is streamed, never read into memory whole.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Get opens the object stored under key. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat returns the size and modification time of the object under key
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete removes the object under key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// Importer is implemented by backends that can take over a local file more
+// cheaply than copying it, such as the local backend renaming it into place
+type Importer interface {
+	Import(ctx context.Context, key, localPath string) error
+}
+
+// SpaceReporter is implemented by backends that can run out of space, such as
+// the local backend filling up its disk
+type SpaceReporter interface {
+	// FreeSpace returns how many bytes can still be stored below prefix
+	FreeSpace(ctx context.Context, prefix string) (int64, error)
+}
+
+// Import moves the file at localPath into s under key, removing the local file
+func Import(ctx context.Context, s Storage, key, localPath string) error {
+	if importer, ok := s.(Importer); ok {
+		return importer.Import(ctx, key, localPath)
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	_, err = s.Put(ctx, key, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(localPath)
+}
+
+// Writer streams into a Storage object. Close stores the object; Abort
+// discards everything written instead.
+type Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// NewWriter returns a writer that streams into s under key. The object is
+// stored once the writer is closed; Close reports any error from the backend.
+func NewWriter(ctx context.Context, s Storage, key string) *Writer {
+	pr, pw := io.Pipe()
+	w := &Writer{pw: pw, done: make(chan error, 1)}
+
+	go func() {
+		_, err := s.Put(ctx, key, pr)
+		// Unblock the writer if Put gave up early
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close finishes the object and waits for the backend to store it
+func (w *Writer) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// Abort fails the upload with cause so that no object is stored
+func (w *Writer) Abort(cause error) {
+	w.pw.CloseWithError(cause)
+	<-w.done
+}
+
+// CleanKey normalizes a key into a relative slash-separated path: backslashes
+// become slashes, "." and ".." elements are resolved without ever climbing above
+// the root, and leading "./" or "/" is dropped. An empty result means no key.
+func CleanKey(key string) string {
+	key = path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))
+	key = strings.TrimPrefix(key, "/")
+	if key == "" || key == "." {
+		return ""
+	}
+	return key
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStorage runs the behaviour every backend must share
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	// Put and Get round trip, larger than the S3 test part size
+	content := bytes.Repeat([]byte("name,email\nChirag,Chirag@example.com\n"), 1000)
+	n, err := s.Put(ctx, "uploads/a.csv", bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+
+	rc, err := s.Get(ctx, "uploads/a.csv")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	// Stat
+	info, err := s.Stat(ctx, "uploads/a.csv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+
+	// Overwrite with a small object
+	_, err = s.Put(ctx, "uploads/a.csv", strings.NewReader("small"))
+	require.NoError(t, err)
+	info, err = s.Stat(ctx, "uploads/a.csv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size)
+
+	// Empty objects are allowed
+	_, err = s.Put(ctx, "uploads/empty.csv", strings.NewReader(""))
+	require.NoError(t, err)
+
+	_, err = s.Put(ctx, "downloads/processed_a.csv", strings.NewReader("x"))
+	require.NoError(t, err)
+
+	// List by prefix
+	objects, err := s.List(ctx, "uploads/")
+	require.NoError(t, err)
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	sort.Strings(keys)
+	assert.Equal(t, []string{"uploads/a.csv", "uploads/empty.csv"}, keys)
+
+	objects, err = s.List(ctx, "uploads/a")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "uploads/a.csv", objects[0].Key)
+
+	// Missing keys
+	_, err = s.Get(ctx, "uploads/missing.csv")
+	assert.True(t, errors.Is(err, ErrNotFound), "%v", err)
+	_, err = s.Stat(ctx, "uploads/missing.csv")
+	assert.True(t, errors.Is(err, ErrNotFound), "%v", err)
+
+	// Delete, twice
+	require.NoError(t, s.Delete(ctx, "uploads/a.csv"))
+	require.NoError(t, s.Delete(ctx, "uploads/a.csv"))
+	_, err = s.Stat(ctx, "uploads/a.csv")
+	assert.True(t, errors.Is(err, ErrNotFound), "%v", err)
+
+	// Streaming writer
+	w := NewWriter(ctx, s, "downloads/streamed.csv")
+	io.WriteString(w, "streamed,")
+	io.WriteString(w, "content\n")
+	require.NoError(t, w.Close())
+
+	rc, err = s.Get(ctx, "downloads/streamed.csv")
+	require.NoError(t, err)
+	data, _ = io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "streamed,content\n", string(data))
+
+	// Aborted writers store nothing
+	w = NewWriter(ctx, s, "downloads/aborted.csv")
+	io.WriteString(w, "partial")
+	w.Abort(errors.New("conversion failed"))
+	_, err = s.Stat(ctx, "downloads/aborted.csv")
+	assert.True(t, errors.Is(err, ErrNotFound), "%v", err)
+
+	// Import takes over a local file
+	local := filepath.Join(t.TempDir(), "staged.csv")
+	require.NoError(t, os.WriteFile(local, []byte("staged"), 0644))
+	require.NoError(t, Import(ctx, s, "uploads/imported.csv", local))
+	assert.NoFileExists(t, local)
+	info, err = s.Stat(ctx, "uploads/imported.csv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), info.Size)
+}
+
+func TestLocal(t *testing.T) {
+	root := t.TempDir()
+	testStorage(t, NewLocal(root))
+
+	// Keys never escape the root
+	s := NewLocal(root)
+	_, err := s.Put(context.Background(), "../../escape.csv", strings.NewReader("x"))
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(root, "escape.csv"))
+}
+
+func TestLocal_PathKeys(t *testing.T) {
+	// With no root, keys are plain filesystem paths
+	dir := t.TempDir()
+	s := NewLocal("")
+
+	path := filepath.Join(dir, "uploads", "a.csv")
+	_, err := s.Put(context.Background(), path, strings.NewReader("name\n"))
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "name\n", string(data))
+
+	objects, err := s.List(context.Background(), filepath.Join(dir, "uploads")+"/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, filepath.ToSlash(path), objects[0].Key)
+}
+
+func TestLocal_FreeSpace(t *testing.T) {
+	s := NewLocal("")
+
+	free, err := s.FreeSpace(context.Background(), t.TempDir())
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("free space can't be measured on this platform")
+	}
+	require.NoError(t, err)
+	assert.Positive(t, free)
+
+	_, err = s.FreeSpace(context.Background(), filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestCleanKey(t *testing.T) {
+	assert.Equal(t, "uploads/a.csv", CleanKey("./uploads/a.csv"))
+	assert.Equal(t, "tmp/x/a.csv", CleanKey("/tmp/x/a.csv"))
+	assert.Equal(t, "a.csv", CleanKey("../../a.csv"))
+	assert.Equal(t, "uploads/a.csv", CleanKey(`uploads\a.csv`))
+	assert.Equal(t, "", CleanKey("./"))
+}
@@ -8,72 +8,134 @@ import (
 // Email validation regex pattern
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 
+// Email validation failure reasons
+const (
+	EmailReasonEmpty           = "empty"
+	EmailReasonLength          = "invalid_length"
+	EmailReasonFormat          = "invalid_format"
+	EmailReasonConsecutiveDots = "consecutive_dots"
+	EmailReasonLocalPart       = "invalid_local_part"
+	EmailReasonDomain          = "invalid_domain"
+)
+
+// EmailCheck describes the outcome of validating a single address
+type EmailCheck struct {
+	// Valid reports whether the address passes IsValidEmail, the rule used by the CSV pipeline
+	Valid bool
+	// Strict reports whether the address also passes IsValidEmailStrict
+	Strict bool
+	// Reason is the first rule the address failed, empty when it is strictly valid
+	Reason string
+	// Normalized is the trimmed address with a lower-cased domain
+	Normalized string
+}
+
 // IsValidEmail validates if a string is a valid email address
 func IsValidEmail(email string) bool {
-	if email == "" {
-		return false
+	return emailFailure(email) == ""
+}
+
+// IsValidEmailStrict validates email with additional checks
+func IsValidEmailStrict(email string) bool {
+	return emailFailure(email) == "" && strictEmailFailure(email) == ""
+}
+
+// CheckEmail validates an address with both the basic and strict rules and
+// reports why it failed, if it did
+func CheckEmail(email string) EmailCheck {
+	check := EmailCheck{
+		Normalized: NormalizeEmail(email),
+	}
+
+	if check.Reason = emailFailure(email); check.Reason != "" {
+		return check
+	}
+	check.Valid = true
+
+	if check.Reason = strictEmailFailure(email); check.Reason == "" {
+		check.Strict = true
 	}
 
-	// Trim whitespace
+	return check
+}
+
+// NormalizeEmail trims whitespace and lower-cases the domain part.
+// The local part is left alone since it may be case sensitive.
+func NormalizeEmail(email string) string {
 	email = strings.TrimSpace(email)
 
+	atIndex := strings.LastIndex(email, "@")
+	if atIndex < 0 {
+		return email
+	}
+
+	return email[:atIndex+1] + strings.ToLower(email[atIndex+1:])
+}
+
+// emailFailure returns the reason an address fails the basic checks, or "" if it passes
+func emailFailure(email string) string {
+	// Trim whitespace, so blank cells count as empty
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return EmailReasonEmpty
+	}
+
 	// Basic length check
 	if len(email) < 5 || len(email) > 100 {
-		return false
+		return EmailReasonLength
 	}
 
 	// Check for valid email format using regex
-	return emailRegex.MatchString(email)
-}
-
-// IsValidEmailStrict validates email with additional checks
-func IsValidEmailStrict(email string) bool {
-	if !IsValidEmail(email) {
-		return false
+	if !emailRegex.MatchString(email) {
+		return EmailReasonFormat
 	}
 
-	// Additional validations
+	return ""
+}
+
+// strictEmailFailure returns the reason an address fails the additional strict checks, or "" if it passes
+func strictEmailFailure(email string) string {
 	email = strings.TrimSpace(email)
 
 	// Check for consecutive dots
 	if strings.Contains(email, "..") {
-		return false
+		return EmailReasonConsecutiveDots
 	}
 
 	// Check for valid characters around @
 	atIndex := strings.Index(email, "@")
 	if atIndex <= 0 || atIndex >= len(email)-1 {
-		return false
+		return EmailReasonFormat
 	}
 
 	// Split local and domain parts
 	parts := strings.Split(email, "@")
 	if len(parts) != 2 {
-		return false
+		return EmailReasonFormat
 	}
 
 	local, domain := parts[0], parts[1]
 
 	// Validate local part
 	if len(local) == 0 || len(local) > 64 {
-		return false
+		return EmailReasonLocalPart
 	}
 
 	// Validate domain part
 	if len(domain) == 0 || len(domain) > 255 {
-		return false
+		return EmailReasonDomain
 	}
 
 	// Domain should contain at least one dot
 	if !strings.Contains(domain, ".") {
-		return false
+		return EmailReasonDomain
 	}
 
 	// Domain should not start or end with dot or hyphen
 	if strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") ||
 		strings.HasPrefix(domain, "-") || strings.HasSuffix(domain, "-") {
-		return false
+		return EmailReasonDomain
 	}
 
-	return true
+	return ""
 }
@@ -137,3 +137,61 @@ func TestIsValidEmailStrict(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		expected EmailCheck
+	}{
+		{
+			name:     "Strictly valid email",
+			email:    " User.Name@Example.COM ",
+			expected: EmailCheck{Valid: true, Strict: true, Normalized: "User.Name@example.com"},
+		},
+		{
+			name:     "Empty email",
+			email:    "",
+			expected: EmailCheck{Reason: EmailReasonEmpty},
+		},
+		{
+			name:     "Only whitespace",
+			email:    " \t ",
+			expected: EmailCheck{Reason: EmailReasonEmpty},
+		},
+		{
+			name:     "Too short",
+			email:    "a@b",
+			expected: EmailCheck{Reason: EmailReasonLength, Normalized: "a@b"},
+		},
+		{
+			name:     "Bad format",
+			email:    "not-an-email",
+			expected: EmailCheck{Reason: EmailReasonFormat, Normalized: "not-an-email"},
+		},
+		{
+			name:     "Valid but not strict",
+			email:    "test..name@example.com",
+			expected: EmailCheck{Valid: true, Reason: EmailReasonConsecutiveDots, Normalized: "test..name@example.com"},
+		},
+		{
+			name:     "Valid but domain starts with hyphen",
+			email:    "test@-example.com",
+			expected: EmailCheck{Valid: true, Reason: EmailReasonDomain, Normalized: "test@-example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CheckEmail(tt.email)
+			assert.Equal(t, tt.expected, check)
+			assert.Equal(t, IsValidEmail(tt.email), check.Valid)
+			assert.Equal(t, IsValidEmailStrict(tt.email), check.Strict)
+		})
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	assert.Equal(t, "Chirag@example.com", NormalizeEmail("  Chirag@EXAMPLE.com"))
+	assert.Equal(t, "no-at-sign", NormalizeEmail("no-at-sign"))
+}
@@ -4,7 +4,7 @@ import "errors"
 
 // Validation errors
 var (
-	ErrInvalidFileExtension = errors.New("invalid file extension, only .csv files are allowed")
+	ErrInvalidFileExtension = errors.New("invalid file extension, only .csv, .xlsx, .ods, .csv.gz, .csv.zst and .zip files are allowed")
 	ErrEmptyFile            = errors.New("file is empty")
 	ErrInvalidJobID         = errors.New("invalid job ID format")
 )
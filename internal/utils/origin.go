@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AnyOrigin allows every origin in ALLOWED_ORIGINS
+const AnyOrigin = "*"
+
+// OriginPattern is an entry of ALLOWED_ORIGINS: an exact origin such as
+// https://app.example.com, or one with a wildcard subdomain such as
+// https://*.example.com, which matches subdomains at any depth but not the
+// domain itself
+type OriginPattern struct {
+	scheme   string
+	host     string // without the wildcard, lower-cased
+	port     string
+	wildcard bool
+}
+
+// ParseOriginPattern parses an ALLOWED_ORIGINS entry. It must be a scheme and
+// host with an optional port, and nothing else.
+func ParseOriginPattern(pattern string) (OriginPattern, error) {
+	wildcard := strings.Contains(pattern, "://*.")
+	u, err := url.Parse(strings.Replace(pattern, "://*.", "://", 1))
+	if err != nil {
+		return OriginPattern{}, fmt.Errorf("invalid origin %q: %w", pattern, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" ||
+		u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return OriginPattern{}, fmt.Errorf("invalid origin %q (expected scheme://host[:port])", pattern)
+	}
+	if strings.Contains(u.Hostname(), "*") {
+		return OriginPattern{}, fmt.Errorf("invalid origin %q (wildcards only go at the start of the host)", pattern)
+	}
+
+	return OriginPattern{
+		scheme:   u.Scheme,
+		host:     strings.ToLower(u.Hostname()),
+		port:     u.Port(),
+		wildcard: wildcard,
+	}, nil
+}
+
+// Matches reports whether the Origin header value origin is allowed by the pattern
+func (p OriginPattern) Matches(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Scheme, p.scheme) || u.Port() != p.port {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if p.wildcard {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// ParseAllowedOrigins parses a comma-separated ALLOWED_ORIGINS value. all
+// reports whether it contains "*", allowing every origin.
+func ParseAllowedOrigins(value string) (patterns []OriginPattern, all bool, err error) {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		switch entry {
+		case "":
+			continue
+		case AnyOrigin:
+			all = true
+			continue
+		}
+
+		pattern, err := ParseOriginPattern(entry)
+		if err != nil {
+			return nil, false, err
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, all, nil
+}
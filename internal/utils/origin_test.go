@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOriginPattern(t *testing.T) {
+	valid := []string{
+		"https://app.example.com",
+		"http://localhost:3000",
+		"https://*.example.com",
+		"https://app.example.com/",
+	}
+	for _, pattern := range valid {
+		_, err := ParseOriginPattern(pattern)
+		assert.NoError(t, err, pattern)
+	}
+
+	invalid := []string{
+		"app.example.com",
+		"ftp://example.com",
+		"https://",
+		"https://example.com/ui",
+		"https://example.com?x=1",
+		"https://user@example.com",
+		"https://app.*.example.com",
+		"https://*example.com",
+	}
+	for _, pattern := range invalid {
+		_, err := ParseOriginPattern(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestOriginPattern_Matches(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		origin   string
+		expected bool
+	}{
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "https://APP.example.com", true},
+		{"https://app.example.com", "http://app.example.com", false},
+		{"https://app.example.com", "https://app.example.com:8443", false},
+		{"https://app.example.com", "https://app.example.com.evil.com", false},
+		{"http://localhost:3000", "http://localhost:3000", true},
+		{"http://localhost:3000", "http://localhost:3001", false},
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://eu.app.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "null", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.origin, func(t *testing.T) {
+			pattern, err := ParseOriginPattern(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, pattern.Matches(tt.origin))
+		})
+	}
+}
+
+func TestParseAllowedOrigins(t *testing.T) {
+	patterns, all, err := ParseAllowedOrigins("https://app.example.com, https://*.example.org,")
+	require.NoError(t, err)
+	assert.False(t, all)
+	assert.Len(t, patterns, 2)
+
+	patterns, all, err = ParseAllowedOrigins("*")
+	require.NoError(t, err)
+	assert.True(t, all)
+	assert.Empty(t, patterns)
+
+	_, _, err = ParseAllowedOrigins("https://app.example.com, example.org")
+	assert.ErrorContains(t, err, "example.org")
+}
@@ -2,13 +2,25 @@ package utils
 
 import (
 	"mime/multipart"
+	"net/netip"
+	"net/url"
 	"strings"
+
+	"csv-validator/internal/spreadsheet"
+)
+
+// Compressed upload extensions
+const (
+	ExtGzipCSV = ".csv.gz"
+	ExtZstdCSV = ".csv.zst"
+	ExtZip     = ".zip"
 )
 
-// ValidateCSVFile validates if the uploaded file is a valid CSV
+// ValidateCSVFile validates if the uploaded file is a CSV, a supported spreadsheet
+// or a compressed upload containing CSVs
 func ValidateCSVFile(fileHeader *multipart.FileHeader) error {
 	// Check file extension
-	if !strings.HasSuffix(strings.ToLower(fileHeader.Filename), ".csv") {
+	if !IsSupportedUpload(fileHeader.Filename) {
 		return ErrInvalidFileExtension
 	}
 
@@ -20,6 +32,23 @@ func ValidateCSVFile(fileHeader *multipart.FileHeader) error {
 	return nil
 }
 
+// IsSupportedUpload reports whether the filename has an extension the upload endpoints accept
+func IsSupportedUpload(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".csv") || spreadsheet.IsSpreadsheet(name) ||
+		IsCompressedCSV(name) || IsZipArchive(name)
+}
+
+// IsCompressedCSV reports whether the filename is a gzip or zstd compressed CSV
+func IsCompressedCSV(filename string) bool {
+	lower := strings.ToLower(filename)
+	return strings.HasSuffix(lower, ExtGzipCSV) || strings.HasSuffix(lower, ExtZstdCSV)
+}
+
+// IsZipArchive reports whether the filename is a zip archive
+func IsZipArchive(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(filename), ExtZip)
+}
+
 // SanitizeFilename removes potentially dangerous characters from filename
 func SanitizeFilename(filename string) string {
 	// Replace dangerous characters with underscores
@@ -63,3 +92,65 @@ func IsValidJobID(jobID string) bool {
 
 	return true
 }
+
+// IsHTTPURL checks that a URL the service connects to, such as a webhook target,
+// is an absolute http or https URL
+func IsHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// nonPublicPrefixes are special-purpose ranges that netip doesn't classify:
+// shared carrier-grade NAT space, "this network", IETF protocol assignments,
+// benchmarking, reserved space, and IPv6 prefixes that embed IPv4 addresses
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// IsPublicAddr reports whether addr is a public unicast address, not a
+// loopback, private, link-local or otherwise special-purpose one that a
+// client-chosen URL could use to reach the service's own network
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPublicHTTPURL checks that an http or https URL doesn't name a non-public
+// address or localhost outright. Host names can still resolve to anything, so
+// connections must be checked as well.
+func IsPublicHTTPURL(rawURL string) bool {
+	if !IsHTTPURL(rawURL) {
+		return false
+	}
+
+	u, _ := url.Parse(rawURL)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return IsPublicAddr(addr)
+	}
+	return true
+}
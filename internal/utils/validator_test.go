@@ -2,6 +2,7 @@ package utils
 
 import (
 	"mime/multipart"
+	"net/netip"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,9 +34,45 @@ func TestValidateCSVFile(t *testing.T) {
 			expectError: true,
 		},
 		{
-			name:        "Invalid file extension - xlsx",
+			name:        "Valid Excel workbook",
 			filename:    "test.xlsx",
 			size:        1024,
+			expectError: false,
+		},
+		{
+			name:        "Valid OpenDocument spreadsheet",
+			filename:    "test.ODS",
+			size:        1024,
+			expectError: false,
+		},
+		{
+			name:        "Valid gzip compressed CSV",
+			filename:    "export.csv.gz",
+			size:        1024,
+			expectError: false,
+		},
+		{
+			name:        "Valid zstd compressed CSV",
+			filename:    "export.CSV.ZST",
+			size:        1024,
+			expectError: false,
+		},
+		{
+			name:        "Valid zip archive",
+			filename:    "exports.zip",
+			size:        1024,
+			expectError: false,
+		},
+		{
+			name:        "Invalid compressed non-CSV",
+			filename:    "notes.txt.gz",
+			size:        1024,
+			expectError: true,
+		},
+		{
+			name:        "Invalid file extension - legacy xls",
+			filename:    "test.xls",
+			size:        1024,
 			expectError: true,
 		},
 		{
@@ -69,6 +106,20 @@ func TestValidateCSVFile(t *testing.T) {
 	}
 }
 
+func TestIsCompressedCSV(t *testing.T) {
+	assert.True(t, IsCompressedCSV("data.csv.gz"))
+	assert.True(t, IsCompressedCSV("data.csv.zst"))
+	assert.False(t, IsCompressedCSV("data.csv"))
+	assert.False(t, IsCompressedCSV("data.gz"))
+	assert.False(t, IsCompressedCSV("data.zip"))
+}
+
+func TestIsZipArchive(t *testing.T) {
+	assert.True(t, IsZipArchive("data.zip"))
+	assert.True(t, IsZipArchive("DATA.ZIP"))
+	assert.False(t, IsZipArchive("data.csv.gz"))
+}
+
 func TestSanitizeFilename(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -165,3 +216,38 @@ func TestIsValidJobID(t *testing.T) {
 		})
 	}
 }
+
+func TestIsHTTPURL(t *testing.T) {
+	assert.True(t, IsHTTPURL("https://example.com/hooks/csv"))
+	assert.True(t, IsHTTPURL("http://localhost:9000"))
+	assert.False(t, IsHTTPURL(""))
+	assert.False(t, IsHTTPURL("example.com/hook"))
+	assert.False(t, IsHTTPURL("ftp://example.com/hook"))
+	assert.False(t, IsHTTPURL("https://"))
+	assert.False(t, IsHTTPURL("://bad"))
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	for _, addr := range []string{"93.184.216.34", "8.8.8.8", "2606:4700:4700::1111"} {
+		assert.True(t, IsPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+
+	for _, addr := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1",
+		"0.0.0.0", "255.255.255.255", "224.0.0.1", "::1", "::", "fe80::1", "fd00::1",
+		"::ffff:127.0.0.1", "::ffff:169.254.169.254", "64:ff9b::a00:1",
+	} {
+		assert.False(t, IsPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestIsPublicHTTPURL(t *testing.T) {
+	assert.True(t, IsPublicHTTPURL("https://example.com/hooks/csv"))
+	assert.True(t, IsPublicHTTPURL("http://93.184.216.34:8080/hook"))
+	assert.False(t, IsPublicHTTPURL("ftp://example.com/hook"))
+	assert.False(t, IsPublicHTTPURL("http://localhost:9000"))
+	assert.False(t, IsPublicHTTPURL("http://api.LOCALHOST./hook"))
+	assert.False(t, IsPublicHTTPURL("http://127.0.0.1/hook"))
+	assert.False(t, IsPublicHTTPURL("http://169.254.169.254/latest/meta-data/"))
+	assert.False(t, IsPublicHTTPURL("http://[::1]:8080/hook"))
+}
@@ -12,7 +12,11 @@ import (
 
 	"csv-validator/internal/config"
 	"csv-validator/internal/handlers"
+	"csv-validator/internal/metrics"
+	"csv-validator/internal/models"
 	"csv-validator/internal/services"
+	"csv-validator/internal/storage"
+	"csv-validator/internal/tracing"
 	"csv-validator/pkg/logger"
 
 	"github.com/gin-gonic/gin"
@@ -27,20 +31,82 @@ func main() {
 
 	// Initialize logger
 	logger.Init(cfg.LogLevel)
+	if err := logger.SetFormat(cfg.LogFormat, os.Stdout); err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+
+	// Send spans to the configured exporter
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		SampleRatio: cfg.TracingSampleRatio,
+		Writer:      os.Stdout,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure tracing: %v", err)
+	}
 
 	// Set Gin mode
 	gin.SetMode(cfg.GinMode)
 
 	// Initialize services
-	fileService := services.NewFileService(cfg.UploadDir, cfg.DownloadDir)
+	fileService, err := newFileService(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure storage: %v", err)
+	}
+	fileService.SetCompressOutputs(cfg.CompressDownloads)
+
 	jobService := services.NewJobService()
+	// Uploads with the same content share a file, which is kept while a job reads it
+	fileService.SetInUse(jobService.UsesFile)
 	csvService := services.NewCSVService(fileService, jobService)
+	// Workbooks are zip archives too, so their parts share the decompression limits
+	csvService.SetWorkbookLimits(services.ArchiveLimits{
+		MaxTotalSize: cfg.MaxDecompressedSize,
+		MaxRatio:     cfg.MaxCompressionRatio,
+	})
+	uploadService := services.NewUploadService(cfg.ResumableDir, cfg.ResumableTTL)
+	stopUploadSweeper := uploadService.StartSweeper()
+	idempotencyService := services.NewIdempotencyService(cfg.IdempotencyTTL)
+	webhookService := services.NewWebhookService(services.WebhookConfig{
+		URLs:        cfg.WebhookURLs,
+		Secret:      cfg.WebhookSecret,
+		MaxAttempts: int(cfg.WebhookMaxAttempts),
+		RetryDelay:  cfg.WebhookRetryDelay,
+		Timeout:     cfg.WebhookTimeout,
+
+		AllowPrivateCallbacks: cfg.WebhookAllowPrivateCallbacks,
+	})
+	jobService.Subscribe(webhookService.JobChanged)
+
+	metrics.Register(metrics.Sources{
+		JobCounts:    jobService.CountByStatus,
+		StorageUsage: fileService.DiskUsage,
+	})
+
+	tenantService, err := newTenantService(cfg, jobService, fileService)
+	if err != nil {
+		log.Fatalf("Failed to configure tenants: %v", err)
+	}
+
+	healthService := services.NewHealthService(services.HealthConfig{
+		MinFreeBytes:  cfg.ReadinessMinFreeBytes,
+		MaxActiveJobs: cfg.ReadinessMaxActiveJobs,
+		Timeout:       cfg.ReadinessTimeout,
+	}, fileService, jobService)
 
 	// Initialize handlers
-	handler := handlers.NewHandler(csvService, jobService, fileService, cfg)
+	handler := handlers.NewHandler(csvService, jobService, fileService, uploadService, idempotencyService, webhookService, tenantService, healthService, cfg)
+
+	authService, err := newAuthService(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
 
 	// Setup router
-	router := setupRouter(handler)
+	router, err := setupRouter(cfg, handler, authService, services.NewMemoryRateLimitStore())
+	if err != nil {
+		log.Fatalf("Failed to set up router: %v", err)
+	}
 
 	// Create HTTP server
 	server := &http.Server{
@@ -74,44 +140,123 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	stopUploadSweeper()
+
+	// Let webhook attempts in flight finish; pending retries are dropped
+	if err := webhookService.Close(ctx); err != nil {
+		logger.Warn(fmt.Sprintf("Webhook deliveries still in flight: %v", err))
+	}
+
+	// Flush spans not exported yet
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to flush traces: %v", err))
+	}
+
 	logger.Info("Server stopped")
 }
 
-func setupRouter(handler *handlers.Handler) *gin.Engine {
-	router := gin.New()
-
-	// Add middleware
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
-	router.Use(corsMiddleware())
+// newFileService builds the file service on the configured storage backend
+func newFileService(cfg *config.Config) (*services.FileService, error) {
+	if cfg.StorageBackend != config.StorageBackendS3 {
+		return services.NewFileService(cfg.UploadDir, cfg.DownloadDir), nil
+	}
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+	store, err := storage.NewS3(storage.S3Config{
+		Endpoint:        cfg.S3Endpoint,
+		Region:          cfg.S3Region,
+		Bucket:          cfg.S3Bucket,
+		AccessKeyID:     cfg.S3AccessKeyID,
+		SecretAccessKey: cfg.S3SecretAccessKey,
+		Prefix:          cfg.S3Prefix,
+		VirtualHosted:   cfg.S3VirtualHosted,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("Storing files in S3 bucket %s at %s", cfg.S3Bucket, cfg.S3Endpoint))
+	return services.NewFileServiceWithStorage(cfg.UploadDir, cfg.DownloadDir, store), nil
+}
 
-	// API routes
-	api := router.Group("/api")
-	{
-		api.POST("/upload", handler.UploadFile)
-		api.GET("/download/:id", handler.DownloadFile)
+// newTenantService applies the default tenant limits, overridden per tenant by
+// the tenants file when one is configured
+func newTenantService(cfg *config.Config, jobService *services.JobService, fileService *services.FileService) (*services.TenantService, error) {
+	var tenants []models.Tenant
+	if cfg.TenantsFile != "" {
+		var err error
+		tenants, err = services.LoadTenantFile(cfg.TenantsFile)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("Loaded limits for %d tenants from %s", len(tenants), cfg.TenantsFile))
 	}
 
-	return router
+	defaults := models.TenantLimits{
+		MaxFileSize:       cfg.TenantMaxFileSize,
+		MaxConcurrentJobs: cfg.TenantMaxConcurrentJobs,
+		MaxStorageBytes:   cfg.TenantMaxStorageBytes,
+		MaxJobsPerDay:     cfg.TenantMaxJobsPerDay,
+	}
+	return services.NewTenantService(defaults, tenants, jobService, fileService)
 }
 
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+// newAuthService sets up API key and bearer token authentication, or returns
+// nil to leave the API open when neither is configured
+func newAuthService(cfg *config.Config) (*services.AuthService, error) {
+	if cfg.APIKeysFile == "" && !cfg.JWTEnabled() {
+		logger.Warn("Neither API_KEYS_FILE nor a JWKS is configured, the API is open to anyone")
+		return nil, nil
+	}
+
+	var keys services.APIKeyStore
+	if cfg.APIKeysFile != "" {
+		store, err := services.LoadAPIKeyFile(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("Loaded %d API keys from %s", store.Len(), cfg.APIKeysFile))
+		keys = store
+	}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	var tokens *services.JWTVerifier
+	if cfg.JWTEnabled() {
+		var err error
+		tokens, err = services.NewJWTVerifier(services.JWTConfig{
+			JWKSURL:         cfg.JWTJWKSURL,
+			JWKSFile:        cfg.JWTJWKSFile,
+			Issuer:          cfg.JWTIssuer,
+			Audience:        cfg.JWTAudience,
+			TenantClaim:     cfg.JWTTenantClaim,
+			RolesClaim:      cfg.JWTRolesClaim,
+			AdminRole:       cfg.JWTAdminRole,
+			RefreshInterval: cfg.JWTJWKSRefresh,
+		})
+		if err != nil {
+			return nil, err
 		}
+		logger.Info("Verifying bearer tokens against the configured JWKS")
+	}
 
-		c.Next()
+	return services.NewAuthService(keys, tokens), nil
+}
+
+func setupRouter(cfg *config.Config, handler *handlers.Handler, authService *services.AuthService, rateLimits services.RateLimitStore) (*gin.Engine, error) {
+	router := gin.New()
+
+	// Only believe X-Forwarded-For from our own proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
 	}
+
+	// Add middleware
+	router.Use(handlers.RequestID())
+	router.Use(handlers.Tracing())
+	router.Use(handlers.AccessLog())
+	router.Use(handlers.Metrics())
+	router.Use(gin.Recovery())
+	router.Use(handlers.CORS(cfg.AllowedOrigins, cfg.CORSMaxAge))
+
+	handler.RegisterRoutes(router, authService, rateLimits)
+
+	return router, nil
 }
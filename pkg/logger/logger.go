@@ -1,7 +1,11 @@
 package logger
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"strings"
 )
@@ -16,12 +20,25 @@ const (
 	ERROR
 )
 
+// Formats selectable with LOG_FORMAT
+const (
+	// FormatText prints "[INFO] message key=value" lines for people to read
+	FormatText = "text"
+	// FormatJSON prints a JSON object per line
+	FormatJSON = "json"
+	// FormatLogfmt prints "time=... level=INFO msg=message key=value" lines
+	FormatLogfmt = "logfmt"
+)
+
 var (
 	currentLevel LogLevel = INFO
 	debugLogger           = log.New(os.Stdout, "[DEBUG] ", log.Ldate|log.Ltime|log.Lshortfile)
 	infoLogger            = log.New(os.Stdout, "[INFO] ", log.Ldate|log.Ltime|log.Lshortfile)
 	warnLogger            = log.New(os.Stdout, "[WARN] ", log.Ldate|log.Ltime|log.Lshortfile)
 	errorLogger           = log.New(os.Stderr, "[ERROR] ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	// base is the logger every line goes through, writing in the configured format
+	base = slog.New(&textHandler{})
 )
 
 // Init initializes the logger with the specified level
@@ -40,58 +57,203 @@ func Init(level string) {
 	}
 }
 
+// SetFormat picks how lines are written: FormatText, the default, or FormatJSON
+// or FormatLogfmt for log collectors, in which case they are written to w.
+// Loggers taken before the call keep the format they had.
+func SetFormat(format string, w io.Writer) error {
+	options := &slog.HandlerOptions{Level: levelFilter{}}
+
+	switch format {
+	case FormatText:
+		base = slog.New(&textHandler{})
+	case FormatJSON:
+		base = slog.New(slog.NewJSONHandler(w, options))
+	case FormatLogfmt:
+		base = slog.New(slog.NewTextHandler(w, options))
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+// With returns a logger adding the key-value pairs in args to every line
+func With(args ...any) *slog.Logger {
+	return base.With(args...)
+}
+
+// loggerKey is the context key of the logger of a request or job
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx whose logger adds the key-value pairs in args
+// to every line, on top of those ctx's logger already adds
+func NewContext(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(args...))
+}
+
+// FromContext returns the logger stored in ctx by NewContext, or the plain
+// logger when there is none
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return base
+}
+
 // Debug logs a debug message
 func Debug(message string) {
 	if currentLevel <= DEBUG {
-		debugLogger.Println(message)
+		base.Debug(message)
 	}
 }
 
 // Info logs an info message
 func Info(message string) {
 	if currentLevel <= INFO {
-		infoLogger.Println(message)
+		base.Info(message)
 	}
 }
 
 // Warn logs a warning message
 func Warn(message string) {
 	if currentLevel <= WARN {
-		warnLogger.Println(message)
+		base.Warn(message)
 	}
 }
 
 // Error logs an error message
 func Error(message string) {
 	if currentLevel <= ERROR {
-		errorLogger.Println(message)
+		base.Error(message)
 	}
 }
 
 // Debugf logs a formatted debug message
 func Debugf(format string, args ...interface{}) {
 	if currentLevel <= DEBUG {
-		debugLogger.Printf(format, args...)
+		base.Debug(fmt.Sprintf(format, args...))
 	}
 }
 
 // Infof logs a formatted info message
 func Infof(format string, args ...interface{}) {
 	if currentLevel <= INFO {
-		infoLogger.Printf(format, args...)
+		base.Info(fmt.Sprintf(format, args...))
 	}
 }
 
 // Warnf logs a formatted warning message
 func Warnf(format string, args ...interface{}) {
 	if currentLevel <= WARN {
-		warnLogger.Printf(format, args...)
+		base.Warn(fmt.Sprintf(format, args...))
 	}
 }
 
 // Errorf logs a formatted error message
 func Errorf(format string, args ...interface{}) {
 	if currentLevel <= ERROR {
-		errorLogger.Printf(format, args...)
+		base.Error(fmt.Sprintf(format, args...))
+	}
+}
+
+// slogLevel converts a LogLevel to its slog equivalent
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case DEBUG:
+		return slog.LevelDebug
+	case WARN:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// levelFilter follows the level set with Init, so lines are filtered the
+// same whatever the format
+type levelFilter struct{}
+
+// Level returns the current level
+func (levelFilter) Level() slog.Level {
+	return slogLevel(currentLevel)
+}
+
+// textHandler is the slog handler of FormatText. It prints through the
+// per-level loggers, with attributes as key=value pairs after the message.
+type textHandler struct {
+	attrs  string // preformatted attributes added by With
+	prefix string // group names for the keys of attributes added later
+}
+
+// Enabled reports whether lines of level are printed at the current level
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slogLevel(currentLevel)
+}
+
+// Handle prints a line
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var line strings.Builder
+	line.WriteString(r.Message)
+	line.WriteString(h.attrs)
+	r.Attrs(func(attr slog.Attr) bool {
+		appendAttr(&line, h.prefix, attr)
+		return true
+	})
+
+	var target *log.Logger
+	switch {
+	case r.Level >= slog.LevelError:
+		target = errorLogger
+	case r.Level >= slog.LevelWarn:
+		target = warnLogger
+	case r.Level >= slog.LevelInfo:
+		target = infoLogger
+	default:
+		target = debugLogger
+	}
+	target.Println(line.String())
+	return nil
+}
+
+// WithAttrs returns a handler adding attrs to every line
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var line strings.Builder
+	line.WriteString(h.attrs)
+	for _, attr := range attrs {
+		appendAttr(&line, h.prefix, attr)
+	}
+	return &textHandler{attrs: line.String(), prefix: h.prefix}
+}
+
+// WithGroup returns a handler qualifying the keys of later attributes with name
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &textHandler{attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// appendAttr writes attr to line as " key=value", flattening groups into
+// dotted keys and quoting values that need it
+func appendAttr(line *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			appendAttr(line, prefix, member)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = fmt.Sprintf("%q", value)
 	}
+	fmt.Fprintf(line, " %s%s=%s", prefix, attr.Key, value)
 }
@@ -2,6 +2,8 @@ package logger
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"log"
 	"os"
 	"testing"
@@ -176,3 +178,53 @@ func TestErrorf(t *testing.T) {
 
 	assert.Contains(t, output, "connection failed: timeout")
 }
+
+func TestText_Attributes(t *testing.T) {
+	Init("info")
+	output := captureOutput(func() {
+		With("job_id", "job-1").WithGroup("file").Info("processed", "name", "a b.csv", "rows", 3)
+	})
+	assert.Contains(t, output, "[INFO]")
+	assert.Contains(t, output, `processed job_id=job-1 file.name="a b.csv" file.rows=3`)
+}
+
+func TestSetFormat(t *testing.T) {
+	defer SetFormat(FormatText, os.Stdout)
+	Init("info")
+
+	var buf bytes.Buffer
+	assert.NoError(t, SetFormat(FormatJSON, &buf))
+	With("request_id", "req-1").Info("hello", "status", 200)
+	Debug("hidden")
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "INFO", line["level"])
+	assert.Equal(t, "hello", line["msg"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.Equal(t, float64(200), line["status"])
+
+	buf.Reset()
+	assert.NoError(t, SetFormat(FormatLogfmt, &buf))
+	Warnf("retry %d", 2)
+	assert.Contains(t, buf.String(), `level=WARN msg="retry 2"`)
+
+	assert.Error(t, SetFormat("xml", &buf))
+}
+
+func TestNewContext(t *testing.T) {
+	defer SetFormat(FormatText, os.Stdout)
+	Init("info")
+
+	var buf bytes.Buffer
+	assert.NoError(t, SetFormat(FormatLogfmt, &buf))
+
+	// Without a logger in the context lines carry no attributes
+	FromContext(context.Background()).Info("plain")
+	assert.NotContains(t, buf.String(), "request_id")
+
+	ctx := NewContext(context.Background(), "request_id", "req-1")
+	ctx = NewContext(ctx, "job_id", "job-1")
+	FromContext(ctx).Info("processing")
+	assert.Contains(t, buf.String(), "msg=processing request_id=req-1 job_id=job-1")
+}